@@ -0,0 +1,62 @@
+package api
+
+import (
+	"model-inference-service/artifact"
+	"model-inference-service/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ReloadModelRequest struct {
+	// Model is the name of the model to replace; empty selects the primary model.
+	Model string `json:"model"`
+	// ModelPath is the new model file, a local path or a remote URL; empty
+	// reloads the current one.
+	ModelPath string `json:"model_path"`
+	// ClassDictionaryPath is the new class dictionary, a local path or an
+	// http(s) URL; empty keeps the current one.
+	ClassDictionaryPath string `json:"class_dictionary_path"`
+}
+
+type ReloadModelResponse struct {
+	Model  string `json:"model"`
+	Status string `json:"status"`
+}
+
+// HandleReloadModel swaps in a newly loaded model without restarting the
+// service. Requests already running finish on the previous model.
+func HandleReloadModel(inferenceService *service.InferenceService, fetcher *artifact.Fetcher) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req ReloadModelRequest
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return sendError(c, fiber.StatusBadRequest, CodeInvalidBody, "", "Invalid request body")
+			}
+		}
+
+		name := inferenceService.ResolveModel(req.Model)
+		if req.Model != "" && name != req.Model {
+			return sendError(c, fiber.StatusNotFound, CodeNotFound, "model", "Unknown model")
+		}
+
+		var classDict []service.ClassInfo
+		if req.ClassDictionaryPath != "" {
+			content, err := fetcher.ReadFile(c.UserContext(), req.ClassDictionaryPath)
+			if err != nil {
+				return sendError(c, fiber.StatusBadRequest, CodeInvalidField, "class_dictionary_path", "Failed to read class dictionary")
+			}
+			classDict, err = service.ParseClassDictionary(content)
+			if err != nil {
+				return sendError(c, fiber.StatusBadRequest, CodeInvalidField, "class_dictionary_path", "Invalid class dictionary")
+			}
+		}
+
+		if err := inferenceService.ReloadNamedModel(name, req.ModelPath, classDict); err != nil {
+			requestLogger(c.UserContext()).Error("model reload failed", "model", name, "error", err)
+			return sendError(c, fiber.StatusInternalServerError, CodeInternal, "", "Failed to reload model: "+err.Error())
+		}
+
+		requestLogger(c.UserContext()).Info("model reloaded", "model", name)
+		return c.JSON(ReloadModelResponse{Model: name, Status: "reloaded"})
+	}
+}
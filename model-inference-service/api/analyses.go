@@ -0,0 +1,194 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"model-inference-service/data"
+	"model-inference-service/event"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// AnalysisRecord is a stored analysis as returned by the retrieval endpoints.
+type AnalysisRecord struct {
+	ID        uuid.UUID  `json:"id"`
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	Body      event.Body `json:"body"`
+}
+
+func toAnalysisRecord(chronic *data.Chronic) (AnalysisRecord, error) {
+	body, err := chronic.ParseBody()
+	if err != nil {
+		return AnalysisRecord{}, err
+	}
+
+	return AnalysisRecord{
+		ID:        chronic.ID,
+		Status:    chronic.Status,
+		CreatedAt: chronic.CreatedAt,
+		Body:      body,
+	}, nil
+}
+
+// analysisETag identifies the stored state of a record. Completing a
+// pending record keeps its ID and creation time but changes its status,
+// so the status is part of the tag.
+func analysisETag(chronic *data.Chronic) string {
+	digest := sha256.Sum256([]byte(chronic.ID.String() + "|" + chronic.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + chronic.Status))
+	return `"` + hex.EncodeToString(digest[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, using the
+// weak comparison RFC 9110 prescribes for it. Fiber's Ctx.Fresh is not used
+// because it also answers If-Modified-Since, which these responses do not
+// support.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleGetAnalysis returns a stored analysis by its chronic record ID.
+// Responses carry an ETag, and a request whose If-None-Match matches it
+// gets 304 Not Modified, so clients polling an asynchronous analysis only
+// download the body once it changes.
+func HandleGetAnalysis(repository *data.ChronicRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := uuid.Parse(c.Params("id"))
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, CodeInvalidField, "id", "Invalid analysis ID")
+		}
+
+		chronic, err := repository.FindById(c.UserContext(), id)
+		if errors.Is(err, data.ErrNotFound) {
+			return sendError(c, fiber.StatusNotFound, CodeNotFound, "", "Analysis not found")
+		}
+		if err != nil {
+			return sendError(c, fiber.StatusInternalServerError, CodeInternal, "", "Failed to load analysis")
+		}
+
+		// no-cache lets clients store the response but makes them revalidate
+		// it, which a pending record needs.
+		etag := analysisETag(chronic)
+		c.Set(fiber.HeaderETag, etag)
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+		if etagMatches(c.Get(fiber.HeaderIfNoneMatch), etag) {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+
+		record, err := toAnalysisRecord(chronic)
+		if err != nil {
+			return sendError(c, fiber.StatusInternalServerError, CodeInternal, "", "Stored analysis is not valid JSON")
+		}
+
+		return c.JSON(record)
+	}
+}
+
+// Page size limits of the list endpoint.
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type AnalysisListResponse struct {
+	Items    []AnalysisRecord `json:"items"`
+	Page     int              `json:"page"`
+	PageSize int              `json:"page_size"`
+	Total    int64            `json:"total"`
+}
+
+// parsePagination reads page and page_size query parameters, defaulting to
+// the first page and clamping page_size to maxPageSize.
+func parsePagination(c *fiber.Ctx) (data.Pagination, error) {
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		return data.Pagination{}, invalidField("page", "page must be a positive integer")
+	}
+
+	pageSize := c.QueryInt("page_size", defaultPageSize)
+	if pageSize < 1 {
+		return data.Pagination{}, invalidField("page_size", "page_size must be a positive integer")
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	return data.Pagination{Page: page, PageSize: pageSize}, nil
+}
+
+// parseStatusFilter reads the optional status query parameter.
+func parseStatusFilter(c *fiber.Ctx) (string, error) {
+	status := c.Query("status")
+	if status != "" && status != event.StatusSuccess && status != event.StatusFail && status != event.StatusPending {
+		return "", invalidField("status", "status must be success, fail or pending")
+	}
+	return status, nil
+}
+
+// HandleListAnalyses returns a page of stored analyses, optionally filtered
+// by status, with the total number of matching records.
+func HandleListAnalyses(repository *data.ChronicRepository) fiber.Handler {
+	return listAnalyses(func(c *fiber.Ctx, filter data.ChronicFilter, page data.Pagination) ([]data.Chronic, int64, error) {
+		return repository.FindAll(c.UserContext(), filter, page)
+	})
+}
+
+// HandleListUserAnalyses is HandleListAnalyses restricted to the analyses
+// of the user_id path parameter, for a user's history of past scans.
+func HandleListUserAnalyses(repository *data.ChronicRepository) fiber.Handler {
+	list := listAnalyses(func(c *fiber.Ctx, filter data.ChronicFilter, page data.Pagination) ([]data.Chronic, int64, error) {
+		return repository.FindByUser(c.UserContext(), c.Params("user_id"), filter, page)
+	})
+	return func(c *fiber.Ctx) error {
+		if c.Params("user_id") == "" {
+			return sendError(c, fiber.StatusBadRequest, CodeInvalidField, "user_id", "Invalid user ID")
+		}
+		return list(c)
+	}
+}
+
+// listAnalyses serves a page of the records returned by find, which is
+// given the status query parameter as filter.
+func listAnalyses(find func(c *fiber.Ctx, filter data.ChronicFilter, page data.Pagination) ([]data.Chronic, int64, error)) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		pagination, err := parsePagination(c)
+		if err != nil {
+			return sendRequestError(c, err)
+		}
+
+		status, err := parseStatusFilter(c)
+		if err != nil {
+			return sendRequestError(c, err)
+		}
+
+		chronics, total, err := find(c, data.ChronicFilter{Status: status}, pagination)
+		if err != nil {
+			return sendError(c, fiber.StatusInternalServerError, CodeInternal, "", "Failed to list analyses")
+		}
+
+		items := make([]AnalysisRecord, len(chronics))
+		for i := range chronics {
+			items[i], err = toAnalysisRecord(&chronics[i])
+			if err != nil {
+				return sendError(c, fiber.StatusInternalServerError, CodeInternal, "", "Stored analysis is not valid JSON")
+			}
+		}
+
+		return c.JSON(AnalysisListResponse{
+			Items:    items,
+			Page:     pagination.Page,
+			PageSize: pagination.PageSize,
+			Total:    total,
+		})
+	}
+}
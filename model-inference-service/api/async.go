@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"model-inference-service/data"
+	"model-inference-service/event"
+	"model-inference-service/metrics"
+	"model-inference-service/service"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type AsyncUploadResponse struct {
+	AnalysisID string `json:"analysis_id"`
+	Status     string `json:"status"`
+}
+
+// asyncEventTimeout bounds how long a finished asynchronous analysis waits
+// for room in the event channel before completeAsync stores it directly.
+// It is a variable so tests can shorten it.
+var asyncEventTimeout = 5 * time.Second
+
+// HandleAsyncUpload accepts the same multipart upload as HandleFileUpload
+// but does not wait for inference. It takes a limiter slot, answering 503
+// when none is free, stores a pending chronic record, replies 202 with its
+// analysis ID and runs the analysis in the background, releasing the slot
+// when it ends. The result is persisted through the regular event
+// pipeline, which completes the pending record; clients poll
+// GET /analyses/:id for it.
+func HandleAsyncUpload(inferenceService *service.InferenceService, repository *data.ChronicRepository, events chan event.Event, preprocess PreprocessConfig, maxUploadBytes int64, cache *AnalysisCache, limiter *ConcurrencyLimiter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		file, err := formFile(c, "file")
+		if err != nil {
+			return sendRequestError(c, err)
+		}
+
+		if err := validateFormFile(file, "file", maxUploadBytes); err != nil {
+			return sendRequestError(c, err)
+		}
+
+		minConfidence, err := parseMinConfidence(c.FormValue("min_confidence"))
+		if err != nil {
+			return sendRequestError(c, err)
+		}
+
+		topK, err := parseTopK(c)
+		if err != nil {
+			return sendRequestError(c, err)
+		}
+
+		preprocess := preprocess
+		if preprocess.Quality, err = parseQuality(c, preprocess.Quality); err != nil {
+			return sendRequestError(c, err)
+		}
+
+		buffer, err := readFormFile(file, "file", maxUploadBytes)
+		if err != nil {
+			return sendRequestError(c, err)
+		}
+
+		analysisID := uuid.New()
+		userID := strings.Clone(c.FormValue("user_id"))
+		modelName := strings.Clone(c.FormValue("image_type"))
+
+		// The slot is taken before the pending record is stored, so a busy
+		// server leaves no record behind.
+		release, err := limiter.Acquire(c.UserContext(), metrics.TransportREST)
+		if err != nil {
+			return sendBusy(c, err)
+		}
+
+		pendingBody, err := json.Marshal(event.Body{AnalysisID: analysisID.String(), UserID: userID})
+		if err == nil {
+			err = repository.Create(c.UserContext(), &data.Chronic{
+				ID:        analysisID,
+				Body:      string(pendingBody),
+				Status:    event.StatusPending,
+				UserID:    userID,
+				CreatedAt: time.Now(),
+			})
+		}
+		if err != nil {
+			release()
+			return sendError(c, fiber.StatusInternalServerError, CodeInternal, "", "Failed to create analysis")
+		}
+
+		// The request context ends with the response; keep only its request
+		// ID and trace.
+		ctx := withRequestID(context.Background(), RequestIDFrom(c.UserContext()))
+		ctx = trace.ContextWithSpanContext(ctx, trace.SpanContextFromContext(c.UserContext()))
+		go func() {
+			// Nothing above this goroutine recovers its panics, and the
+			// pending record must still be completed.
+			defer func() {
+				if v := recover(); v != nil {
+					logPanic(ctx, "asynchronous analysis", v)
+					completeAsync(ctx, events, repository, event.Event{Status: event.StatusFail, Body: event.Body{
+						AnalysisID: analysisID.String(),
+						UserID:     userID,
+						Error:      panicReason,
+					}})
+				}
+			}()
+			analysis, err := func() (*imageAnalysis, error) {
+				defer release()
+				return analyzeImage(ctx, inferenceService, preprocess, cache, buffer, "file", service.AnalyzeOptions{
+					TopK:          topK,
+					MinConfidence: minConfidence,
+					Model:         modelName,
+				})
+			}()
+			if err != nil {
+				completeAsync(ctx, events, repository, event.Event{Status: event.StatusFail, Body: event.Body{
+					AnalysisID: analysisID.String(),
+					UserID:     userID,
+					Error:      failureReason(err),
+				}})
+				return
+			}
+			completeAsync(ctx, events, repository, analysisEvent(event.Body{
+				AnalysisID:   analysisID.String(),
+				UserID:       userID,
+				Predictions:  analysis.Predictions,
+				Margin:       analysis.Margin,
+				NeedsReview:  analysis.NeedsReview,
+				ModelName:    analysis.Model,
+				ModelVersion: analysis.ModelVersion,
+				Cached:       analysis.Cached,
+			}, analysis.Image))
+		}()
+
+		return c.Status(fiber.StatusAccepted).JSON(AsyncUploadResponse{
+			AnalysisID: analysisID.String(),
+			Status:     event.StatusPending,
+		})
+	}
+}
+
+// completeAsync sends the event completing an asynchronous analysis. Unlike
+// emitEvent it must not drop the event, which would leave the record
+// pending forever: it waits up to asyncEventTimeout for room in the channel
+// and otherwise stores the event through sink itself.
+func completeAsync(ctx context.Context, events chan event.Event, sink event.Sink, ev event.Event) {
+	if deliverEvent(ctx, events, ev, asyncEventTimeout) {
+		return
+	}
+	logger := requestLogger(ctx).With("analysis_id", ev.Body.AnalysisID, "status", ev.Status)
+	logger.Warn("event channel full, storing asynchronous analysis directly")
+	ev.RequestID = RequestIDFrom(ctx)
+	if err := sink.Store(ctx, ev); err != nil {
+		logger.Error("failed to store asynchronous analysis", "error", err)
+	}
+}
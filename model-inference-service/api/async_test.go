@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"model-inference-service/event"
+	"model-inference-service/metrics"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// recordingSink is an event.Sink keeping the events it stores.
+type recordingSink struct {
+	mu     sync.Mutex
+	stored []event.Event
+}
+
+func (s *recordingSink) Store(_ context.Context, ev event.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stored = append(s.stored, ev)
+	return nil
+}
+
+func TestCompleteAsyncNeverDropsTheEvent(t *testing.T) {
+	defer func(timeout time.Duration) { asyncEventTimeout = timeout }(asyncEventTimeout)
+	asyncEventTimeout = 10 * time.Millisecond
+
+	ctx := withRequestID(context.Background(), "req-1")
+	ev := event.Event{Status: event.StatusSuccess, Body: event.Body{AnalysisID: "a1"}}
+
+	t.Run("channel with room", func(t *testing.T) {
+		events := make(chan event.Event, 1)
+		sink := &recordingSink{}
+		completeAsync(ctx, events, sink, ev)
+		if got := drainEvents(events); len(got) != 1 || got[0].RequestID != "req-1" {
+			t.Errorf("sent events = %+v, want the event tagged with req-1", got)
+		}
+		if len(sink.stored) != 0 {
+			t.Errorf("sink stored %d events, want 0", len(sink.stored))
+		}
+	})
+
+	t.Run("full channel", func(t *testing.T) {
+		events := make(chan event.Event)
+		sink := &recordingSink{}
+		completeAsync(ctx, events, sink, ev)
+		if len(sink.stored) != 1 || sink.stored[0].Body.AnalysisID != "a1" || sink.stored[0].RequestID != "req-1" {
+			t.Errorf("sink stored %+v, want the event tagged with req-1", sink.stored)
+		}
+	})
+
+	t.Run("room within the timeout", func(t *testing.T) {
+		asyncEventTimeout = time.Minute
+		events := make(chan event.Event)
+		received := make(chan event.Event, 1)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			received <- <-events
+		}()
+		sink := &recordingSink{}
+		completeAsync(ctx, events, sink, ev)
+		if got := <-received; got.Body.AnalysisID != "a1" {
+			t.Errorf("received %+v, want a1", got)
+		}
+		if len(sink.stored) != 0 {
+			t.Errorf("sink stored %d events, want 0", len(sink.stored))
+		}
+	})
+}
+
+func TestHandleAsyncUploadRejectsWhenBusy(t *testing.T) {
+	svc, stub := newStubService()
+	limiter := NewConcurrencyLimiter(1, 0, 0, nil)
+	release, err := limiter.Acquire(context.Background(), metrics.TransportREST)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	defer release()
+
+	// No repository: a busy server must answer before storing anything.
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Post("/analyze-skin/async", HandleAsyncUpload(svc, nil, nil, PreprocessConfig{}, 1<<20, nil, limiter))
+
+	resp, err := app.Test(newMultipartRequest(t, "/analyze-skin/async", "file", encodePNG(t, gradientImage(64, 64))))
+	if err != nil {
+		t.Fatalf("app.Test() error = %v", err)
+	}
+	if resp.StatusCode != fiber.StatusServiceUnavailable || resp.Header.Get(fiber.HeaderRetryAfter) == "" {
+		t.Errorf("status = %d, Retry-After = %q; want 503 with Retry-After", resp.StatusCode, resp.Header.Get(fiber.HeaderRetryAfter))
+	}
+	if calls := stub.calls.Load(); calls != 0 {
+		t.Errorf("model ran %d times, want 0", calls)
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"crypto/subtle"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// APIKeyHeader is the request header checked by APIKeyMiddleware.
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyLocal is the c.Locals key under which APIKeyMiddleware stores the
+// validated API key of a request.
+const apiKeyLocal = "api_key"
+
+// APIKeyMiddleware rejects requests whose X-API-Key header does not match
+// one of keys with 401 and stores a valid key in c.Locals. Requests to the
+// exempt paths, such as health probes, are passed through unchecked.
+func APIKeyMiddleware(keys []string, exempt ...string) fiber.Handler {
+	exemptPaths := make(map[string]bool, len(exempt))
+	for _, path := range exempt {
+		exemptPaths[path] = true
+	}
+
+	return func(c *fiber.Ctx) error {
+		if exemptPaths[c.Path()] {
+			return c.Next()
+		}
+
+		key := c.Get(APIKeyHeader)
+		if key == "" {
+			return sendError(c, fiber.StatusUnauthorized, CodeUnauthorized, "", "Missing API key")
+		}
+		if !validAPIKey(keys, key) {
+			return sendError(c, fiber.StatusUnauthorized, CodeUnauthorized, "", "Invalid API key")
+		}
+
+		c.Locals(apiKeyLocal, key)
+		return c.Next()
+	}
+}
+
+// validAPIKey compares key against every configured key in constant time so
+// the response time does not reveal how much of a key matched.
+func validAPIKey(keys []string, key string) bool {
+	valid := false
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BodyLimitMiddleware rejects request bodies larger than limit, or than the
+// limit given in routes for the request path, with a 413. It expects the
+// server to stream request bodies (fiber.Config.StreamRequestBody) with
+// multipart pre-parsing disabled, so a large body is only read once its
+// route allows it: bodies of known length are checked against their
+// Content-Length before any of them is read, and chunked bodies are read up
+// to the limit. An oversized body is left unread and the connection is
+// closed after the response.
+func BodyLimitMiddleware(limit int, routes map[string]int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		routeLimit := limit
+		if l, ok := routes[c.Path()]; ok {
+			routeLimit = l
+		}
+
+		req := c.Request()
+		if req.Header.ContentLength() > routeLimit {
+			return sendBodyTooLarge(c)
+		}
+		if req.IsBodyStream() && req.Header.ContentLength() < 0 {
+			body, err := io.ReadAll(io.LimitReader(req.BodyStream(), int64(routeLimit)+1))
+			if err != nil {
+				return sendError(c, fiber.StatusBadRequest, CodeInvalidBody, "", "Failed to read request body")
+			}
+			if len(body) > routeLimit {
+				return sendBodyTooLarge(c)
+			}
+			req.SetBody(body)
+		}
+		return c.Next()
+	}
+}
+
+func sendBodyTooLarge(c *fiber.Ctx) error {
+	c.Context().SetConnectionClose()
+	return sendError(c, fiber.StatusRequestEntityTooLarge, CodeTooLarge, "", "Request body too large")
+}
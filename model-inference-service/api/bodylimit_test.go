@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"io"
+	"math/rand/v2"
+	"model-inference-service/event"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	const limit, batchLimit = 1 << 10, 4 << 10
+
+	app := fiber.New(fiber.Config{
+		BodyLimit:                    limit,
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
+	})
+	app.Use(BodyLimitMiddleware(limit, map[string]int{"/batch": batchLimit}))
+	echoLength := func(c *fiber.Ctx) error {
+		return c.SendString(strconv.Itoa(len(c.Body())))
+	}
+	app.Post("/single", echoLength)
+	app.Post("/batch", echoLength)
+
+	tests := []struct {
+		name       string
+		path       string
+		size       int
+		chunked    bool
+		wantStatus int
+	}{
+		{"single within limit", "/single", limit, false, fiber.StatusOK},
+		{"single above limit", "/single", limit + 1, false, fiber.StatusRequestEntityTooLarge},
+		{"batch above single limit", "/batch", 2 * limit, false, fiber.StatusOK},
+		{"batch above batch limit", "/batch", batchLimit + 1, false, fiber.StatusRequestEntityTooLarge},
+		{"chunked within limit", "/single", limit, true, fiber.StatusOK},
+		{"chunked above limit", "/single", limit + 1, true, fiber.StatusRequestEntityTooLarge},
+		{"chunked batch above single limit", "/batch", 2 * limit, true, fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodPost, tt.path, bytes.NewReader(make([]byte, tt.size)))
+			if tt.chunked {
+				req.ContentLength = -1
+				req.TransferEncoding = []string{"chunked"}
+			}
+
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("app.Test() error = %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != fiber.StatusOK {
+				if got := decodeErrorResponse(t, resp); got.Code != CodeTooLarge {
+					t.Errorf("error code = %q, want %q", got.Code, CodeTooLarge)
+				}
+				if !resp.Close {
+					t.Error("connection left open after an unread body")
+				}
+				return
+			}
+			got, _ := io.ReadAll(resp.Body)
+			if want := strconv.Itoa(tt.size); string(got) != want {
+				t.Errorf("handler read %s bytes, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestHandleBatchUploadAcceptsBodyAboveSingleLimit(t *testing.T) {
+	const maxUploadBytes = 512 << 10
+	limit := MaxRequestBodyBytes(maxUploadBytes, 0)
+
+	svc, stub := newStubService()
+	app := fiber.New(fiber.Config{
+		BodyLimit:                    limit,
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
+		ErrorHandler:                 ErrorHandler,
+	})
+	app.Use(BodyLimitMiddleware(limit, map[string]int{"/analyze-skin/batch": MaxBatchBodyBytes(maxUploadBytes)}))
+	app.Post("/analyze-skin/batch", HandleBatchUpload(svc, make(chan event.Event, 8), PreprocessConfig{}, maxUploadBytes))
+
+	// Noise does not compress, so each PNG stays close to its raw size.
+	rng := rand.New(rand.NewPCG(1, 2))
+	noise := image.NewRGBA(image.Rect(0, 0, 300, 300))
+	for i := range noise.Pix {
+		noise.Pix[i] = byte(rng.Uint32())
+	}
+	png := encodePNG(t, noise)
+	files := [][]byte{png, png, png, png, png, png}
+	req := newMultipartRequest(t, "/analyze-skin/batch", "files", files...)
+	if req.ContentLength <= int64(limit) {
+		t.Fatalf("batch body is %d bytes, want more than the single limit %d", req.ContentLength, limit)
+	}
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("app.Test() error = %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	var body BatchUploadResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode the response: %v", err)
+	}
+	if len(body.Analyses) != len(files) {
+		t.Errorf("got %d analyses, want %d", len(body.Analyses), len(files))
+	}
+	if calls := stub.calls.Load(); calls != int64(len(files)) {
+		t.Errorf("model ran %d times, want %d", calls, len(files))
+	}
+}
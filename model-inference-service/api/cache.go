@@ -0,0 +1,109 @@
+package api
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"model-inference-service/metrics"
+	"model-inference-service/service"
+	"sync"
+	"time"
+)
+
+// AnalysisCache is an LRU cache of analyses keyed by the SHA-256 of the raw
+// image bytes, so a retried or duplicate upload skips decoding and
+// inference. Keys also cover the selected model, the digest of its file and
+// the analysis options, so a reload or different request settings never
+// return a stale result. A nil cache stores nothing.
+type AnalysisCache struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order holds *cacheEntry values, most recently used first.
+	order *list.List
+}
+
+type cacheEntry struct {
+	key      string
+	analysis imageAnalysis
+	expires  time.Time
+}
+
+// NewAnalysisCache builds a cache holding up to size analyses. A ttl of 0
+// keeps entries until they are evicted.
+func NewAnalysisCache(size int, ttl time.Duration) *AnalysisCache {
+	return &AnalysisCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element, size),
+		order:   list.New(),
+	}
+}
+
+// analysisCacheKey identifies the analysis of buffer under opts and the
+// quality profile with the model currently serving opts.Model.
+func analysisCacheKey(inferenceService *service.InferenceService, buffer []byte, opts service.AnalyzeOptions, quality QualityProfile) string {
+	digest := sha256.Sum256(buffer)
+	model := inferenceService.ResolveModel(opts.Model)
+	return fmt.Sprintf("%s|%s|%s|%d|%g|%t|%s", hex.EncodeToString(digest[:]), model,
+		inferenceService.ModelDigest(model), opts.TopK, opts.MinConfidence, opts.IncludeProbabilities, quality)
+}
+
+// get returns the cached analysis of key, marked as Cached.
+func (c *AnalysisCache) get(key string) (*imageAnalysis, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if ok && c.ttl > 0 && time.Now().After(elem.Value.(*cacheEntry).expires) {
+		c.remove(elem)
+		ok = false
+	}
+	metrics.RecordCacheLookup(ok)
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	analysis := elem.Value.(*cacheEntry).analysis
+	analysis.Cached = true
+	return &analysis, true
+}
+
+// put stores an analysis, evicting the least recently used entry when the
+// cache is full. Cached analyses are shared between requests and must not
+// be modified.
+func (c *AnalysisCache) put(key string, analysis *imageAnalysis) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{key: key, analysis: *analysis, expires: time.Now().Add(c.ttl)}
+	// Sanitized images are large and only needed once; a hit re-encodes
+	// the upload instead, see sanitizeCached.
+	entry.analysis.Image.Sanitized = nil
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *AnalysisCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
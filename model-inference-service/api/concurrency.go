@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"model-inference-service/metrics"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrOverloaded is returned by ConcurrencyLimiter.Acquire when the wait
+// queue is full or the queue timeout elapses.
+var ErrOverloaded = errors.New("server is busy, try again later")
+
+// ConcurrencyLimiter caps the number of analyses running at once. Each
+// transport may hold a reserved share of the slots that only its requests
+// use, so a flood on one transport cannot starve the other; the remaining
+// slots are shared. Requests beyond the limit wait for a slot, up to
+// queueDepth of them per transport and for at most queueTimeout each;
+// further requests are rejected immediately. A nil limiter admits every
+// request.
+type ConcurrencyLimiter struct {
+	shared       chan struct{}
+	queueDepth   int
+	queueTimeout time.Duration
+
+	// transports is keyed by metrics.TransportREST and
+	// metrics.TransportGRPC; it is not modified after construction.
+	transports map[string]*transportSlots
+
+	// mu guards the counters of transports, which are exported as metrics.
+	mu sync.Mutex
+}
+
+// transportSlots holds the reserved slots and the counters of one transport.
+type transportSlots struct {
+	name     string
+	reserved chan struct{}
+	inflight int
+	queued   int
+}
+
+// NewConcurrencyLimiter builds a limiter admitting limit concurrent
+// analyses, of which reserved[transport] are kept for that transport. The
+// reservations are taken in transport order and capped at limit. A
+// queueTimeout of 0 lets queued requests wait until their context ends.
+func NewConcurrencyLimiter(limit, queueDepth int, queueTimeout time.Duration, reserved map[string]int) *ConcurrencyLimiter {
+	l := &ConcurrencyLimiter{
+		queueDepth:   queueDepth,
+		queueTimeout: queueTimeout,
+		transports:   make(map[string]*transportSlots),
+	}
+	shared := limit
+	for _, transport := range []string{metrics.TransportREST, metrics.TransportGRPC} {
+		t := &transportSlots{name: transport}
+		if n := min(reserved[transport], shared); n > 0 {
+			t.reserved = make(chan struct{}, n)
+			shared -= n
+		}
+		l.transports[transport] = t
+		metrics.SetLimiterState(transport, 0, 0)
+	}
+	l.shared = make(chan struct{}, shared)
+	return l
+}
+
+// Acquire takes a slot for a request of transport, either
+// metrics.TransportREST or metrics.TransportGRPC, waiting in the queue when
+// none is free. A reserved slot of the transport is preferred over a shared
+// one. The returned function releases the slot.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, transport string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	t := l.transports[transport]
+
+	// A nil reserved channel never accepts a send, so transports without a
+	// reservation only ever take shared slots.
+	select {
+	case t.reserved <- struct{}{}:
+		return l.admit(t, t.reserved), nil
+	default:
+	}
+	select {
+	case l.shared <- struct{}{}:
+		return l.admit(t, l.shared), nil
+	default:
+	}
+
+	l.mu.Lock()
+	if t.queued >= l.queueDepth {
+		l.mu.Unlock()
+		return nil, ErrOverloaded
+	}
+	t.queued++
+	metrics.SetLimiterState(t.name, t.inflight, t.queued)
+	l.mu.Unlock()
+	defer l.update(t, 0, -1)
+
+	var timeout <-chan time.Time
+	if l.queueTimeout > 0 {
+		timer := time.NewTimer(l.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case t.reserved <- struct{}{}:
+		return l.admit(t, t.reserved), nil
+	case l.shared <- struct{}{}:
+		return l.admit(t, l.shared), nil
+	case <-timeout:
+		return nil, ErrOverloaded
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// admit counts a request of t that took a slot of slots and returns the
+// function releasing it.
+func (l *ConcurrencyLimiter) admit(t *transportSlots, slots chan struct{}) func() {
+	l.update(t, 1, 0)
+	return func() {
+		<-slots
+		l.update(t, -1, 0)
+	}
+}
+
+// update adjusts the counters of t and publishes them.
+func (l *ConcurrencyLimiter) update(t *transportSlots, inflight, queued int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	t.inflight += inflight
+	t.queued += queued
+	metrics.SetLimiterState(t.name, t.inflight, t.queued)
+}
+
+// ConcurrencyMiddleware holds a limiter slot for the duration of the REST
+// requests it wraps and answers 503 when none can be obtained.
+func ConcurrencyMiddleware(limiter *ConcurrencyLimiter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		release, err := limiter.Acquire(c.UserContext(), metrics.TransportREST)
+		if err != nil {
+			return sendBusy(c, err)
+		}
+		defer release()
+		return c.Next()
+	}
+}
+
+// sendBusy answers a REST request that got no limiter slot with 503.
+func sendBusy(c *fiber.Ctx, err error) error {
+	if errors.Is(err, ErrOverloaded) {
+		metrics.RecordRejection(metrics.TransportREST)
+	}
+	c.Set(fiber.HeaderRetryAfter, "1")
+	return sendError(c, fiber.StatusServiceUnavailable, CodeBusy, "", "Server is busy, try again later")
+}
+
+// acquireGRPC takes a limiter slot for one gRPC analysis.
+func acquireGRPC(ctx context.Context, limiter *ConcurrencyLimiter) (func(), error) {
+	release, err := limiter.Acquire(ctx, metrics.TransportGRPC)
+	if err != nil {
+		if errors.Is(err, ErrOverloaded) {
+			metrics.RecordRejection(metrics.TransportGRPC)
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+		return nil, status.FromContextError(err).Err()
+	}
+	return release, nil
+}
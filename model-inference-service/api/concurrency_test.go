@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"model-inference-service/metrics"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiterReservesSlotsPerTransport(t *testing.T) {
+	// Four slots: one reserved for each transport and two shared.
+	limiter := NewConcurrencyLimiter(4, 0, 0, map[string]int{metrics.TransportREST: 1, metrics.TransportGRPC: 1})
+	ctx := context.Background()
+
+	var releases []func()
+	for i := 0; i < 3; i++ {
+		release, err := limiter.Acquire(ctx, metrics.TransportREST)
+		if err != nil {
+			t.Fatalf("REST request %d: Acquire() error = %v", i, err)
+		}
+		releases = append(releases, release)
+	}
+	if _, err := limiter.Acquire(ctx, metrics.TransportREST); !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("fourth REST request: Acquire() error = %v, want ErrOverloaded", err)
+	}
+
+	// REST holds its reserved slot and both shared ones; gRPC still gets
+	// its own.
+	release, err := limiter.Acquire(ctx, metrics.TransportGRPC)
+	if err != nil {
+		t.Fatalf("gRPC request: Acquire() error = %v", err)
+	}
+	if _, err := limiter.Acquire(ctx, metrics.TransportGRPC); !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("second gRPC request: Acquire() error = %v, want ErrOverloaded", err)
+	}
+	release()
+
+	// Releasing a REST slot frees a shared slot either transport may take.
+	releases[0]()
+	release, err = limiter.Acquire(ctx, metrics.TransportGRPC)
+	if err != nil {
+		t.Fatalf("gRPC request after a REST release: Acquire() error = %v", err)
+	}
+	release()
+	for _, release := range releases[1:] {
+		release()
+	}
+}
+
+func TestConcurrencyLimiterQueuesPerTransport(t *testing.T) {
+	limiter := NewConcurrencyLimiter(1, 1, 0, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	release, err := limiter.Acquire(ctx, metrics.TransportREST)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	// A REST request fills the REST queue; a gRPC request may still queue.
+	start := func(transport string) chan error {
+		done := make(chan error, 1)
+		go func() {
+			release, err := limiter.Acquire(ctx, transport)
+			if err == nil {
+				release()
+			}
+			done <- err
+		}()
+		return done
+	}
+	waitQueued := func(transport string, want int) {
+		t.Helper()
+		for {
+			limiter.mu.Lock()
+			queued := limiter.transports[transport].queued
+			limiter.mu.Unlock()
+			if queued == want {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	restDone := start(metrics.TransportREST)
+	waitQueued(metrics.TransportREST, 1)
+	if _, err := limiter.Acquire(ctx, metrics.TransportREST); !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("REST request beyond the queue: Acquire() error = %v, want ErrOverloaded", err)
+	}
+	grpcDone := start(metrics.TransportGRPC)
+	waitQueued(metrics.TransportGRPC, 1)
+
+	release()
+	for _, done := range []chan error{restDone, grpcDone} {
+		if err := <-done; err != nil {
+			t.Errorf("queued request: Acquire() error = %v", err)
+		}
+	}
+}
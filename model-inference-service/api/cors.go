@@ -0,0 +1,27 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+// CORSMiddleware allows the given origins to call the REST API from a
+// browser. Preflight requests are answered for the upload endpoints, with
+// the headers needed for multipart bodies and API key authentication, and
+// the request ID is exposed to scripts.
+func CORSMiddleware(allowedOrigins []string) fiber.Handler {
+	return cors.New(cors.Config{
+		AllowOrigins: strings.Join(allowedOrigins, ","),
+		AllowMethods: strings.Join([]string{fiber.MethodGet, fiber.MethodPost, fiber.MethodOptions}, ","),
+		AllowHeaders: strings.Join([]string{
+			fiber.HeaderOrigin,
+			fiber.HeaderAccept,
+			fiber.HeaderContentType,
+			APIKeyHeader,
+			RequestIDHeader,
+		}, ","),
+		ExposeHeaders: RequestIDHeader,
+	})
+}
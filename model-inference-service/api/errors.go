@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"model-inference-service/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ErrorResponse is the body of every REST error. Code is a stable,
+// machine-readable identifier, one of the Code constants; Message explains
+// the problem to a person, and Field names the form field, JSON key or
+// query parameter at fault when there is one. Error repeats Message for
+// clients written against the earlier {"error": "..."} body.
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
+	Error   string `json:"error"`
+}
+
+// Codes of ErrorResponse. Codes may be added, but an existing code keeps
+// its meaning.
+const (
+	// CodeInvalidBody is a request body that cannot be parsed.
+	CodeInvalidBody = "invalid_body"
+	// CodeMissingField is a required field that is absent.
+	CodeMissingField = "missing_field"
+	// CodeInvalidField is a field whose value is rejected.
+	CodeInvalidField = "invalid_field"
+	// CodeTooLarge is an upload or body above the size limit.
+	CodeTooLarge = "too_large"
+	// CodeUnsupportedMediaType is a content type or image format that is
+	// not accepted.
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	// CodeInvalidImage is an image that is empty, truncated, cannot be
+	// decoded or is too small.
+	CodeInvalidImage = "invalid_image"
+	// CodeInvalidRequest is a request rejected for another reason, such as
+	// an unsupported method.
+	CodeInvalidRequest = "invalid_request"
+	// CodeTooManyFiles is a batch with more than maxBatchFiles files.
+	CodeTooManyFiles = "too_many_files"
+	CodeNotFound     = "not_found"
+	CodeUnauthorized = "unauthorized"
+	CodeRateLimited  = "rate_limited"
+	CodeBusy         = "busy"
+	CodeNoSignal     = "no_signal"
+	CodeTimeout      = "timeout"
+	CodeInternal     = "internal_error"
+)
+
+// requestError is a failed request, reported to the client as an
+// ErrorResponse with status. The cause, if any, is kept for logs and the
+// audit record but not sent.
+type requestError struct {
+	status  int
+	code    string
+	field   string
+	message string
+	cause   error
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func (e *requestError) Unwrap() error {
+	return e.cause
+}
+
+// invalidField rejects the value of field with a 400.
+func invalidField(field, message string) *requestError {
+	return &requestError{status: fiber.StatusBadRequest, code: CodeInvalidField, field: field, message: message}
+}
+
+// sendError writes an ErrorResponse with status.
+func sendError(c *fiber.Ctx, status int, code, field, message string) error {
+	return c.Status(status).JSON(ErrorResponse{
+		Code:    code,
+		Message: message,
+		Field:   field,
+		Error:   message,
+	})
+}
+
+// sendRequestError writes err, which should be a *requestError; any other
+// error is reported as a 500 with its message.
+func sendRequestError(c *fiber.Ctx, err error) error {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return sendError(c, reqErr.status, reqErr.code, reqErr.field, reqErr.message)
+	}
+	return sendError(c, fiber.StatusInternalServerError, CodeInternal, "", err.Error())
+}
+
+// inferenceRequestError maps an inference error to the error reported to
+// the client.
+func inferenceRequestError(err error) *requestError {
+	switch {
+	case errors.Is(err, service.ErrNoSignal):
+		return &requestError{status: fiber.StatusUnprocessableEntity, code: CodeNoSignal, message: "Inference produced no signal", cause: err}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &requestError{status: fiber.StatusGatewayTimeout, code: CodeTimeout, message: "Inference timed out", cause: err}
+	default:
+		return &requestError{status: fiber.StatusInternalServerError, code: CodeInternal, message: "Inference failed", cause: err}
+	}
+}
+
+// failureReason describes err for the chronic record, including the cause
+// behind a client-facing requestError.
+func failureReason(err error) string {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) && reqErr.cause != nil {
+		return fmt.Sprintf("%s: %v", reqErr.message, reqErr.cause)
+	}
+	return err.Error()
+}
+
+// ErrorHandler is the Fiber error handler, reporting the errors returned
+// by handlers and by Fiber itself, such as unknown routes, as an
+// ErrorResponse too.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return sendRequestError(c, err)
+	}
+
+	status, code := fiber.StatusInternalServerError, CodeInternal
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		status = fiberErr.Code
+		switch status {
+		case fiber.StatusNotFound:
+			code = CodeNotFound
+		case fiber.StatusRequestEntityTooLarge:
+			code = CodeTooLarge
+		case fiber.StatusUnsupportedMediaType:
+			code = CodeUnsupportedMediaType
+		case fiber.StatusTooManyRequests:
+			code = CodeRateLimited
+		case fiber.StatusServiceUnavailable:
+			code = CodeBusy
+		default:
+			if status < fiber.StatusInternalServerError {
+				code = CodeInvalidRequest
+			}
+		}
+	}
+	return sendError(c, status, code, "", err.Error())
+}
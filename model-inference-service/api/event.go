@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"model-inference-service/event"
+	"model-inference-service/tracing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// emitEvent hands an analysis result to the chronic event processor, tagged
+// with the request ID in ctx. The send never blocks: if the channel is full
+// the event is dropped and logged so a slow database cannot stall requests.
+func emitEvent(ctx context.Context, events chan event.Event, status string, body event.Body) {
+	sendEvent(ctx, events, event.Event{Status: status, Body: body})
+}
+
+// emitAnalysisEvent is emitEvent for a successful analysis, recording how
+// the image was preprocessed and carrying the sanitized image to store with
+// the record when image storage is enabled.
+func emitAnalysisEvent(ctx context.Context, events chan event.Event, body event.Body, decoded DecodedImage) {
+	sendEvent(ctx, events, analysisEvent(body, decoded))
+}
+
+// analysisEvent builds the success event of body, as emitAnalysisEvent
+// sends it.
+func analysisEvent(body event.Body, decoded DecodedImage) event.Event {
+	body.Preprocessing = decoded.Preprocessing
+	return event.Event{Status: event.StatusSuccess, Body: body, Image: decoded.Sanitized}
+}
+
+// emitBatchFailure records a failed batch of items as one fail event per
+// item: the items of a batch are analyzed in one model call, so they fail
+// together.
+func emitBatchFailure(ctx context.Context, events chan event.Event, userID string, items int, err error) {
+	for range items {
+		emitEvent(ctx, events, event.StatusFail, event.Body{
+			AnalysisID: uuid.New().String(),
+			UserID:     userID,
+			Error:      failureReason(err),
+		})
+	}
+}
+
+func sendEvent(ctx context.Context, events chan event.Event, ev event.Event) {
+	if !deliverEvent(ctx, events, ev, 0) {
+		requestLogger(ctx).Warn("event channel full, dropping event", "analysis_id", ev.Body.AnalysisID, "status", ev.Status)
+	}
+}
+
+// deliverEvent tags ev with the request ID and trace of ctx and sends it,
+// waiting up to wait for room in the channel. It reports whether the event
+// was sent.
+func deliverEvent(ctx context.Context, events chan event.Event, ev event.Event, wait time.Duration) bool {
+	body := ev.Body
+	logger := requestLogger(ctx).With("analysis_id", body.AnalysisID, "status", ev.Status)
+
+	ev.RequestID = RequestIDFrom(ctx)
+	ev.Trace = tracing.Inject(ctx)
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case events <- ev:
+		case <-timer.C:
+			return false
+		}
+	} else {
+		select {
+		case events <- ev:
+		default:
+			return false
+		}
+	}
+
+	if body.Error != "" {
+		logger.Warn("analysis failed", "error", body.Error)
+	} else {
+		logger.Debug("analysis completed")
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"fmt"
+	"image/color"
+	"os"
+	"testing"
+)
+
+// TestDecodeImageAppliesEXIFOrientation decodes the
+// testdata/orientation_N.jpg fixtures, which all show the same 48x32 picture,
+// blue with a red 16x16 block in the top-left corner, stored with EXIF
+// orientation N: mirrored, rotated or both so that only applying the
+// orientation brings the red block back to the top left. Even orientations
+// use a little-endian TIFF header, odd ones a big-endian one.
+func TestDecodeImageAppliesEXIFOrientation(t *testing.T) {
+	for orientation := 1; orientation <= 8; orientation++ {
+		t.Run(fmt.Sprint(orientation), func(t *testing.T) {
+			buffer, err := os.ReadFile(fmt.Sprintf("testdata/orientation_%d.jpg", orientation))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := jpegOrientation(buffer); got != orientation {
+				t.Fatalf("jpegOrientation() = %d, want %d", got, orientation)
+			}
+
+			img, format, err := decodeImage(buffer, 0)
+			if err != nil {
+				t.Fatalf("decodeImage() error = %v", err)
+			}
+			if format != "jpeg" {
+				t.Errorf("format = %q, want jpeg", format)
+			}
+			b := img.Bounds()
+			if b.Dx() != 48 || b.Dy() != 32 {
+				t.Fatalf("decoded size = %dx%d, want 48x32", b.Dx(), b.Dy())
+			}
+			if c := color.RGBAModel.Convert(img.At(b.Min.X, b.Min.Y)).(color.RGBA); c.R < 160 || c.B > 100 {
+				t.Errorf("top-left pixel = %v, want red", c)
+			}
+			if c := color.RGBAModel.Convert(img.At(b.Max.X-1, b.Min.Y)).(color.RGBA); c.B < 160 || c.R > 100 {
+				t.Errorf("top-right pixel = %v, want blue", c)
+			}
+		})
+	}
+}
+
+func TestJPEGOrientationWithoutEXIF(t *testing.T) {
+	for name, buffer := range map[string][]byte{
+		"no exif":   encodeJPEG(t, gradientImage(8, 8)),
+		"png":       encodePNG(t, gradientImage(8, 8)),
+		"truncated": {0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x40, 'E', 'x', 'i', 'f'},
+	} {
+		if got := jpegOrientation(buffer); got != 1 {
+			t.Errorf("%s: jpegOrientation() = %d, want 1", name, got)
+		}
+	}
+}
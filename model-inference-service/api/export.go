@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"model-inference-service/data"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Row limits of the CSV export.
+const (
+	defaultExportRows = 10_000
+	maxExportRows     = 100_000
+)
+
+// exportFlushRows is how many rows are buffered before the export is
+// flushed to the client.
+const exportFlushRows = 500
+
+// exportColumns is the header row of the CSV export.
+var exportColumns = []string{"id", "user_id", "status", "created_at", "top_class", "confidence"}
+
+// HandleExportDisabled answers GET /analyses/export with a 404 when the
+// export is not configured, instead of letting /analyses/:id reject
+// "export" as an invalid analysis ID.
+func HandleExportDisabled() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return sendError(c, fiber.StatusNotFound, CodeNotFound, "", "Analysis export is disabled on this server")
+	}
+}
+
+// HandleExportAnalyses streams the stored analyses matching the status,
+// from and to query parameters as CSV, oldest first, with the top
+// prediction of each. from and to take RFC 3339 timestamps or dates; to is
+// exclusive. At most limit rows are exported, defaulting to 10000 and
+// clamped to 100000. X-Total-Count gives the number of matching analyses,
+// and X-Export-Truncated is set when it exceeds the limit, in which case
+// the range should be narrowed.
+//
+// Rows are written as they are read from the database. A failure after
+// the first rows were sent can no longer change the status, so it ends the
+// export early and is logged.
+func HandleExportAnalyses(repository *data.ChronicRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		status, err := parseStatusFilter(c)
+		if err != nil {
+			return sendRequestError(c, err)
+		}
+		filter := data.ChronicFilter{Status: status}
+		if filter.From, err = parseTimeQuery(c, "from"); err != nil {
+			return sendRequestError(c, err)
+		}
+		if filter.To, err = parseTimeQuery(c, "to"); err != nil {
+			return sendRequestError(c, err)
+		}
+
+		limit := c.QueryInt("limit", defaultExportRows)
+		if limit < 1 {
+			return sendError(c, fiber.StatusBadRequest, CodeInvalidField, "limit", "limit must be a positive integer")
+		}
+		limit = min(limit, maxExportRows)
+
+		ctx := c.UserContext()
+		total, err := repository.Count(ctx, filter)
+		if err != nil {
+			return sendError(c, fiber.StatusInternalServerError, CodeInternal, "", "Failed to export analyses")
+		}
+
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="analyses.csv"`)
+		c.Set("X-Total-Count", strconv.FormatInt(total, 10))
+		if total > int64(limit) {
+			c.Set("X-Export-Truncated", "true")
+		}
+
+		// The writer runs after the handler has returned, so it must not
+		// use c.
+		logger := requestLogger(ctx)
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			out := csv.NewWriter(w)
+			out.Write(exportColumns)
+
+			rows := 0
+			err := repository.Export(ctx, filter, limit, func(chronic *data.Chronic) error {
+				out.Write(exportRow(chronic))
+				if rows++; rows%exportFlushRows != 0 {
+					return nil
+				}
+				out.Flush()
+				if err := out.Error(); err != nil {
+					return err
+				}
+				return w.Flush()
+			})
+			out.Flush()
+			if err == nil {
+				err = out.Error()
+			}
+			if err != nil {
+				logger.Error("analysis export failed", "rows", rows, "error", err)
+			}
+		})
+		return nil
+	}
+}
+
+// exportRow formats one record of the CSV export. The prediction columns
+// are empty for failed and pending analyses.
+func exportRow(chronic *data.Chronic) []string {
+	row := []string{
+		chronic.ID.String(),
+		chronic.UserID,
+		chronic.Status,
+		chronic.CreatedAt.UTC().Format(time.RFC3339Nano),
+		"",
+		"",
+	}
+	if body, err := chronic.ParseBody(); err == nil && len(body.Predictions) > 0 {
+		row[4] = body.Predictions[0].ClassName
+		row[5] = strconv.FormatFloat(float64(body.Predictions[0].Confidence), 'f', -1, 32)
+	}
+	return row
+}
+
+// parseTimeQuery reads a query parameter holding an RFC 3339 timestamp or a
+// date. It returns the zero time when the parameter is absent.
+func parseTimeQuery(c *fiber.Ctx, name string) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, invalidField(name, fmt.Sprintf("%s must be an RFC 3339 timestamp or a date such as 2025-01-31", name))
+}
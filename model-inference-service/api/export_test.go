@@ -0,0 +1,26 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestHandleExportDisabled(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/analyses/export", HandleExportDisabled())
+	// The ID is rejected before the repository is used.
+	app.Get("/analyses/:id", HandleGetAnalysis(nil))
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/analyses/export", nil))
+	if err != nil {
+		t.Fatalf("app.Test() error = %v", err)
+	}
+	if resp.StatusCode != fiber.StatusNotFound {
+		t.Fatalf("status = %d, want 404", resp.StatusCode)
+	}
+	if got := decodeErrorResponse(t, resp); got.Code != CodeNotFound || got.Message != "Analysis export is disabled on this server" {
+		t.Errorf("error = %+v, want the export disabled error", got)
+	}
+}
@@ -1,33 +1,66 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"io"
 	"model-inference-service/event"
+	"model-inference-service/metrics"
 	"model-inference-service/service"
 	"time"
 
 	pb "model-inference-service/gen"
 
 	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type SkinAnalysisServer struct {
 	pb.UnimplementedSkinAnalysisServiceServer
 	inferenceService *service.InferenceService
-	event            chan event.Event
+	events           chan event.Event
+	preprocess       PreprocessConfig
+	maxImageBytes    int64
+	limiter          *ConcurrencyLimiter
+	cache            *AnalysisCache
 }
 
-func NewSkinAnalysisServer(inferenceService *service.InferenceService, event chan event.Event) *SkinAnalysisServer {
+// NewSkinAnalysisServer builds the gRPC service. Streams whose declared or
+// accumulated image size exceeds maxImageBytes are aborted.
+func NewSkinAnalysisServer(inferenceService *service.InferenceService, events chan event.Event, preprocess PreprocessConfig, maxImageBytes int64) *SkinAnalysisServer {
 	return &SkinAnalysisServer{
 		inferenceService: inferenceService,
-		event:            event,
+		events:           events,
+		preprocess:       preprocess,
+		maxImageBytes:    maxImageBytes,
 	}
 }
 
+// SetConcurrencyLimiter makes every analysis, including each frame of an
+// AnalyzeSkinFrames stream, hold a slot of limiter. It must be called
+// before the server is registered.
+func (s *SkinAnalysisServer) SetConcurrencyLimiter(limiter *ConcurrencyLimiter) {
+	s.limiter = limiter
+}
+
+// SetAnalysisCache answers single-image analyses of previously seen image
+// bytes from cache. Batched AnalyzeSkin calls are not cached. It must be
+// called before the server is registered.
+func (s *SkinAnalysisServer) SetAnalysisCache(cache *AnalysisCache) {
+	s.cache = cache
+}
+
+// AnalyzeSkin analyzes the image reassembled from the stream's chunks. When
+// info declares an image_count above 1, each image ends with an
+// end_of_frame marker (optional after the last one) and the images are
+// analyzed in one model call, like the REST batch endpoint.
 func (s *SkinAnalysisServer) AnalyzeSkin(stream pb.SkinAnalysisService_AnalyzeSkinServer) error {
 	var imageData []byte
-	var _ *pb.ImageInfo
+	var images [][]byte
+	var info *pb.ImageInfo
+	var offsets chunkOffsets
 
 	for {
 		req, err := stream.Recv()
@@ -40,26 +73,370 @@ func (s *SkinAnalysisServer) AnalyzeSkin(stream pb.SkinAnalysisService_AnalyzeSk
 
 		switch payload := req.RequestPayload.(type) {
 		case *pb.AnalyzeSkinRequest_Info:
-			_ = payload.Info
+			info = payload.Info
+			count := info.GetImageCount()
+			if count < 0 || count > maxBatchFiles {
+				return status.Errorf(codes.InvalidArgument, "image_count must be between 0 and %d", maxBatchFiles)
+			}
+			if limit := s.maxImageBytes * int64(max(count, 1)); info.GetImageSize() > limit {
+				return status.Errorf(codes.ResourceExhausted, "declared image size %d exceeds the %d byte limit", info.GetImageSize(), limit)
+			}
 		case *pb.AnalyzeSkinRequest_Chunk:
+			if err := offsets.check(req, len(imageData)); err != nil {
+				return err
+			}
+			if int64(len(imageData))+int64(len(payload.Chunk)) > s.maxImageBytes {
+				return status.Errorf(codes.ResourceExhausted, "image data exceeds the %d byte limit", s.maxImageBytes)
+			}
 			imageData = append(imageData, payload.Chunk...)
+		case *pb.AnalyzeSkinRequest_EndOfFrame:
+			count := int(info.GetImageCount())
+			if !payload.EndOfFrame || count <= 1 {
+				continue
+			}
+			if len(images) == count {
+				return status.Errorf(codes.InvalidArgument, "received more than the declared %d images", count)
+			}
+			images = append(images, imageData)
+			imageData = nil
+		}
+	}
+
+	if count := int(info.GetImageCount()); count > 1 {
+		if len(imageData) > 0 {
+			images = append(images, imageData)
 		}
+		if len(images) != count {
+			return status.Errorf(codes.InvalidArgument, "declared %d images but received %d", count, len(images))
+		}
+		response, err := s.analyzeImages(stream.Context(), info, images)
+		if err != nil {
+			return err
+		}
+		return stream.SendAndClose(response)
+	}
+
+	response, err := s.analyzeFrame(stream.Context(), info, imageData)
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(response)
+}
+
+// AnalyzeSkinFrames analyzes a stream of frames, replying to each frame as
+// soon as its end_of_frame marker arrives. The latest info applies to every
+// following frame; chunks left when the client closes the stream form the
+// last frame. A failed frame ends the stream with its status error.
+func (s *SkinAnalysisServer) AnalyzeSkinFrames(stream pb.SkinAnalysisService_AnalyzeSkinFramesServer) error {
+	var frame []byte
+	var info *pb.ImageInfo
+	var offsets chunkOffsets
+
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			if len(frame) == 0 {
+				return nil
+			}
+			response, err := s.analyzeFrame(stream.Context(), info, frame)
+			if err != nil {
+				return err
+			}
+			return stream.Send(response)
+		}
+		if err != nil {
+			return err
+		}
+
+		switch payload := req.RequestPayload.(type) {
+		case *pb.AnalyzeSkinRequest_Info:
+			info = payload.Info
+			if info.GetImageSize() > s.maxImageBytes {
+				return status.Errorf(codes.ResourceExhausted, "declared image size %d exceeds the %d byte limit", info.GetImageSize(), s.maxImageBytes)
+			}
+		case *pb.AnalyzeSkinRequest_Chunk:
+			if err := offsets.check(req, len(frame)); err != nil {
+				return err
+			}
+			if int64(len(frame))+int64(len(payload.Chunk)) > s.maxImageBytes {
+				return status.Errorf(codes.ResourceExhausted, "frame data exceeds the %d byte limit", s.maxImageBytes)
+			}
+			frame = append(frame, payload.Chunk...)
+		case *pb.AnalyzeSkinRequest_EndOfFrame:
+			if !payload.EndOfFrame {
+				continue
+			}
+			response, err := s.analyzeFrame(stream.Context(), info, frame)
+			if err != nil {
+				return err
+			}
+			if err := stream.Send(response); err != nil {
+				return err
+			}
+			frame = nil
+		}
+	}
+}
+
+// chunkOffsets validates the optional offsets of a stream's chunks. The
+// first chunk decides whether the stream uses them; each offset must then
+// equal the bytes received so far for the current image, so retransmitted
+// and skipped chunks are rejected rather than silently corrupting it.
+type chunkOffsets struct {
+	seen bool
+	used bool
+}
+
+// check validates the chunk in req, received bytes into its image.
+func (o *chunkOffsets) check(req *pb.AnalyzeSkinRequest, received int) error {
+	if !o.seen {
+		o.seen = true
+		o.used = req.Offset != nil
+	}
+	if (req.Offset != nil) != o.used {
+		return status.Error(codes.InvalidArgument, "chunk offset must be set on every chunk or on none")
+	}
+	if !o.used {
+		return nil
+	}
+
+	switch offset := req.GetOffset(); {
+	case offset < int64(received):
+		return status.Errorf(codes.InvalidArgument, "duplicate chunk at offset %d: %d bytes already received", offset, received)
+	case offset > int64(received):
+		return status.Errorf(codes.InvalidArgument, "out-of-order chunk at offset %d: expected offset %d", offset, received)
+	}
+	return nil
+}
+
+// AnalyzeSkinImage analyzes an image sent whole in one message, for clients
+// that do not need chunking.
+func (s *SkinAnalysisServer) AnalyzeSkinImage(ctx context.Context, req *pb.AnalyzeSkinImageRequest) (*pb.AnalyzeSkinResponse, error) {
+	info := req.GetInfo()
+	if info.GetImageCount() > 1 {
+		return nil, status.Error(codes.InvalidArgument, "image_count is not supported by AnalyzeSkinImage, use AnalyzeSkin")
+	}
+	if int64(len(req.GetImage())) > s.maxImageBytes {
+		return nil, status.Errorf(codes.ResourceExhausted, "image data exceeds the %d byte limit", s.maxImageBytes)
+	}
+	return s.analyzeFrame(ctx, info, req.GetImage())
+}
+
+// analyzeFrame analyzes one reassembled image, emits its chronic event and
+// builds the response.
+func (s *SkinAnalysisServer) analyzeFrame(ctx context.Context, info *pb.ImageInfo, imageData []byte) (*pb.AnalyzeSkinResponse, error) {
+	release, err := acquireGRPC(ctx, s.limiter)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	analysisID := uuid.New().String()
+
+	analysis, err := s.analyze(ctx, info, imageData)
+	if err != nil {
+		emitEvent(ctx, s.events, event.StatusFail, event.Body{
+			AnalysisID: analysisID,
+			UserID:     info.GetUserId(),
+			Error:      err.Error(),
+		})
+		return nil, err
+	}
+
+	emitAnalysisEvent(ctx, s.events, event.Body{
+		AnalysisID:   analysisID,
+		UserID:       info.GetUserId(),
+		Predictions:  analysis.Predictions,
+		Margin:       analysis.Margin,
+		NeedsReview:  analysis.NeedsReview,
+		ModelName:    analysis.Model,
+		ModelVersion: analysis.ModelVersion,
+		Cached:       analysis.Cached,
+	}, analysis.Image)
+
+	return newAnalyzeSkinResponse(analysisID, analysis), nil
+}
+
+// analyzeImages analyzes the images of a batched AnalyzeSkin stream in one
+// model call and returns one response per image under Analyses. As with
+// the REST batch endpoint, an image that cannot be decoded fails the whole
+// batch.
+func (s *SkinAnalysisServer) analyzeImages(ctx context.Context, info *pb.ImageInfo, images [][]byte) (*pb.AnalyzeSkinResponse, error) {
+	opts, err := analyzeOptions(info)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := acquireGRPC(ctx, s.limiter)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	analyses, decoded, err := s.analyzeBatch(ctx, info, images, opts)
+	if err != nil {
+		emitBatchFailure(ctx, s.events, info.GetUserId(), len(images), err)
+		return nil, err
 	}
 
-	// There should be image processing and model inference
-	// For now returning mock response
 	response := &pb.AnalyzeSkinResponse{
-		AnalysisId:        uuid.New().String(),
 		AnalysisTimestamp: timestamppb.New(time.Now()),
-		Results: []*pb.AnalysisResult{
-			{
-				Label:          "normal",
-				Confidence:     0.95,
-				Description:    "Skin appears normal",
-				Recommendation: "Continue with regular skin care routine",
-			},
-		},
+		Analyses:          make([]*pb.AnalyzeSkinResponse, len(analyses)),
 	}
+	for i, analysis := range analyses {
+		recordAnalysis(metrics.TransportGRPC, analysis)
+		analysisID := uuid.New().String()
+		emitAnalysisEvent(ctx, s.events, event.Body{
+			AnalysisID:   analysisID,
+			UserID:       info.GetUserId(),
+			Predictions:  analysis.Predictions,
+			Margin:       analysis.Margin,
+			NeedsReview:  analysis.NeedsReview,
+			ModelName:    analysis.Model,
+			ModelVersion: analysis.ModelVersion,
+		}, decoded[i])
+		response.Analyses[i] = newAnalyzeSkinResponse(analysisID, &imageAnalysis{Analysis: analysis, Image: decoded[i]})
+	}
+	return response, nil
+}
 
-	return stream.SendAndClose(response)
+// analyzeBatch preprocesses images and analyzes them in one model call.
+func (s *SkinAnalysisServer) analyzeBatch(ctx context.Context, info *pb.ImageInfo, images [][]byte, opts service.AnalyzeOptions) ([]*service.Analysis, []DecodedImage, error) {
+	preprocess, err := s.preprocessFor(info)
+	if err != nil {
+		return nil, nil, err
+	}
+	inputs := make([][][]float32, len(images))
+	decoded := make([]DecodedImage, len(images))
+	for i, imageData := range images {
+		if len(imageData) == 0 {
+			return nil, nil, status.Errorf(codes.InvalidArgument, "image %d: no image data received", i)
+		}
+		inputs[i], decoded[i], err = preprocessImageViews(ctx, imageData, preprocess)
+		if err != nil {
+			return nil, nil, status.Errorf(codes.InvalidArgument, "image %d: failed to decode image: %v", i, err)
+		}
+	}
+
+	start := time.Now()
+	analyses, err := s.inferenceService.AnalyzeBatchViews(ctx, inputs, opts)
+	metrics.ObserveInference(metrics.TransportGRPC, time.Since(start))
+	if err != nil {
+		return nil, nil, inferenceError(err)
+	}
+	return analyses, decoded, nil
+}
+
+// newAnalyzeSkinResponse builds the response of one analyzed image.
+func newAnalyzeSkinResponse(analysisID string, analysis *imageAnalysis) *pb.AnalyzeSkinResponse {
+	results := toAnalysisResults(analysis.Predictions)
+	pbResults := make([]*pb.AnalysisResult, len(results))
+	for i, r := range results {
+		pbResults[i] = &pb.AnalysisResult{
+			Label:          r.Label,
+			Confidence:     r.Confidence,
+			Description:    r.Description,
+			Recommendation: r.Recommendation,
+		}
+	}
+
+	return &pb.AnalyzeSkinResponse{
+		AnalysisId:        analysisID,
+		AnalysisTimestamp: timestamppb.New(time.Now()),
+		Results:           pbResults,
+		Margin:            analysis.Margin,
+		NeedsReview:       analysis.NeedsReview,
+		ReviewMessage:     analysis.ReviewMessage,
+		InputWidth:        int32(analysis.Image.Width),
+		InputHeight:       int32(analysis.Image.Height),
+		DetectedFormat:    analysis.Image.Format,
+		Cached:            analysis.Cached,
+		ModelName:         analysis.Model,
+		ModelVersion:      analysis.ModelVersion,
+	}
+}
+
+// analyze runs preprocessing and inference on the reassembled image and
+// maps failures to gRPC status errors.
+func (s *SkinAnalysisServer) analyze(ctx context.Context, info *pb.ImageInfo, imageData []byte) (*imageAnalysis, error) {
+	if len(imageData) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no image data received")
+	}
+
+	opts, err := analyzeOptions(info)
+	if err != nil {
+		return nil, err
+	}
+
+	preprocess, err := s.preprocessFor(info)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheKey := analysisCacheKey(s.inferenceService, imageData, opts, preprocess.Quality)
+	if cached, ok := s.cache.get(cacheKey); ok {
+		recordAnalysis(metrics.TransportGRPC, cached.Analysis)
+		sanitizeCached(cached, imageData, s.preprocess)
+		return cached, nil
+	}
+
+	views, decoded, err := preprocessImageViews(ctx, imageData, preprocess)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to decode image: %v", err)
+	}
+
+	start := time.Now()
+	analysis, err := analyzeViews(ctx, s.inferenceService, views, opts)
+	metrics.ObserveInference(metrics.TransportGRPC, time.Since(start))
+	if err != nil {
+		return nil, inferenceError(err)
+	}
+
+	recordAnalysis(metrics.TransportGRPC, analysis)
+	result := &imageAnalysis{Analysis: analysis, Image: decoded}
+	s.cache.put(cacheKey, result)
+	return result, nil
+}
+
+// preprocessFor returns the preprocessing of the model and quality profile
+// selected by info.
+func (s *SkinAnalysisServer) preprocessFor(info *pb.ImageInfo) (PreprocessConfig, error) {
+	preprocess := s.preprocess.forModel(s.inferenceService, info.GetImageType())
+	if info.GetQuality() != "" {
+		quality, err := ParseQualityProfile(info.GetQuality())
+		if err != nil {
+			return PreprocessConfig{}, status.Error(codes.InvalidArgument, err.Error())
+		}
+		preprocess.Quality = quality
+	}
+	return preprocess, nil
+}
+
+// analyzeOptions validates the analysis settings of info.
+func analyzeOptions(info *pb.ImageInfo) (service.AnalyzeOptions, error) {
+	minConfidence := info.GetMinConfidence()
+	if minConfidence < 0 || minConfidence > 1 {
+		return service.AnalyzeOptions{}, status.Error(codes.InvalidArgument, "min_confidence must be between 0 and 1")
+	}
+	if info.GetTopK() < 0 {
+		return service.AnalyzeOptions{}, status.Error(codes.InvalidArgument, "top_k must not be negative")
+	}
+	return service.AnalyzeOptions{
+		TopK:          int(info.GetTopK()),
+		MinConfidence: minConfidence,
+		Model:         info.GetImageType(),
+	}, nil
+}
+
+// inferenceError maps an inference failure to a gRPC status error.
+func inferenceError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrNoSignal):
+		return status.Error(codes.FailedPrecondition, "inference produced no signal")
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, "inference timed out")
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "inference canceled")
+	}
+	return status.Errorf(codes.Internal, "inference failed: %v", err)
 }
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"model-inference-service/event"
+	pb "model-inference-service/gen"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestGRPCClient serves server over an in-memory connection and returns a
+// client for it.
+func newTestGRPCClient(t *testing.T, server pb.SkinAnalysisServiceServer) pb.SkinAnalysisServiceClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	pb.RegisterSkinAnalysisServiceServer(grpcServer, server)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("grpc.NewClient() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewSkinAnalysisServiceClient(conn)
+}
+
+func TestAnalyzeSkinRejectsChunksPastTheLimit(t *testing.T) {
+	const limit = 4 << 10
+	chunk := make([]byte, 1<<10)
+
+	tests := []struct {
+		name     string
+		messages []*pb.AnalyzeSkinRequest
+	}{
+		{
+			name: "single image",
+			messages: []*pb.AnalyzeSkinRequest{
+				{RequestPayload: &pb.AnalyzeSkinRequest_Info{Info: &pb.ImageInfo{ImageType: "png"}}},
+			},
+		},
+		{
+			name: "second image of a batch",
+			messages: []*pb.AnalyzeSkinRequest{
+				{RequestPayload: &pb.AnalyzeSkinRequest_Info{Info: &pb.ImageInfo{ImageType: "png", ImageCount: 2}}},
+				{RequestPayload: &pb.AnalyzeSkinRequest_Chunk{Chunk: chunk}},
+				{RequestPayload: &pb.AnalyzeSkinRequest_EndOfFrame{EndOfFrame: true}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, stub := newStubService()
+			client := newTestGRPCClient(t, NewSkinAnalysisServer(svc, nil, PreprocessConfig{}, limit))
+
+			stream, err := client.AnalyzeSkin(context.Background())
+			if err != nil {
+				t.Fatalf("AnalyzeSkin() error = %v", err)
+			}
+			messages := tt.messages
+			for i := 0; i < 2*limit/len(chunk); i++ {
+				messages = append(messages, &pb.AnalyzeSkinRequest{RequestPayload: &pb.AnalyzeSkinRequest_Chunk{Chunk: chunk}})
+			}
+			for _, msg := range messages {
+				// Send reports io.EOF once the server has ended the stream;
+				// its status comes from CloseAndRecv.
+				if err := stream.Send(msg); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("Send() error = %v", err)
+				}
+			}
+
+			_, err = stream.CloseAndRecv()
+			if status.Code(err) != codes.ResourceExhausted {
+				t.Fatalf("CloseAndRecv() error = %v, want ResourceExhausted", err)
+			}
+			if calls := stub.calls.Load(); calls != 0 {
+				t.Errorf("model ran %d times, want 0", calls)
+			}
+		})
+	}
+}
+
+func TestAnalyzeSkinBatchEmitsFailEventPerImage(t *testing.T) {
+	svc, stub := newStubService()
+	events := make(chan event.Event, 8)
+	client := newTestGRPCClient(t, NewSkinAnalysisServer(svc, events, PreprocessConfig{}, 1<<20))
+
+	stream, err := client.AnalyzeSkin(context.Background())
+	if err != nil {
+		t.Fatalf("AnalyzeSkin() error = %v", err)
+	}
+	messages := []*pb.AnalyzeSkinRequest{
+		{RequestPayload: &pb.AnalyzeSkinRequest_Info{Info: &pb.ImageInfo{ImageType: "png", ImageCount: 2, UserId: "user-1"}}},
+		{RequestPayload: &pb.AnalyzeSkinRequest_Chunk{Chunk: encodePNG(t, gradientImage(64, 64))}},
+		{RequestPayload: &pb.AnalyzeSkinRequest_EndOfFrame{EndOfFrame: true}},
+		{RequestPayload: &pb.AnalyzeSkinRequest_Chunk{Chunk: []byte("not an image")}},
+	}
+	for _, msg := range messages {
+		if err := stream.Send(msg); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+	if _, err := stream.CloseAndRecv(); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("CloseAndRecv() error = %v, want InvalidArgument", err)
+	}
+	if calls := stub.calls.Load(); calls != 0 {
+		t.Errorf("model ran %d times, want 0", calls)
+	}
+
+	received := drainEvents(events)
+	assertFailEvents(t, received, 2)
+	for _, ev := range received {
+		if ev.Body.UserID != "user-1" {
+			t.Errorf("event user = %q, want user-1", ev.Body.UserID)
+		}
+	}
+}
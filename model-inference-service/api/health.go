@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// ReadinessCheck reports whether the service can accept traffic. It returns
+// nil when ready, or an error describing the dependency that is not.
+type ReadinessCheck func(ctx context.Context) error
+
+// readinessTimeout bounds how long a single readiness probe may take.
+const readinessTimeout = 2 * time.Second
+
+// HandleHealthz reports that the process is up.
+func HandleHealthz() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"status": "ok",
+		})
+	}
+}
+
+// HandleReadyz reports 200 once ready returns nil and 503 otherwise.
+func HandleReadyz(ready ReadinessCheck) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(c.UserContext(), readinessTimeout)
+		defer cancel()
+
+		if err := ready(ctx); err != nil {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"status": "not ready",
+				"error":  err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status": "ready",
+		})
+	}
+}
+
+// readinessPollInterval is how often the gRPC health status is refreshed.
+const readinessPollInterval = 5 * time.Second
+
+// WatchGRPCHealth keeps the gRPC health status of the overall server and of
+// the given services in sync with ready until ctx is cancelled, at which
+// point every status is switched to NOT_SERVING.
+func WatchGRPCHealth(ctx context.Context, healthServer *health.Server, ready ReadinessCheck, services ...string) {
+	update := func() {
+		checkCtx, cancel := context.WithTimeout(ctx, readinessTimeout)
+		defer cancel()
+
+		status := healthpb.HealthCheckResponse_SERVING
+		if err := ready(checkCtx); err != nil {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+
+		healthServer.SetServingStatus("", status)
+		for _, service := range services {
+			healthServer.SetServingStatus(service, status)
+		}
+	}
+
+	update()
+
+	ticker := time.NewTicker(readinessPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			healthServer.Shutdown()
+			return
+		case <-ticker.C:
+			update()
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Response field naming, selected with RESPONSE_CASE.
+const (
+	ResponseCaseSnake = "snake"
+	ResponseCaseCamel = "camel"
+)
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// CamelCaseJSON marshals v like json.Marshal, but names struct fields in
+// camelCase: the snake_case json tag of each field is converted, so
+// analysis_id becomes analysisId. Map keys, such as class labels and
+// request metadata, are data and kept as they are, as is the output of
+// types implementing json.Marshaler. It is meant as the JSONEncoder of the
+// Fiber app.
+func CamelCaseJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeCamel(&buf, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeCamel(buf *bytes.Buffer, v reflect.Value) error {
+	if !v.IsValid() {
+		buf.WriteString("null")
+		return nil
+	}
+	if marshalsItself(v) {
+		return encodeStd(buf, v.Interface())
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		return encodeCamel(buf, v.Elem())
+	case reflect.Struct:
+		return encodeCamelStruct(buf, v)
+	case reflect.Map:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return encodeStd(buf, v.Interface())
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeStd(buf, key.String()); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := encodeCamel(buf, v.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// Byte slices are base64 strings.
+			return encodeStd(buf, v.Interface())
+		}
+		buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeCamel(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	default:
+		return encodeStd(buf, v.Interface())
+	}
+}
+
+// encodeCamelStruct writes the exported fields of a struct, honouring the
+// json tag options "-" and omitempty. Untagged embedded structs have their
+// fields inlined, as encoding/json does.
+func encodeCamelStruct(buf *bytes.Buffer, v reflect.Value) error {
+	buf.WriteByte('{')
+	first := true
+	var writeFields func(v reflect.Value) error
+	writeFields = func(v reflect.Value) error {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			value := v.Field(i)
+
+			if field.Anonymous && name == "" {
+				for value.Kind() == reflect.Pointer {
+					if value.IsNil() {
+						break
+					}
+					value = value.Elem()
+				}
+				if value.Kind() == reflect.Struct && !marshalsItself(value) {
+					if err := writeFields(value); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+			if !field.IsExported() {
+				continue
+			}
+			if strings.Contains(","+opts+",", ",omitempty,") && isEmptyValue(value) {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			if !first {
+				buf.WriteByte(',')
+			}
+			first = false
+			if err := encodeStd(buf, camelCase(name)); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := encodeCamel(buf, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := writeFields(v); err != nil {
+		return err
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// marshalsItself reports whether v is encoded by its own MarshalJSON or
+// MarshalText method, such as time.Time and uuid.UUID.
+func marshalsItself(v reflect.Value) bool {
+	t := v.Type()
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		return v.Kind() != reflect.Pointer || !v.IsNil()
+	}
+	if v.CanAddr() {
+		pt := reflect.PointerTo(t)
+		return pt.Implements(jsonMarshalerType) || pt.Implements(textMarshalerType)
+	}
+	return false
+}
+
+// isEmptyValue mirrors the omitempty rule of encoding/json.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
+
+func encodeStd(buf *bytes.Buffer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	buf.Write(b)
+	return nil
+}
+
+// camelCase converts a snake_case name, e.g. page_size to pageSize.
+func camelCase(name string) string {
+	parts := strings.Split(name, "_")
+	var b strings.Builder
+	b.WriteString(parts[0])
+	for _, part := range parts[1:] {
+		if part == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"model-inference-service/metrics"
+	"model-inference-service/service"
+	"strings"
+	"time"
+
+	pb "model-inference-service/gen"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+)
+
+// HandleMetrics serves the Prometheus metrics registry.
+func HandleMetrics() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.Handler())
+}
+
+// MetricsMiddleware records the count, failures and latency of the REST
+// requests it wraps. Responses with a status of 400 or above count as failures.
+func MetricsMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if fiberErr, ok := err.(*fiber.Error); ok {
+			status = fiberErr.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+		metrics.ObserveRequest(metrics.TransportREST, time.Since(start), status >= fiber.StatusBadRequest)
+
+		return err
+	}
+}
+
+// MetricsStreamInterceptor records the count, failures and latency of
+// streaming calls to the skin analysis service. Other services, such as
+// health watches, pass through unrecorded.
+func MetricsStreamInterceptor() grpc.StreamServerInterceptor {
+	prefix := "/" + pb.SkinAnalysisService_ServiceDesc.ServiceName + "/"
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !strings.HasPrefix(info.FullMethod, prefix) {
+			return handler(srv, ss)
+		}
+
+		start := time.Now()
+		err := handler(srv, ss)
+		metrics.ObserveRequest(metrics.TransportGRPC, time.Since(start), err != nil)
+		return err
+	}
+}
+
+// MetricsUnaryInterceptor is MetricsStreamInterceptor for unary calls.
+func MetricsUnaryInterceptor() grpc.UnaryServerInterceptor {
+	prefix := "/" + pb.SkinAnalysisService_ServiceDesc.ServiceName + "/"
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !strings.HasPrefix(info.FullMethod, prefix) {
+			return handler(ctx, req)
+		}
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		metrics.ObserveRequest(metrics.TransportGRPC, time.Since(start), err != nil)
+		return resp, err
+	}
+}
+
+// recordAnalysis counts a successful analysis under its top predicted class.
+func recordAnalysis(transport string, analysis *service.Analysis) {
+	if len(analysis.Predictions) == 0 {
+		return
+	}
+	metrics.RecordAnalysis(transport, analysis.Predictions[0].ClassName)
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/binary"
+	"math"
+	"model-inference-service/metrics"
+	"model-inference-service/service"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type PredictRequest struct {
+	// Input is the preprocessed image, flattened in the primary model's
+	// input layout.
+	Input []float32 `json:"input"`
+	TopK  int       `json:"top_k"`
+}
+
+type PredictResponse struct {
+	Results []AnalysisResult `json:"results"`
+	Margin  *float32         `json:"margin"`
+	// NeedsReview and ReviewMessage flag an uncertain top prediction.
+	NeedsReview   bool   `json:"needs_review"`
+	ReviewMessage string `json:"review_message,omitempty"`
+	// ModelName and ModelVersion identify the model that produced the result.
+	ModelName    string `json:"model_name"`
+	ModelVersion string `json:"model_version,omitempty"`
+	// Probabilities is only present when the full distribution was requested.
+	Probabilities map[string]float32 `json:"probabilities,omitempty"`
+}
+
+// decodeFloat32s decodes a body of little-endian float32 values.
+func decodeFloat32s(body []byte) ([]float32, error) {
+	if len(body)%4 != 0 {
+		return nil, &requestError{status: fiber.StatusBadRequest, code: CodeInvalidBody, message: "Binary body length must be a multiple of 4 bytes"}
+	}
+	values := make([]float32, len(body)/4)
+	for i := range values {
+		values[i] = math.Float32frombits(binary.LittleEndian.Uint32(body[i*4:]))
+	}
+	return values, nil
+}
+
+// parsePredictRequest reads the tensor from a JSON body, or from a binary
+// body of little-endian float32 values with top_k as a query parameter.
+// On failure it returns a *requestError.
+func parsePredictRequest(c *fiber.Ctx) (PredictRequest, error) {
+	contentType := strings.ToLower(strings.TrimSpace(strings.Split(string(c.Request().Header.ContentType()), ";")[0]))
+	switch contentType {
+	case fiber.MIMEApplicationJSON:
+		var req PredictRequest
+		if err := c.BodyParser(&req); err != nil {
+			return PredictRequest{}, &requestError{status: fiber.StatusBadRequest, code: CodeInvalidBody, message: "Invalid request body"}
+		}
+		if req.TopK < 0 {
+			return PredictRequest{}, invalidField("top_k", "top_k must be a positive integer")
+		}
+		return req, nil
+	case fiber.MIMEOctetStream:
+		input, err := decodeFloat32s(c.Body())
+		if err != nil {
+			return PredictRequest{}, err
+		}
+		topK, err := parseTopK(c)
+		if err != nil {
+			return PredictRequest{}, err
+		}
+		return PredictRequest{Input: input, TopK: topK}, nil
+	default:
+		return PredictRequest{}, &requestError{
+			status:  fiber.StatusUnsupportedMediaType,
+			code:    CodeUnsupportedMediaType,
+			message: "Content-Type must be application/json or application/octet-stream",
+		}
+	}
+}
+
+// HandlePredict classifies an already preprocessed input tensor with the
+// primary model, skipping image decoding. It is meant for clients doing
+// their own preprocessing and for debugging preprocessing mismatches; no
+// analysis event is recorded. Bodies larger than maxBodyBytes are rejected.
+func HandlePredict(inferenceService *service.InferenceService, maxBodyBytes int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if len(c.Body()) > maxBodyBytes {
+			return sendError(c, fiber.StatusRequestEntityTooLarge, CodeTooLarge, "", "Request body too large")
+		}
+
+		req, err := parsePredictRequest(c)
+		if err != nil {
+			return sendRequestError(c, err)
+		}
+
+		if err := inferenceService.ValidateInput(req.Input); err != nil {
+			return sendError(c, fiber.StatusBadRequest, CodeInvalidField, "input", err.Error())
+		}
+		for _, v := range req.Input {
+			if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+				return sendError(c, fiber.StatusBadRequest, CodeInvalidField, "input", "Input must not contain NaN or infinite values")
+			}
+		}
+
+		start := time.Now()
+		analysis, err := inferenceService.Analyze(c.UserContext(), req.Input, service.AnalyzeOptions{
+			TopK:                 req.TopK,
+			IncludeProbabilities: c.QueryBool("full"),
+		})
+		metrics.ObserveInference(metrics.TransportREST, time.Since(start))
+		if err != nil {
+			return sendRequestError(c, inferenceRequestError(err))
+		}
+		recordAnalysis(metrics.TransportREST, analysis)
+
+		return c.JSON(PredictResponse{
+			Results:       toAnalysisResults(analysis.Predictions),
+			Margin:        analysis.Margin,
+			NeedsReview:   analysis.NeedsReview,
+			ReviewMessage: analysis.ReviewMessage,
+			ModelName:     analysis.Model,
+			ModelVersion:  analysis.ModelVersion,
+			Probabilities: analysis.Probabilities,
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"model-inference-service/model"
+	"model-inference-service/service"
+	"sync/atomic"
+)
+
+// stubPredictor is a service.Predictor with a 4x4 NHWC input returning the
+// raw output of predict for every input, standing in for an ONNX model.
+type stubPredictor struct {
+	predict func(input []float32) ([]float32, error)
+	classes int
+	calls   atomic.Int64
+}
+
+// newStubService returns an InferenceService on one stubPredictor whose
+// raw softmax logits favor the second of three classes.
+func newStubService() (*service.InferenceService, *stubPredictor) {
+	stub := &stubPredictor{
+		classes: 3,
+		predict: func([]float32) ([]float32, error) {
+			return []float32{0, 2, 1}, nil
+		},
+	}
+	classes := []service.ClassInfo{{Label: "acne"}, {Label: "eczema"}, {Label: "psoriasis"}}
+	return service.NewInferenceService([]service.Predictor{stub}, classes, 0), stub
+}
+
+func (m *stubPredictor) PredictRaw(input []float32) ([]float32, error) {
+	m.calls.Add(1)
+	return m.predict(input)
+}
+
+func (m *stubPredictor) PredictBatchRaw(inputs [][]float32) ([][]float32, error) {
+	outputs := make([][]float32, len(inputs))
+	for i, input := range inputs {
+		output, err := m.PredictRaw(input)
+		if err != nil {
+			return nil, err
+		}
+		outputs[i] = output
+	}
+	return outputs, nil
+}
+
+func (m *stubPredictor) Predict(input []float32) ([]float32, error) {
+	output, err := m.PredictRaw(input)
+	if err != nil {
+		return nil, err
+	}
+	return m.GetOutputActivation().Apply(output), nil
+}
+
+func (m *stubPredictor) PredictBatch(inputs [][]float32) ([][]float32, error) {
+	outputs, err := m.PredictBatchRaw(inputs)
+	if err != nil {
+		return nil, err
+	}
+	for i, output := range outputs {
+		outputs[i] = m.GetOutputActivation().Apply(output)
+	}
+	return outputs, nil
+}
+
+func (m *stubPredictor) PredictClass(input []float32) (int, float32, error) {
+	indices, probs, err := m.GetTopKPredictions(input, 1)
+	if err != nil {
+		return -1, 0, err
+	}
+	return indices[0], probs[0], nil
+}
+
+func (m *stubPredictor) GetTopKPredictions(input []float32, k int) ([]int, []float32, error) {
+	probabilities, err := m.Predict(input)
+	if err != nil {
+		return nil, nil, err
+	}
+	indices, probs := model.RankTopK(probabilities, k)
+	return indices, probs, nil
+}
+
+func (m *stubPredictor) GetExpectedInputSize() int             { return 4 * 4 * inputChannels }
+func (m *stubPredictor) GetNumClasses() int                    { return m.classes }
+func (m *stubPredictor) GetLayout() model.Layout               { return model.LayoutNHWC }
+func (m *stubPredictor) GetInputSize() (width, height int)     { return 4, 4 }
+func (m *stubPredictor) GetOutputActivation() model.Activation { return model.ActivationSoftmax }
+func (m *stubPredictor) GetMultiLabelThreshold() float32       { return model.DefaultMultiLabelThreshold }
+func (m *stubPredictor) Close() error                          { return nil }
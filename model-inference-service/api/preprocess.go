@@ -0,0 +1,521 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"model-inference-service/event"
+	"model-inference-service/model"
+	"model-inference-service/service"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Input geometry of the bundled model: 180x180 RGB. The width and height
+// are only used when PreprocessConfig leaves them unset.
+const (
+	defaultInputWidth  = 180
+	defaultInputHeight = 180
+	inputChannels      = 3
+)
+
+// maxImagePixels caps the dimensions of an image before it is decoded.
+// Decoders allocate the full pixel buffer from the dimensions in the header,
+// so without the cap a few dozen bytes can claim a 30000x30000 image and
+// make the server allocate gigabytes. 50 megapixels covers phone cameras.
+const maxImagePixels = 50_000_000
+
+// DefaultMinImageDimension is the smallest width or height accepted when
+// PreprocessConfig.MinDimension is not set. Images below it carry too
+// little detail to classify once scaled up to the model input.
+const DefaultMinImageDimension = 32
+
+// InvalidImageError is an image rejected before decoding because of its
+// size, such as an empty upload or dimensions out of the accepted range.
+// Its message describes the problem for the client.
+type InvalidImageError struct {
+	msg string
+}
+
+func (e *InvalidImageError) Error() string {
+	return e.msg
+}
+
+// supportedFormats lists the image formats PreprocessImage can decode, as
+// reported by image.DecodeConfig.
+var supportedFormats = map[string]bool{
+	"jpeg": true,
+	"png":  true,
+	"webp": true,
+}
+
+// detectImageFormat sniffs the image format from the content bytes and
+// rejects formats the preprocessing pipeline does not support.
+func detectImageFormat(buffer []byte) (string, error) {
+	if len(buffer) == 0 {
+		return "", &InvalidImageError{msg: "image is empty"}
+	}
+	_, format, err := image.DecodeConfig(bytes.NewReader(buffer))
+	if err != nil {
+		return "", fmt.Errorf("failed to detect image format: %w", err)
+	}
+	if !supportedFormats[format] {
+		return format, fmt.Errorf("unsupported image format %q", format)
+	}
+	return format, nil
+}
+
+// ResizeMode selects how an image is fitted to the square model input.
+//
+// Stretching keeps every pixel but distorts non-square photos, which changes
+// the apparent shape of a lesion. Center-cropping keeps proportions but
+// discards the edges of the longer side, so lesions near the border of a
+// photo may be cut off. Padding keeps both proportions and the whole image at
+// the cost of spending input resolution on the fill color. The model was
+// trained on stretched images, so other modes should be checked against a
+// validation set before being enabled.
+type ResizeMode string
+
+const (
+	// ResizeStretch scales the image to the input size, ignoring its aspect ratio.
+	ResizeStretch ResizeMode = "stretch"
+	// ResizeCenterCrop scales the shorter side to the input size and crops the center.
+	ResizeCenterCrop ResizeMode = "center_crop"
+	// ResizePad scales the longer side to the input size and letterboxes the
+	// rest with PreprocessConfig.PadColor.
+	ResizePad ResizeMode = "pad"
+)
+
+// ParseResizeMode validates a resize mode name. An empty name selects ResizeStretch.
+func ParseResizeMode(value string) (ResizeMode, error) {
+	switch mode := ResizeMode(value); mode {
+	case "":
+		return ResizeStretch, nil
+	case ResizeStretch, ResizeCenterCrop, ResizePad:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown resize mode %q (expected %s, %s or %s)", value, ResizeStretch, ResizeCenterCrop, ResizePad)
+	}
+}
+
+// QualityProfile trades analysis latency for accuracy, per request.
+//
+// QualityFast resizes with a bilinear filter and runs one inference on the
+// whole image. QualityAccurate resizes with the sharper Catmull-Rom filter
+// and averages the model output over the whole image and five crops, the
+// center and the four corners, each covering accurateCropScale of the
+// image's sides. Small or off-center lesions are then also seen at a
+// larger scale, at the cost of six inferences instead of one and a resize
+// that is several times slower; see BenchmarkPreprocessImageViews and the
+// -quality flag of the bench subcommand for the difference on a given
+// model and machine.
+type QualityProfile string
+
+const (
+	// QualityFast is a bilinear resize of the whole image, one inference.
+	QualityFast QualityProfile = "fast"
+	// QualityAccurate is a Catmull-Rom resize of the whole image and five
+	// crops, whose outputs are averaged.
+	QualityAccurate QualityProfile = "accurate"
+)
+
+// accurateCropScale is the fraction of the width and height of the image
+// covered by each QualityAccurate crop.
+const accurateCropScale = 0.875
+
+// ParseQualityProfile validates a quality profile name. An empty name
+// selects QualityFast.
+func ParseQualityProfile(value string) (QualityProfile, error) {
+	switch profile := QualityProfile(value); profile {
+	case "":
+		return QualityFast, nil
+	case QualityFast, QualityAccurate:
+		return profile, nil
+	default:
+		return "", fmt.Errorf("unknown quality profile %q (expected %s or %s)", value, QualityFast, QualityAccurate)
+	}
+}
+
+// ViewCount returns the number of inputs PreprocessImageViews produces per
+// image, and so the number of inferences run for it.
+func (q QualityProfile) ViewCount() int {
+	return len(q.viewRects(image.Rect(0, 0, 1, 1)))
+}
+
+// interpolator returns the filter images are resized with.
+func (q QualityProfile) interpolator() draw.Interpolator {
+	if q == QualityAccurate {
+		return draw.CatmullRom
+	}
+	return draw.BiLinear
+}
+
+// filterName names the filter of interpolator.
+func (q QualityProfile) filterName() string {
+	if q == QualityAccurate {
+		return "catmull_rom"
+	}
+	return "bilinear"
+}
+
+// viewRects returns the regions of an image with the given bounds that are
+// each fitted to the model input: the whole image, followed by the crops
+// of QualityAccurate.
+func (q QualityProfile) viewRects(bounds image.Rectangle) []image.Rectangle {
+	views := []image.Rectangle{bounds}
+	if q != QualityAccurate {
+		return views
+	}
+	cropW := max(1, int(float64(bounds.Dx())*accurateCropScale))
+	cropH := max(1, int(float64(bounds.Dy())*accurateCropScale))
+	crop := func(x, y int) image.Rectangle {
+		return image.Rect(x, y, x+cropW, y+cropH)
+	}
+	left, top := bounds.Min.X, bounds.Min.Y
+	right, bottom := bounds.Max.X-cropW, bounds.Max.Y-cropH
+	return append(views,
+		crop((left+right)/2, (top+bottom)/2),
+		crop(left, top),
+		crop(right, top),
+		crop(left, bottom),
+		crop(right, bottom),
+	)
+}
+
+// NormalizationMode selects how 0-255 pixel values are mapped to model input.
+type NormalizationMode string
+
+const (
+	// NormalizeZeroOne scales values to [0, 1].
+	NormalizeZeroOne NormalizationMode = "zero_one"
+	// NormalizeNegOneOne scales values to [-1, 1].
+	NormalizeNegOneOne NormalizationMode = "neg_one_one"
+	// NormalizeImageNet scales values to [0, 1], then subtracts the per-channel
+	// mean and divides by the per-channel standard deviation.
+	NormalizeImageNet NormalizationMode = "imagenet"
+)
+
+// ImageNet channel statistics, in RGB order.
+var (
+	ImageNetMean = [3]float32{0.485, 0.456, 0.406}
+	ImageNetStd  = [3]float32{0.229, 0.224, 0.225}
+)
+
+// ParseNormalizationMode validates a normalization mode name. An empty name
+// selects NormalizeZeroOne.
+func ParseNormalizationMode(value string) (NormalizationMode, error) {
+	switch mode := NormalizationMode(value); mode {
+	case "":
+		return NormalizeZeroOne, nil
+	case NormalizeZeroOne, NormalizeNegOneOne, NormalizeImageNet:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown normalization mode %q (expected %s, %s or %s)", value, NormalizeZeroOne, NormalizeNegOneOne, NormalizeImageNet)
+	}
+}
+
+// Normalization describes the pixel scaling a model was trained with. A
+// mismatch does not fail inference, it silently degrades accuracy, so it
+// must match the training pipeline of the loaded model.
+type Normalization struct {
+	// Mode defaults to NormalizeZeroOne when empty.
+	Mode NormalizationMode
+	// Mean and Std are the per-channel statistics used by NormalizeImageNet.
+	Mean [3]float32
+	Std  [3]float32
+}
+
+// apply maps an 8-bit value of channel c to its normalized input value.
+func (n Normalization) apply(value uint8, c int) float32 {
+	v := float32(value) / 255
+	switch n.Mode {
+	case NormalizeNegOneOne:
+		return v*2 - 1
+	case NormalizeImageNet:
+		return (v - n.Mean[c]) / n.Std[c]
+	default:
+		return v
+	}
+}
+
+// PreprocessConfig controls how uploaded images are turned into model input.
+type PreprocessConfig struct {
+	// Layout is the tensor layout the model expects.
+	Layout model.Layout
+	// Width and Height are the input dimensions of the model, which images
+	// are resized to. Zero uses the 180x180 input of the bundled model.
+	Width  int
+	Height int
+	// ResizeMode is how the image is fitted to the input size. Defaults to
+	// ResizeStretch when empty.
+	ResizeMode ResizeMode
+	// PadColor fills the letterbox bars in ResizePad mode.
+	PadColor color.RGBA
+	// Quality selects the resize filter and the views of the image that are
+	// analyzed, see QualityProfile. Defaults to QualityFast when empty.
+	Quality QualityProfile
+	// Background is the color transparent and translucent pixels are
+	// composited over, since the model takes no alpha channel. Its alpha is
+	// ignored, so the zero value composites over black.
+	Background color.RGBA
+	// Normalization is the pixel scaling applied to the resized image.
+	Normalization Normalization
+	// MinDimension rejects images narrower or shorter than it, in pixels.
+	// Zero accepts any size.
+	MinDimension int
+	// StoreImages makes PreprocessImageWithInfo also re-encode the decoded
+	// image without metadata, see SanitizeImage, so it can be stored with
+	// the chronic record.
+	StoreImages bool
+}
+
+// forModel returns cfg with the input layout and dimensions of the model
+// serving name.
+func (cfg PreprocessConfig) forModel(inferenceService *service.InferenceService, name string) PreprocessConfig {
+	cfg.Layout = inferenceService.ModelInputLayout(name)
+	cfg.Width, cfg.Height = inferenceService.ModelInputSize(name)
+	return cfg
+}
+
+// params returns the effective parameters of cfg for an image analyzed in
+// views views, resolving the defaults of its unset fields.
+func (cfg PreprocessConfig) params(views int) *event.Preprocessing {
+	width, height := cfg.inputSize()
+	params := &event.Preprocessing{
+		Width:         width,
+		Height:        height,
+		Layout:        string(cfg.Layout),
+		ResizeMode:    string(cfg.ResizeMode),
+		Quality:       string(cfg.Quality),
+		Filter:        cfg.Quality.filterName(),
+		Views:         views,
+		Normalization: string(cfg.Normalization.Mode),
+		Background:    hexColor(cfg.Background),
+	}
+	if params.Layout == "" {
+		params.Layout = string(model.LayoutNHWC)
+	}
+	if params.ResizeMode == "" {
+		params.ResizeMode = string(ResizeStretch)
+	}
+	if params.ResizeMode == string(ResizePad) {
+		params.PadColor = hexColor(cfg.PadColor)
+	}
+	if params.Quality == "" {
+		params.Quality = string(QualityFast)
+	}
+	switch cfg.Normalization.Mode {
+	case "":
+		params.Normalization = string(NormalizeZeroOne)
+	case NormalizeImageNet:
+		mean, std := cfg.Normalization.Mean, cfg.Normalization.Std
+		params.Mean, params.Std = &mean, &std
+	}
+	return params
+}
+
+// hexColor formats the RGB channels of c as #rrggbb.
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// inputSize returns the dimensions images are resized to.
+func (cfg PreprocessConfig) inputSize() (width, height int) {
+	width, height = cfg.Width, cfg.Height
+	if width <= 0 || height <= 0 {
+		return defaultInputWidth, defaultInputHeight
+	}
+	return width, height
+}
+
+// DecodedImage describes an image as decoded by PreprocessImageWithInfo.
+type DecodedImage struct {
+	// Width and Height are the pixel dimensions after EXIF rotation and
+	// before resizing.
+	Width  int
+	Height int
+	// Format is the sniffed format: "jpeg", "png" or "webp".
+	Format string
+	// Sanitized is the image re-encoded without metadata. It is only set
+	// when PreprocessConfig.StoreImages is.
+	Sanitized *event.Image
+	// Preprocessing is the effective preprocessing of the returned input.
+	Preprocessing *event.Preprocessing
+}
+
+// PreprocessImage decodes a JPEG, PNG or WebP image, sniffing the format from
+// the content bytes rather than the declared content type. It rotates JPEGs
+// upright according to their EXIF orientation, fits the image to the model
+// input size per cfg.ResizeMode and returns a flattened float32 slice of
+// length width*height*3 with pixel values scaled per cfg.Normalization.
+// Grayscale images are expanded to three equal channels, and images with
+// an alpha channel are flattened over cfg.Background first. The
+// slice is ordered per cfg.Layout: NHWC interleaves the RGB values of each
+// pixel, NCHW stores one full plane per channel.
+func PreprocessImage(buffer []byte, cfg PreprocessConfig) ([]float32, error) {
+	input, _, err := PreprocessImageWithInfo(buffer, cfg)
+	return input, err
+}
+
+// PreprocessImageWithInfo is PreprocessImage that also describes the
+// decoded image. It returns the input of the whole image only, whatever
+// cfg.Quality; see PreprocessImageViews for the crops.
+func PreprocessImageWithInfo(buffer []byte, cfg PreprocessConfig) ([]float32, DecodedImage, error) {
+	img, decoded, err := decodeForInput(buffer, cfg)
+	if err != nil {
+		return nil, DecodedImage{}, err
+	}
+	decoded.Preprocessing = cfg.params(1)
+	return imageInput(img, img.Bounds(), cfg), decoded, nil
+}
+
+// PreprocessImageViews is PreprocessImageWithInfo returning one input per
+// view of cfg.Quality, the whole image first. The model outputs of the
+// views are meant to be averaged, see service.InferenceService.AnalyzeViews.
+func PreprocessImageViews(buffer []byte, cfg PreprocessConfig) ([][]float32, DecodedImage, error) {
+	img, decoded, err := decodeForInput(buffer, cfg)
+	if err != nil {
+		return nil, DecodedImage{}, err
+	}
+	rects := cfg.Quality.viewRects(img.Bounds())
+	inputs := make([][]float32, len(rects))
+	for i, rect := range rects {
+		inputs[i] = imageInput(img, rect, cfg)
+	}
+	decoded.Preprocessing = cfg.params(len(rects))
+	return inputs, decoded, nil
+}
+
+// decodeForInput decodes buffer, sanitizes it when images are stored and
+// flattens its alpha channel.
+func decodeForInput(buffer []byte, cfg PreprocessConfig) (image.Image, DecodedImage, error) {
+	img, format, err := decodeImage(buffer, cfg.MinDimension)
+	if err != nil {
+		return nil, DecodedImage{}, err
+	}
+
+	decoded := DecodedImage{
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+		Format: format,
+	}
+	if cfg.StoreImages {
+		if decoded.Sanitized, err = encodeSanitized(img, format); err != nil {
+			return nil, DecodedImage{}, err
+		}
+	}
+	return flattenAlpha(img, cfg.Background), decoded, nil
+}
+
+// imageInput fits the src region of img to the model input and returns it
+// as a normalized tensor ordered per cfg.Layout.
+func imageInput(img image.Image, src image.Rectangle, cfg PreprocessConfig) []float32 {
+	inputWidth, inputHeight := cfg.inputSize()
+	resized := resizeImage(img, src, inputWidth, inputHeight, cfg)
+
+	plane := inputWidth * inputHeight
+	input := make([]float32, plane*inputChannels)
+	for y := 0; y < inputHeight; y++ {
+		for x := 0; x < inputWidth; x++ {
+			offset := resized.PixOffset(x, y)
+			pixel := resized.Pix[offset : offset+4]
+			for c := 0; c < inputChannels; c++ {
+				value := cfg.Normalization.apply(pixel[c], c)
+				if cfg.Layout == model.LayoutNCHW {
+					input[c*plane+y*inputWidth+x] = value
+				} else {
+					input[(y*inputWidth+x)*inputChannels+c] = value
+				}
+			}
+		}
+	}
+	return input
+}
+
+// decodeImage decodes buffer after checking its dimensions against
+// maxImagePixels and minDimension, and rotates JPEGs upright according to
+// their EXIF orientation.
+func decodeImage(buffer []byte, minDimension int) (image.Image, string, error) {
+	if len(buffer) == 0 {
+		return nil, "", &InvalidImageError{msg: "image is empty"}
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(buffer))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	if pixels := int64(config.Width) * int64(config.Height); pixels > maxImagePixels {
+		return nil, "", &InvalidImageError{msg: fmt.Sprintf("image is %dx%d pixels, more than the %d pixel limit", config.Width, config.Height, maxImagePixels)}
+	}
+	// Rotation swaps the dimensions, which leaves the smaller one unchanged.
+	if min(config.Width, config.Height) < minDimension {
+		return nil, "", &InvalidImageError{msg: fmt.Sprintf("image is %dx%d pixels, below the %d pixel minimum", config.Width, config.Height, minDimension)}
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(buffer))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	// Phone cameras store JPEGs sideways and record the rotation in EXIF.
+	if format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(buffer))
+	}
+	return img, format, nil
+}
+
+// flattenAlpha composites img over background when it has transparent or
+// translucent pixels. Resizing into an RGBA image otherwise keeps
+// premultiplied values, which darkens such pixels towards black. Opaque
+// images are returned as is.
+func flattenAlpha(img image.Image, background color.RGBA) image.Image {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return img
+	}
+	background.A = 255
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+	return flat
+}
+
+// resizeImage fits the src region of img into a width x height RGBA image
+// according to cfg.ResizeMode, with the filter of cfg.Quality.
+func resizeImage(img image.Image, src image.Rectangle, width, height int, cfg PreprocessConfig) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	srcW, srcH := src.Dx(), src.Dy()
+	scaler := cfg.Quality.interpolator()
+
+	switch cfg.ResizeMode {
+	case ResizeCenterCrop:
+		// Crop the source to the target aspect ratio, then scale the crop.
+		cropW, cropH := srcW, srcH
+		if srcW*height > srcH*width {
+			cropW = srcH * width / height
+		} else {
+			cropH = srcW * height / width
+		}
+		x0 := src.Min.X + (srcW-cropW)/2
+		y0 := src.Min.Y + (srcH-cropH)/2
+		scaler.Scale(dst, dst.Bounds(), img, image.Rect(x0, y0, x0+cropW, y0+cropH), draw.Src, nil)
+	case ResizePad:
+		// Scale the source to fit inside the target, centered on the fill color.
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(cfg.PadColor), image.Point{}, draw.Src)
+		fitW, fitH := width, height
+		if srcW*height > srcH*width {
+			fitH = max(1, srcH*width/srcW)
+		} else {
+			fitW = max(1, srcW*height/srcH)
+		}
+		x0 := (width - fitW) / 2
+		y0 := (height - fitH) / 2
+		scaler.Scale(dst, image.Rect(x0, y0, x0+fitW, y0+fitH), img, src, draw.Src, nil)
+	default:
+		scaler.Scale(dst, dst.Bounds(), img, src, draw.Src, nil)
+	}
+
+	return dst
+}
@@ -0,0 +1,410 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"model-inference-service/model"
+	"os"
+	"testing"
+)
+
+// gradientImage returns an opaque RGBA image whose colors vary across
+// both axes, so crops and resizes of it differ.
+func gradientImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 255 / width), G: uint8(y * 255 / height), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(t testing.TB, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t testing.TB, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatalf("jpeg.Encode() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestPreprocessImageViews(t *testing.T) {
+	buffer := encodePNG(t, gradientImage(120, 80))
+
+	tests := []struct {
+		quality   QualityProfile
+		wantViews int
+	}{
+		{"", 1},
+		{QualityFast, 1},
+		{QualityAccurate, 6},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.quality), func(t *testing.T) {
+			cfg := PreprocessConfig{Width: 32, Height: 32, Quality: tt.quality}
+			views, decoded, err := PreprocessImageViews(buffer, cfg)
+			if err != nil {
+				t.Fatalf("PreprocessImageViews() error = %v", err)
+			}
+			if len(views) != tt.wantViews || tt.quality.ViewCount() != tt.wantViews {
+				t.Fatalf("got %d views, ViewCount() = %d, want %d", len(views), tt.quality.ViewCount(), tt.wantViews)
+			}
+			if decoded.Width != 120 || decoded.Height != 80 {
+				t.Errorf("decoded size = %dx%d, want 120x80", decoded.Width, decoded.Height)
+			}
+			for i, view := range views {
+				if len(view) != 32*32*inputChannels {
+					t.Errorf("view %d has %d values, want %d", i, len(view), 32*32*inputChannels)
+				}
+			}
+
+			// The first view is the whole image, as PreprocessImageWithInfo returns it.
+			whole, _, err := PreprocessImageWithInfo(buffer, cfg)
+			if err != nil {
+				t.Fatalf("PreprocessImageWithInfo() error = %v", err)
+			}
+			for i := range whole {
+				if whole[i] != views[0][i] {
+					t.Fatalf("view 0 differs from the whole image at %d", i)
+				}
+			}
+		})
+	}
+}
+
+func TestQualityAccurateCrops(t *testing.T) {
+	bounds := image.Rect(0, 0, 80, 40)
+	rects := QualityAccurate.viewRects(bounds)
+
+	want := []image.Rectangle{
+		bounds,
+		image.Rect(5, 2, 75, 37),
+		image.Rect(0, 0, 70, 35),
+		image.Rect(10, 0, 80, 35),
+		image.Rect(0, 5, 70, 40),
+		image.Rect(10, 5, 80, 40),
+	}
+	if len(rects) != len(want) {
+		t.Fatalf("got %d views, want %d", len(rects), len(want))
+	}
+	for i := range want {
+		if rects[i] != want[i] {
+			t.Errorf("view %d = %v, want %v", i, rects[i], want[i])
+		}
+		if !rects[i].In(bounds) {
+			t.Errorf("view %d = %v is outside %v", i, rects[i], bounds)
+		}
+	}
+}
+
+func TestParseQualityProfile(t *testing.T) {
+	for value, want := range map[string]QualityProfile{"": QualityFast, "fast": QualityFast, "accurate": QualityAccurate} {
+		if got, err := ParseQualityProfile(value); err != nil || got != want {
+			t.Errorf("ParseQualityProfile(%q) = %q, %v; want %q", value, got, err, want)
+		}
+	}
+	if _, err := ParseQualityProfile("best"); err == nil {
+		t.Error("ParseQualityProfile(\"best\") succeeded, want an error")
+	}
+}
+
+func TestPreprocessImageRecordsParameters(t *testing.T) {
+	buffer := encodePNG(t, gradientImage(64, 64))
+
+	tests := []struct {
+		name string
+		cfg  PreprocessConfig
+		want string
+	}{
+		{
+			name: "defaults",
+			cfg:  PreprocessConfig{Background: color.RGBA{R: 255, G: 255, B: 255}},
+			want: `{"width":180,"height":180,"layout":"NHWC","resize_mode":"stretch","quality":"fast","filter":"bilinear","views":1,"normalization":"zero_one","background":"#ffffff"}`,
+		},
+		{
+			name: "pad, imagenet and accurate",
+			cfg: PreprocessConfig{
+				Layout:     model.LayoutNCHW,
+				Width:      32,
+				Height:     48,
+				ResizeMode: ResizePad,
+				PadColor:   color.RGBA{R: 0x10, G: 0x20, B: 0x30, A: 255},
+				Quality:    QualityAccurate,
+				Normalization: Normalization{
+					Mode: NormalizeImageNet,
+					Mean: ImageNetMean,
+					Std:  ImageNetStd,
+				},
+			},
+			want: `{"width":32,"height":48,"layout":"NCHW","resize_mode":"pad","pad_color":"#102030","quality":"accurate","filter":"catmull_rom","views":6,` +
+				`"normalization":"imagenet","mean":[0.485,0.456,0.406],"std":[0.229,0.224,0.225],"background":"#000000"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, decoded, err := PreprocessImageViews(buffer, tt.cfg)
+			if err != nil {
+				t.Fatalf("PreprocessImageViews() error = %v", err)
+			}
+			got, err := json.Marshal(decoded.Preprocessing)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("preprocessing = %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPreprocessImageWebP runs the lossy (VP8) and lossless (VP8L) WebP
+// fixtures, taken from the golang.org/x/image test data, through the whole
+// preprocessing pipeline.
+func TestPreprocessImageWebP(t *testing.T) {
+	tests := []struct {
+		file          string
+		width, height int
+	}{
+		{"testdata/lossy.webp", 150, 100},
+		{"testdata/lossless.webp", 75, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			buffer, err := os.ReadFile(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format, err := detectImageFormat(buffer); err != nil || format != "webp" {
+				t.Fatalf("detectImageFormat() = %q, %v; want webp", format, err)
+			}
+
+			for _, layout := range []model.Layout{model.LayoutNHWC, model.LayoutNCHW} {
+				cfg := PreprocessConfig{Layout: layout, Width: 64, Height: 48, MinDimension: DefaultMinImageDimension}
+				input, decoded, err := PreprocessImageWithInfo(buffer, cfg)
+				if err != nil {
+					t.Fatalf("%s: PreprocessImageWithInfo() error = %v", layout, err)
+				}
+				if decoded.Format != "webp" || decoded.Width != tt.width || decoded.Height != tt.height {
+					t.Errorf("%s: decoded %s %dx%d, want webp %dx%d", layout, decoded.Format, decoded.Width, decoded.Height, tt.width, tt.height)
+				}
+				if len(input) != 64*48*inputChannels {
+					t.Fatalf("%s: input has %d values, want %d", layout, len(input), 64*48*inputChannels)
+				}
+				for i, v := range input {
+					if v < 0 || v > 1 {
+						t.Fatalf("%s: input[%d] = %v, outside [0, 1]", layout, i, v)
+					}
+				}
+			}
+		})
+	}
+}
+
+// pixelAt returns the RGB values of pixel (x, y) of an NHWC input of the
+// given width.
+func pixelAt(input []float32, width, x, y int) [3]float32 {
+	i := (y*width + x) * inputChannels
+	return [3]float32{input[i], input[i+1], input[i+2]}
+}
+
+// closeTo reports whether every channel of got is within one 8-bit step of
+// the color want.
+func closeTo(got [3]float32, want color.RGBA) bool {
+	for c, v := range []uint8{want.R, want.G, want.B} {
+		if d := got[c] - float32(v)/255; d > 1.0/255 || d < -1.0/255 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPreprocessImageFlattensTransparency(t *testing.T) {
+	// testdata/transparent.png is 40x40: the left half is fully transparent
+	// magenta, the right half opaque.
+	buffer, err := os.ReadFile("testdata/transparent.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	background := color.RGBA{R: 0, G: 128, B: 255, A: 255}
+	input, err := PreprocessImage(buffer, PreprocessConfig{Width: 40, Height: 40, Background: background})
+	if err != nil {
+		t.Fatalf("PreprocessImage() error = %v", err)
+	}
+
+	for _, p := range []image.Point{{0, 0}, {10, 20}, {19, 39}} {
+		if got := pixelAt(input, 40, p.X, p.Y); !closeTo(got, background) {
+			t.Errorf("transparent pixel %v = %v, want the background %v", p, got, background)
+		}
+	}
+	opaque := color.RGBA{R: 200, G: 40, B: 10, A: 255}
+	for _, p := range []image.Point{{20, 0}, {30, 20}, {39, 39}} {
+		if got := pixelAt(input, 40, p.X, p.Y); !closeTo(got, opaque) {
+			t.Errorf("opaque pixel %v = %v, want %v", p, got, opaque)
+		}
+	}
+}
+
+func TestPreprocessImagePassesOpaqueGrayscaleThrough(t *testing.T) {
+	// testdata/gray.png is a 40x40 8-bit grayscale image of value 6x+y.
+	buffer, err := os.ReadFile("testdata/gray.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The background only applies to transparent images.
+	cfg := PreprocessConfig{Width: 40, Height: 40, Background: color.RGBA{R: 255, A: 255}}
+	input, err := PreprocessImage(buffer, cfg)
+	if err != nil {
+		t.Fatalf("PreprocessImage() error = %v", err)
+	}
+
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 40; x++ {
+			v := uint8(x*6 + y)
+			if got := pixelAt(input, 40, x, y); !closeTo(got, color.RGBA{R: v, G: v, B: v}) {
+				t.Fatalf("pixel (%d, %d) = %v, want three channels of %d/255", x, y, got, v)
+			}
+		}
+	}
+}
+
+// withPNGSize returns a copy of the PNG buffer declaring width x height in
+// its IHDR chunk, with the chunk CRC fixed up so decoders get past it.
+func withPNGSize(buffer []byte, width, height uint32) []byte {
+	out := bytes.Clone(buffer)
+	// The IHDR chunk follows the 8 byte signature: length, type, data, CRC.
+	ihdr := out[8 : 8+8+13+4]
+	binary.BigEndian.PutUint32(ihdr[8:12], width)
+	binary.BigEndian.PutUint32(ihdr[12:16], height)
+	binary.BigEndian.PutUint32(ihdr[21:25], crc32.ChecksumIEEE(ihdr[4:21]))
+	return out
+}
+
+// withJPEGSize returns a copy of the baseline JPEG buffer declaring
+// width x height in its SOF0 segment.
+func withJPEGSize(buffer []byte, width, height uint16) []byte {
+	out := bytes.Clone(buffer)
+	sof := bytes.Index(out, []byte{0xFF, 0xC0})
+	binary.BigEndian.PutUint16(out[sof+5:], height)
+	binary.BigEndian.PutUint16(out[sof+7:], width)
+	return out
+}
+
+// malformedImages are inputs the decoder must reject without panicking:
+// truncated files of every supported format, broken EXIF data and headers
+// declaring more pixels than maxImagePixels.
+func malformedImages(t testing.TB) map[string][]byte {
+	t.Helper()
+	png := encodePNG(t, gradientImage(16, 16))
+	jpeg := encodeJPEG(t, gradientImage(16, 16))
+	webp, err := os.ReadFile("testdata/lossy.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exif, err := os.ReadFile("testdata/orientation_6.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string][]byte{
+		"empty":                 {},
+		"png signature":         png[:8],
+		"truncated png header":  png[:20],
+		"truncated png":         png[:len(png)/2],
+		"jpeg soi":              jpeg[:2],
+		"truncated jpeg header": jpeg[:30],
+		"truncated jpeg":        jpeg[:len(jpeg)/2],
+		"riff header":           webp[:12],
+		"truncated webp header": webp[:24],
+		"truncated webp":        webp[:len(webp)/2],
+		"truncated exif":        exif[:40],
+		"exif only":             exif[:2+2+2+6+8+2+12+4],
+		"huge png":              withPNGSize(png, 100000, 100000),
+		"huge jpeg":             withJPEGSize(jpeg, 65535, 65535),
+		"wide png":              withPNGSize(png, 1<<31-1, 1),
+	}
+}
+
+func TestPreprocessImageRejectsMalformedImages(t *testing.T) {
+	cfg := PreprocessConfig{Width: 32, Height: 32}
+	for name, buffer := range malformedImages(t) {
+		t.Run(name, func(t *testing.T) {
+			if _, err := PreprocessImage(buffer, cfg); err == nil {
+				t.Fatal("PreprocessImage() succeeded, want an error")
+			}
+		})
+	}
+
+	// The pixel limit rejects huge images from their header, before
+	// allocating them.
+	for _, name := range []string{"huge png", "huge jpeg"} {
+		var invalid *InvalidImageError
+		if _, err := PreprocessImage(malformedImages(t)[name], cfg); !errors.As(err, &invalid) {
+			t.Errorf("%s: PreprocessImage() error = %v, want an InvalidImageError", name, err)
+		}
+	}
+}
+
+// FuzzPreprocessImage feeds arbitrary bytes to the preprocessing pipeline,
+// which sees raw uploads. It must return an error or a well-formed input,
+// never panic.
+func FuzzPreprocessImage(f *testing.F) {
+	for _, buffer := range malformedImages(f) {
+		f.Add(buffer)
+	}
+	f.Add(encodePNG(f, gradientImage(8, 8)))
+	f.Add(encodeJPEG(f, gradientImage(8, 8)))
+	exif, err := os.ReadFile("testdata/orientation_6.jpg")
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(exif)
+	// The same image with its IFD offset, right after the SOI marker, the
+	// APP1 header and the TIFF byte order and magic, pointing past the end.
+	badIFD := bytes.Clone(exif)
+	binary.LittleEndian.PutUint32(badIFD[2+4+6+4:], 0xFFFFFFF0)
+	f.Add(badIFD)
+
+	cfg := PreprocessConfig{Width: 16, Height: 16}
+	f.Fuzz(func(t *testing.T, buffer []byte) {
+		input, err := PreprocessImage(buffer, cfg)
+		if err == nil && len(input) != 16*16*inputChannels {
+			t.Errorf("PreprocessImage() returned %d values, want %d", len(input), 16*16*inputChannels)
+		}
+	})
+}
+
+// BenchmarkPreprocessImageViews compares the preprocessing cost of the
+// quality profiles on a phone-sized photo. The accurate profile also runs
+// ViewCount() inferences instead of one; use the bench subcommand with
+// -quality to measure those on a real model.
+func BenchmarkPreprocessImageViews(b *testing.B) {
+	buffer := encodeJPEG(b, gradientImage(1600, 1200))
+
+	for _, quality := range []QualityProfile{QualityFast, QualityAccurate} {
+		b.Run(string(quality), func(b *testing.B) {
+			cfg := PreprocessConfig{Quality: quality}
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, _, err := PreprocessImageViews(buffer, cfg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+// RateLimitMiddleware allows each client at most perMinute requests in a
+// sliding one-minute window and answers further requests with 429. Clients
+// are identified by their API key once APIKeyMiddleware has validated it,
+// or by IP address otherwise, so unchecked keys cannot open new buckets.
+// Requests to the exempt paths are not counted.
+func RateLimitMiddleware(perMinute int, exempt ...string) fiber.Handler {
+	exemptPaths := make(map[string]bool, len(exempt))
+	for _, path := range exempt {
+		exemptPaths[path] = true
+	}
+
+	return limiter.New(limiter.Config{
+		Max:        perMinute,
+		Expiration: time.Minute,
+		Next: func(c *fiber.Ctx) bool {
+			return exemptPaths[c.Path()]
+		},
+		KeyGenerator: func(c *fiber.Ctx) string {
+			if key, ok := c.Locals(apiKeyLocal).(string); ok {
+				return "key:" + key
+			}
+			return "ip:" + c.IP()
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return sendError(c, fiber.StatusTooManyRequests, CodeRateLimited, "", "Rate limit exceeded")
+		},
+		LimiterMiddleware: limiter.SlidingWindow{},
+	})
+}
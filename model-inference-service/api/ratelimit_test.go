@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRateLimitMiddlewareIgnoresUnvalidatedKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   []string
+		method string
+		path   string
+	}{
+		{"without API keys", nil, fiber.MethodGet, "/version"},
+		// The admin endpoints skip the API key check and only check the
+		// admin key after the limiter.
+		{"admin endpoint", []string{"valid"}, fiber.MethodPost, "/admin/reload"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+			if len(tt.keys) > 0 {
+				app.Use(APIKeyMiddleware(tt.keys, "/admin/reload"))
+			}
+			app.Use(RateLimitMiddleware(2))
+			app.Add(tt.method, tt.path, func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+			var status int
+			for i := range 3 {
+				req := httptest.NewRequest(tt.method, tt.path, nil)
+				req.Header.Set(APIKeyHeader, "random-"+strconv.Itoa(i))
+				resp, err := app.Test(req)
+				if err != nil {
+					t.Fatalf("app.Test() error = %v", err)
+				}
+				status = resp.StatusCode
+			}
+			if status != fiber.StatusTooManyRequests {
+				t.Errorf("third request with a new key got %d, want 429", status)
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddlewareKeysByValidatedKey(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(APIKeyMiddleware([]string{"a", "b"}))
+	app.Use(RateLimitMiddleware(1))
+	app.Get("/version", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	for _, key := range []string{"a", "b"} {
+		req := httptest.NewRequest(fiber.MethodGet, "/version", nil)
+		req.Header.Set(APIKeyHeader, key)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("app.Test() error = %v", err)
+		}
+		if resp.StatusCode != fiber.StatusOK {
+			t.Errorf("first request with key %q got %d, want 200", key, resp.StatusCode)
+		}
+	}
+}
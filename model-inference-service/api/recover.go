@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"model-inference-service/event"
+	"runtime/debug"
+	"strings"
+
+	pb "model-inference-service/gen"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// panicReason is the error recorded in the chronic event of an analysis
+// whose handler panicked. The panic value itself is only logged.
+const panicReason = "internal error"
+
+// RecoverMiddleware answers a REST request whose handler panicked with 500
+// and logs the panic with its stack. A panic in a request under one of
+// analysisPrefixes also emits a fail chronic event, so the failed analysis
+// is audited.
+func RecoverMiddleware(events chan event.Event, analysisPrefixes ...string) fiber.Handler {
+	return func(c *fiber.Ctx) (err error) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			ctx := c.UserContext()
+			logPanic(ctx, c.Path(), v)
+			for _, prefix := range analysisPrefixes {
+				if strings.HasPrefix(c.Path(), prefix) {
+					emitPanicEvent(ctx, events, "", "")
+					break
+				}
+			}
+			err = sendError(c, fiber.StatusInternalServerError, CodeInternal, "", "Internal server error")
+		}()
+		return c.Next()
+	}
+}
+
+// RecoveryStreamInterceptor turns a panic in a streaming gRPC handler into
+// an Internal status error and logs it with its stack. Panics in the skin
+// analysis service also emit a fail chronic event.
+func RecoveryStreamInterceptor(events chan event.Event) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				err = recoverGRPC(ss.Context(), events, info.FullMethod, v)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+// RecoveryUnaryInterceptor is RecoveryStreamInterceptor for unary calls.
+func RecoveryUnaryInterceptor(events chan event.Event) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				resp, err = nil, recoverGRPC(ctx, events, info.FullMethod, v)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+func recoverGRPC(ctx context.Context, events chan event.Event, method string, v any) error {
+	logPanic(ctx, method, v)
+	if strings.HasPrefix(method, "/"+pb.SkinAnalysisService_ServiceDesc.ServiceName+"/") {
+		emitPanicEvent(ctx, events, "", "")
+	}
+	return status.Error(codes.Internal, "internal error")
+}
+
+func logPanic(ctx context.Context, target string, v any) {
+	requestLogger(ctx).Error("panic recovered", "target", target, "panic", v, "stack", string(debug.Stack()))
+}
+
+// emitPanicEvent emits the fail chronic event of an analysis that panicked.
+// A new analysis ID is used when the panic happened before one was
+// assigned.
+func emitPanicEvent(ctx context.Context, events chan event.Event, analysisID, userID string) {
+	if analysisID == "" {
+		analysisID = uuid.New().String()
+	}
+	emitEvent(ctx, events, event.StatusFail, event.Body{
+		AnalysisID: analysisID,
+		UserID:     userID,
+		Error:      panicReason,
+	})
+}
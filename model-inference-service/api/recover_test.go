@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"model-inference-service/event"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// decodeErrorResponse reads the ErrorResponse body of resp.
+func decodeErrorResponse(t *testing.T, resp *http.Response) ErrorResponse {
+	t.Helper()
+	var body ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode the error response: %v", err)
+	}
+	return body
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	events := make(chan event.Event, 4)
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(RecoverMiddleware(events, "/analyze-skin"))
+	panicking := func(*fiber.Ctx) error { panic("handler bug") }
+	app.Get("/analyze-skin", panicking)
+	app.Get("/version", panicking)
+
+	for _, path := range []string{"/analyze-skin", "/version"} {
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, path, nil))
+		if err != nil {
+			t.Fatalf("%s: app.Test() error = %v", path, err)
+		}
+		if resp.StatusCode != fiber.StatusInternalServerError {
+			t.Errorf("%s: status = %d, want 500", path, resp.StatusCode)
+		}
+		if body := decodeErrorResponse(t, resp); body.Code != CodeInternal || strings.Contains(body.Message, "handler bug") {
+			t.Errorf("%s: body = %+v, want code %s without the panic value", path, body, CodeInternal)
+		}
+	}
+
+	// Only the analysis route is audited.
+	received := drainEvents(events)
+	if len(received) != 1 || received[0].Status != event.StatusFail || received[0].Body.Error != panicReason {
+		t.Errorf("events = %+v, want one fail event for the analysis", received)
+	}
+}
+
+func TestHandleFileUploadRecoversModelPanic(t *testing.T) {
+	svc, stub := newStubService()
+	var panicked atomic.Bool
+	stub.predict = func([]float32) ([]float32, error) {
+		if !panicked.Swap(true) {
+			panic("tensor index out of range")
+		}
+		return []float32{0, 2, 1}, nil
+	}
+	events := make(chan event.Event, 4)
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Post("/analyze-skin", HandleFileUpload(svc, events, PreprocessConfig{}, 1<<20, nil))
+	png := encodePNG(t, gradientImage(64, 64))
+
+	resp, err := app.Test(newMultipartRequest(t, "/analyze-skin", "file", png))
+	if err != nil {
+		t.Fatalf("app.Test() error = %v", err)
+	}
+	if resp.StatusCode != fiber.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", resp.StatusCode)
+	}
+	if body := decodeErrorResponse(t, resp); body.Code != CodeInternal {
+		t.Errorf("code = %q, want %s", body.Code, CodeInternal)
+	}
+	received := drainEvents(events)
+	if len(received) != 1 || !strings.Contains(received[0].Body.Error, "model panicked during inference") {
+		t.Errorf("events = %+v, want one fail event recording the panic", received)
+	}
+
+	// The stub is the only instance: the next upload only succeeds if the
+	// panicking call returned it to the pool.
+	resp, err = app.Test(newMultipartRequest(t, "/analyze-skin", "file", png))
+	if err != nil {
+		t.Fatalf("app.Test() error = %v", err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Errorf("status after the panic = %d, want 200", resp.StatusCode)
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDHeader carries the correlation ID of a request. A value sent by
+// the client is propagated; otherwise one is generated. The ID is echoed
+// back in the response header (REST) or header metadata (gRPC).
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDMetadataKey is RequestIDHeader as gRPC metadata, which is lower case.
+const requestIDMetadataKey = "x-request-id"
+
+type requestIDKey struct{}
+
+// withRequestID returns a copy of ctx carrying the request ID.
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the request ID stored in ctx, or "" if there is none.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestLogger returns the default logger annotated with the request ID in ctx.
+func requestLogger(ctx context.Context) *slog.Logger {
+	if id := RequestIDFrom(ctx); id != "" {
+		return slog.Default().With("request_id", id)
+	}
+	return slog.Default()
+}
+
+// RequestIDMiddleware assigns every REST request a correlation ID, stores it
+// in the request's user context and logs the completed request with it:
+// at debug level, or warn level for server errors.
+func RequestIDMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// Fiber reuses request buffers; the ID outlives the handler in events.
+		id := strings.Clone(c.Get(RequestIDHeader))
+		if id == "" {
+			id = uuid.New().String()
+		}
+		c.Set(RequestIDHeader, id)
+		c.SetUserContext(withRequestID(c.UserContext(), id))
+
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if fiberErr, ok := err.(*fiber.Error); ok {
+			status = fiberErr.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+		level := slog.LevelDebug
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelWarn
+		}
+		requestLogger(c.UserContext()).Log(c.UserContext(), level, "request completed",
+			"transport", "rest",
+			"method", c.Method(),
+			"path", c.Path(),
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+
+		return err
+	}
+}
+
+// contextStream overrides the context of a server stream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// RequestIDStreamInterceptor assigns every streaming gRPC call a correlation
+// ID, exposes it through the stream context and logs the completed call:
+// at debug level, or warn level when it failed.
+func RequestIDStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := withRequestID(ss.Context(), incomingRequestID(ss.Context()))
+		if err := ss.SetHeader(metadata.Pairs(requestIDMetadataKey, RequestIDFrom(ctx))); err != nil {
+			return err
+		}
+
+		start := time.Now()
+		err := handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+		logGRPCCall(ctx, info.FullMethod, start, err)
+		return err
+	}
+}
+
+// RequestIDUnaryInterceptor is RequestIDStreamInterceptor for unary calls.
+func RequestIDUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx = withRequestID(ctx, incomingRequestID(ctx))
+		if err := grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadataKey, RequestIDFrom(ctx))); err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logGRPCCall(ctx, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// incomingRequestID returns the request ID sent in the call metadata, or a
+// new one.
+func incomingRequestID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDMetadataKey); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return uuid.New().String()
+}
+
+// logGRPCCall logs a completed gRPC call.
+func logGRPCCall(ctx context.Context, method string, start time.Time, err error) {
+	logger := requestLogger(ctx).With(
+		"transport", "grpc",
+		"method", method,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+	if err != nil {
+		logger.Warn("request failed", "error", err)
+	} else {
+		logger.Debug("request completed")
+	}
+}
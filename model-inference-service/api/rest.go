@@ -1,10 +1,19 @@
 package api
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"math"
+	"mime/multipart"
 	"model-inference-service/event"
+	"model-inference-service/metrics"
 	"model-inference-service/service"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -28,62 +37,543 @@ type FileUploadResponse struct {
 	AnalysisID        string           `json:"analysis_id"`
 	AnalysisTimestamp time.Time        `json:"analysis_timestamp"`
 	Results           []AnalysisResult `json:"results"`
+	// Margin is the probability gap between the top-1 and top-2 predictions.
+	Margin *float32 `json:"margin"`
+	// NeedsReview is set when the top prediction is too uncertain to be
+	// presented on its own; ReviewMessage then advises seeing a professional.
+	NeedsReview   bool   `json:"needs_review"`
+	ReviewMessage string `json:"review_message,omitempty"`
+	// ModelName and ModelVersion identify the model that produced the
+	// result: its name and the SHA-256 digest of its file.
+	ModelName    string `json:"model_name"`
+	ModelVersion string `json:"model_version,omitempty"`
+	// Probabilities maps every class label to its score; only present when
+	// the full distribution was requested.
+	Probabilities map[string]float32 `json:"probabilities,omitempty"`
+	// InputWidth, InputHeight and DetectedFormat describe the image as the
+	// server decoded it, after EXIF rotation and before resizing.
+	InputWidth     int    `json:"input_width,omitempty"`
+	InputHeight    int    `json:"input_height,omitempty"`
+	DetectedFormat string `json:"detected_format,omitempty"`
+	// Cached is set when an identical earlier upload was answered from the
+	// analysis cache.
+	Cached bool `json:"cached,omitempty"`
 }
 
-func HandleFileUpload(inferenceService *service.InferenceService, event chan event.Event) fiber.Handler {
+// imageAnalysis is the analysis of one image together with what was decoded.
+type imageAnalysis struct {
+	*service.Analysis
+	Image DecodedImage
+	// Cached is set when the analysis was served from the AnalysisCache.
+	Cached bool
+}
+
+// newFileUploadResponse builds the response of one analyzed image.
+func newFileUploadResponse(analysisID string, analysis *service.Analysis, decoded DecodedImage) FileUploadResponse {
+	return FileUploadResponse{
+		AnalysisID:        analysisID,
+		AnalysisTimestamp: time.Now(),
+		Results:           toAnalysisResults(analysis.Predictions),
+		Margin:            analysis.Margin,
+		NeedsReview:       analysis.NeedsReview,
+		ReviewMessage:     analysis.ReviewMessage,
+		ModelName:         analysis.Model,
+		ModelVersion:      analysis.ModelVersion,
+		Probabilities:     analysis.Probabilities,
+		InputWidth:        decoded.Width,
+		InputHeight:       decoded.Height,
+		DetectedFormat:    decoded.Format,
+	}
+}
+
+func toAnalysisResults(predictions []service.PredictionResult) []AnalysisResult {
+	results := make([]AnalysisResult, len(predictions))
+	for i, p := range predictions {
+		results[i] = AnalysisResult{
+			Label:          p.ClassName,
+			Confidence:     p.Confidence,
+			Description:    p.Description,
+			Recommendation: p.Recommendation,
+		}
+	}
+	return results
+}
+
+// parseTopK reads the top_k form field, or query parameter for requests
+// without one. It returns 0, selecting the service default, when neither
+// is set.
+func parseTopK(c *fiber.Ctx) (int, error) {
+	value := c.FormValue("top_k")
+	if value == "" {
+		value = c.Query("top_k")
+	}
+	if value == "" {
+		return 0, nil
+	}
+	k, err := strconv.Atoi(value)
+	if err != nil || k < 1 {
+		return 0, invalidField("top_k", "top_k must be a positive integer")
+	}
+	return k, nil
+}
+
+// parseQuality reads the quality form field, or query parameter for
+// requests without one, falling back to def when neither is set.
+func parseQuality(c *fiber.Ctx, def QualityProfile) (QualityProfile, error) {
+	value := c.FormValue("quality")
+	if value == "" {
+		value = c.Query("quality")
+	}
+	return qualityOrDefault(value, def, "quality")
+}
+
+// qualityOrDefault parses the quality profile value of field, returning def
+// when it is empty.
+func qualityOrDefault(value string, def QualityProfile, field string) (QualityProfile, error) {
+	if value == "" {
+		return def, nil
+	}
+	quality, err := ParseQualityProfile(value)
+	if err != nil {
+		return "", invalidField(field, fmt.Sprintf("%s must be %s or %s", field, QualityFast, QualityAccurate))
+	}
+	return quality, nil
+}
+
+// parseMinConfidence parses the optional min_confidence form field.
+func parseMinConfidence(value string) (float32, error) {
+	if value == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseFloat(value, 32)
+	if err != nil || v < 0 || v > 1 {
+		return 0, invalidField("min_confidence", "min_confidence must be a number between 0 and 1")
+	}
+	return float32(v), nil
+}
+
+// allowedContentTypes lists the declared upload types accepted before decoding.
+var allowedContentTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+}
+
+// validateFormFile rejects uploads under field that are larger than
+// maxBytes (413) or whose declared Content-Type is not an allowed image
+// type (415). It runs before any buffer is allocated for the file.
+func validateFormFile(file *multipart.FileHeader, field string, maxBytes int64) error {
+	if err := checkFileSize(file, field, maxBytes); err != nil {
+		return err
+	}
+	if err := checkContentType(file, field); err != nil {
+		return err
+	}
+	return nil
+}
+
+func checkFileSize(file *multipart.FileHeader, field string, maxBytes int64) error {
+	if file.Size > maxBytes {
+		return fileTooLarge(file, field, maxBytes)
+	}
+	return nil
+}
+
+func fileTooLarge(file *multipart.FileHeader, field string, maxBytes int64) *requestError {
+	return &requestError{
+		status:  fiber.StatusRequestEntityTooLarge,
+		code:    CodeTooLarge,
+		field:   field,
+		message: fmt.Sprintf("File %q exceeds the %d byte upload limit", file.Filename, maxBytes),
+	}
+}
+
+func checkContentType(file *multipart.FileHeader, field string) error {
+	contentType := strings.ToLower(strings.TrimSpace(strings.Split(file.Header.Get("Content-Type"), ";")[0]))
+	if !allowedContentTypes[contentType] {
+		return &requestError{
+			status:  fiber.StatusUnsupportedMediaType,
+			code:    CodeUnsupportedMediaType,
+			field:   field,
+			message: fmt.Sprintf("File %q has unsupported content type %q", file.Filename, contentType),
+		}
+	}
+	return nil
+}
+
+// readFormFile reads the full content of an uploaded multipart file. The
+// read is capped at maxBytes rather than trusting the size declared by the
+// client, and content shorter than that size is rejected as truncated. On
+// failure it returns a *requestError naming field.
+func readFormFile(file *multipart.FileHeader, field string, maxBytes int64) ([]byte, error) {
+	fileContent, err := file.Open()
+	if err != nil {
+		return nil, &requestError{status: fiber.StatusInternalServerError, code: CodeInternal, message: "Failed to open file", cause: err}
+	}
+	defer fileContent.Close()
+
+	invalid := func(message string) *requestError {
+		return &requestError{status: fiber.StatusBadRequest, code: CodeInvalidImage, field: field, message: message}
+	}
+	buffer, err := io.ReadAll(io.LimitReader(fileContent, maxBytes+1))
+	if err != nil {
+		return nil, invalid(fmt.Sprintf("Failed to read file %q", file.Filename))
+	}
+	if int64(len(buffer)) > maxBytes {
+		return nil, fileTooLarge(file, field, maxBytes)
+	}
+	if len(buffer) == 0 {
+		return nil, invalid(fmt.Sprintf("File %q is empty", file.Filename))
+	}
+	if int64(len(buffer)) != file.Size {
+		return nil, invalid(fmt.Sprintf("File %q is truncated: expected %d bytes, got %d", file.Filename, file.Size, len(buffer)))
+	}
+
+	return buffer, nil
+}
+
+// formFile returns the upload under field, or a 400 if there is none.
+func formFile(c *fiber.Ctx, field string) (*multipart.FileHeader, error) {
+	file, err := c.FormFile(field)
+	if err != nil {
+		return nil, &requestError{status: fiber.StatusBadRequest, code: CodeMissingField, field: field, message: "Failed to get file", cause: err}
+	}
+	return file, nil
+}
+
+// decodeError is the client-facing error of a preprocessing error for the
+// image in field, naming the file of a batch upload. Size problems are
+// spelled out since the client can fix them.
+func decodeError(err error, field, filename string) *requestError {
+	name := ""
+	if filename != "" {
+		name = fmt.Sprintf(" %q", filename)
+	}
+	message := "Failed to decode image" + name
+	var invalid *InvalidImageError
+	if errors.As(err, &invalid) {
+		message = fmt.Sprintf("Invalid image%s: %v", name, invalid)
+	}
+	return &requestError{status: fiber.StatusBadRequest, code: CodeInvalidImage, field: field, message: message, cause: err}
+}
+
+// analyzeImage preprocesses and classifies an image buffer with the model
+// selected by opts.Model and the views of preprocess.Quality, or returns
+// the cached analysis of an identical buffer. On failure it returns a
+// *requestError about the image in field.
+func analyzeImage(ctx context.Context, inferenceService *service.InferenceService, preprocess PreprocessConfig, cache *AnalysisCache, buffer []byte, field string, opts service.AnalyzeOptions) (*imageAnalysis, error) {
+	cacheKey := analysisCacheKey(inferenceService, buffer, opts, preprocess.Quality)
+	if cached, ok := cache.get(cacheKey); ok {
+		recordAnalysis(metrics.TransportREST, cached.Analysis)
+		sanitizeCached(cached, buffer, preprocess)
+		return cached, nil
+	}
+
+	preprocess = preprocess.forModel(inferenceService, opts.Model)
+	views, decoded, err := preprocessImageViews(ctx, buffer, preprocess)
+	if err != nil {
+		return nil, decodeError(err, field, "")
+	}
+
+	start := time.Now()
+	analysis, err := analyzeViews(ctx, inferenceService, views, opts)
+	metrics.ObserveInference(metrics.TransportREST, time.Since(start))
+	if err != nil {
+		return nil, inferenceRequestError(err)
+	}
+
+	recordAnalysis(metrics.TransportREST, analysis)
+	result := &imageAnalysis{Analysis: analysis, Image: decoded}
+	cache.put(cacheKey, result)
+	return result, nil
+}
+
+// analyzeViews runs inference on the views of one image, averaging their
+// outputs when there are several.
+func analyzeViews(ctx context.Context, inferenceService *service.InferenceService, views [][]float32, opts service.AnalyzeOptions) (*service.Analysis, error) {
+	if len(views) == 1 {
+		return inferenceService.Analyze(ctx, views[0], opts)
+	}
+	return inferenceService.AnalyzeViews(ctx, views, opts)
+}
+
+func HandleFileUpload(inferenceService *service.InferenceService, events chan event.Event, preprocess PreprocessConfig, maxUploadBytes int64, cache *AnalysisCache) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		file, err := c.FormFile("file")
+		file, err := formFile(c, "file")
 		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Failed to get file",
-			})
+			return sendRequestError(c, err)
+		}
+
+		if err := validateFormFile(file, "file", maxUploadBytes); err != nil {
+			return sendRequestError(c, err)
 		}
 
 		metadata := make(map[string]string)
 		if metadataStr := c.FormValue("metadata"); metadataStr != "" {
 			if err := json.Unmarshal([]byte(metadataStr), &metadata); err != nil {
-				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-					"error": "Invalid metadata format",
-				})
+				return sendError(c, fiber.StatusBadRequest, CodeInvalidField, "metadata", "Invalid metadata format")
 			}
 		}
 
-		_ = FileUploadRequest{
-			UserID:    c.FormValue("user_id"),
-			ImageType: file.Header.Get("Content-Type"),
+		request := FileUploadRequest{
+			UserID:    strings.Clone(c.FormValue("user_id")),
+			ImageType: c.FormValue("image_type"),
 			Metadata:  metadata,
 		}
 
-		fileContent, err := file.Open()
+		buffer, err := readFormFile(file, "file", maxUploadBytes)
+		if err != nil {
+			return sendRequestError(c, err)
+		}
+
+		minConfidence, err := parseMinConfidence(c.FormValue("min_confidence"))
+		if err != nil {
+			return sendRequestError(c, err)
+		}
+
+		topK, err := parseTopK(c)
+		if err != nil {
+			return sendRequestError(c, err)
+		}
+
+		preprocess := preprocess
+		if preprocess.Quality, err = parseQuality(c, preprocess.Quality); err != nil {
+			return sendRequestError(c, err)
+		}
+
+		analysisID := uuid.New().String()
+
+		analysis, err := analyzeImage(c.UserContext(), inferenceService, preprocess, cache, buffer, "file", service.AnalyzeOptions{
+			TopK:                 topK,
+			MinConfidence:        minConfidence,
+			IncludeProbabilities: c.QueryBool("full"),
+			Model:                request.ImageType,
+		})
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to open file",
+			emitEvent(c.UserContext(), events, event.StatusFail, event.Body{
+				AnalysisID: analysisID,
+				UserID:     request.UserID,
+				Error:      failureReason(err),
 			})
+			return sendRequestError(c, err)
 		}
-		defer fileContent.Close()
 
-		buffer := make([]byte, file.Size)
-		if _, err := io.ReadFull(fileContent, buffer); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to read file",
+		response := newFileUploadResponse(analysisID, analysis.Analysis, analysis.Image)
+		response.Cached = analysis.Cached
+
+		emitAnalysisEvent(c.UserContext(), events, event.Body{
+			AnalysisID:   analysisID,
+			UserID:       request.UserID,
+			Predictions:  analysis.Predictions,
+			Margin:       analysis.Margin,
+			NeedsReview:  analysis.NeedsReview,
+			ModelName:    analysis.Model,
+			ModelVersion: analysis.ModelVersion,
+			Cached:       analysis.Cached,
+		}, analysis.Image)
+
+		return c.JSON(response)
+	}
+}
+
+type Base64UploadRequest struct {
+	Image         string  `json:"image"`
+	UserID        string  `json:"user_id"`
+	TopK          int     `json:"top_k"`
+	MinConfidence float32 `json:"min_confidence"`
+	// ImageType selects the model, see service.InferenceService.ResolveModel.
+	ImageType string `json:"image_type"`
+	// Quality selects the QualityProfile; empty uses the server default.
+	Quality string `json:"quality"`
+}
+
+// HandleBase64Upload analyzes an image sent as a base64 string in a JSON
+// body instead of multipart form data. Bodies larger than maxBodyBytes are
+// rejected before decoding.
+func HandleBase64Upload(inferenceService *service.InferenceService, events chan event.Event, preprocess PreprocessConfig, maxBodyBytes int, cache *AnalysisCache) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if len(c.Body()) > maxBodyBytes {
+			return sendError(c, fiber.StatusRequestEntityTooLarge, CodeTooLarge, "", "Request body too large")
+		}
+
+		var req Base64UploadRequest
+		if err := c.BodyParser(&req); err != nil {
+			return sendError(c, fiber.StatusBadRequest, CodeInvalidBody, "", "Invalid request body")
+		}
+		if req.Image == "" {
+			return sendError(c, fiber.StatusBadRequest, CodeMissingField, "image", "Missing image")
+		}
+
+		buffer, err := base64.StdEncoding.DecodeString(req.Image)
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, CodeInvalidField, "image", "Invalid base64 image")
+		}
+
+		if len(buffer) == 0 {
+			return sendError(c, fiber.StatusBadRequest, CodeInvalidImage, "image", "Image is empty")
+		}
+		if _, err := detectImageFormat(buffer); err != nil {
+			return sendError(c, fiber.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "image", "Unsupported image format")
+		}
+
+		if req.MinConfidence < 0 || req.MinConfidence > 1 {
+			return sendError(c, fiber.StatusBadRequest, CodeInvalidField, "min_confidence", "min_confidence must be between 0 and 1")
+		}
+
+		preprocess := preprocess
+		if preprocess.Quality, err = qualityOrDefault(req.Quality, preprocess.Quality, "quality"); err != nil {
+			return sendRequestError(c, err)
+		}
+
+		analysisID := uuid.New().String()
+
+		analysis, err := analyzeImage(c.UserContext(), inferenceService, preprocess, cache, buffer, "image", service.AnalyzeOptions{
+			TopK:          max(req.TopK, 0),
+			MinConfidence: req.MinConfidence,
+			Model:         req.ImageType,
+		})
+		if err != nil {
+			emitEvent(c.UserContext(), events, event.StatusFail, event.Body{
+				AnalysisID: analysisID,
+				UserID:     req.UserID,
+				Error:      failureReason(err),
 			})
+			return sendRequestError(c, err)
+		}
+
+		response := newFileUploadResponse(analysisID, analysis.Analysis, analysis.Image)
+		response.Cached = analysis.Cached
+
+		emitAnalysisEvent(c.UserContext(), events, event.Body{
+			AnalysisID:   analysisID,
+			UserID:       req.UserID,
+			Predictions:  analysis.Predictions,
+			Margin:       analysis.Margin,
+			NeedsReview:  analysis.NeedsReview,
+			ModelName:    analysis.Model,
+			ModelVersion: analysis.ModelVersion,
+			Cached:       analysis.Cached,
+		}, analysis.Image)
+
+		return c.JSON(response)
+	}
+}
+
+// maxBatchFiles caps how many images one batch request may carry.
+const maxBatchFiles = 16
+
+// multipartOverheadBytes allows for the part headers and form fields sent
+// next to the files of a multipart upload.
+const multipartOverheadBytes = 1 << 20
+
+// MaxRequestBodyBytes is the largest body a valid request outside the batch
+// endpoint can have: one upload of maxUploadBytes, or a base64 body of
+// maxBase64BodyBytes. It is meant as the Fiber BodyLimit and the default
+// limit of BodyLimitMiddleware; the handlers still check each file against
+// maxUploadBytes.
+func MaxRequestBodyBytes(maxUploadBytes int64, maxBase64BodyBytes int) int {
+	limit := max(maxUploadBytes+multipartOverheadBytes, int64(maxBase64BodyBytes))
+	return int(min(limit, math.MaxInt))
+}
+
+// MaxBatchBodyBytes is the largest body a valid batch request can have:
+// maxBatchFiles uploads of maxUploadBytes each. It is the limit of the
+// batch endpoint in BodyLimitMiddleware.
+func MaxBatchBodyBytes(maxUploadBytes int64) int {
+	limit := maxUploadBytes*maxBatchFiles + multipartOverheadBytes
+	return int(min(limit, math.MaxInt))
+}
+
+type BatchUploadResponse struct {
+	Analyses []FileUploadResponse `json:"analyses"`
+}
+
+// HandleBatchUpload analyzes every image sent under the "files" form key in
+// a single model call, which also carries the crops of every image under
+// the accurate quality profile. A file that cannot be decoded fails the
+// whole batch.
+func HandleBatchUpload(inferenceService *service.InferenceService, events chan event.Event, preprocess PreprocessConfig, maxUploadBytes int64) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		form, err := c.MultipartForm()
+		if err != nil {
+			return sendError(c, fiber.StatusBadRequest, CodeInvalidBody, "", "Failed to parse multipart form")
 		}
 
-		// TODO: Preprocess image buffer ke float32 array
-		// preprocessedInput := preprocessImage(buffer)
+		files := form.File["files"]
+		if len(files) == 0 {
+			return sendError(c, fiber.StatusBadRequest, CodeMissingField, "files", "Failed to get files")
+		}
+		if len(files) > maxBatchFiles {
+			return sendError(c, fiber.StatusBadRequest, CodeTooManyFiles, "files", fmt.Sprintf("Too many files, at most %d allowed", maxBatchFiles))
+		}
 
-		// Sekarang bisa gunakan inferenceService yang di-capture dari closure!
-		// predictions, err := inferenceService.Infer(preprocessedInput)
-		// if err != nil {
-		//     return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-		//         "error": "Inference failed",
-		//     })
-		// }
+		minConfidence, err := parseMinConfidence(c.FormValue("min_confidence"))
+		if err != nil {
+			return sendRequestError(c, err)
+		}
+
+		topK, err := parseTopK(c)
+		if err != nil {
+			return sendRequestError(c, err)
+		}
+
+		userID := strings.Clone(c.FormValue("user_id"))
+		modelName := c.FormValue("image_type")
+		preprocess := preprocess.forModel(inferenceService, modelName)
+		if preprocess.Quality, err = parseQuality(c, preprocess.Quality); err != nil {
+			return sendRequestError(c, err)
+		}
+
+		for _, file := range files {
+			if err := validateFormFile(file, "files", maxUploadBytes); err != nil {
+				return sendRequestError(c, err)
+			}
+		}
+
+		images := make([][][]float32, len(files))
+		decoded := make([]DecodedImage, len(files))
+		for i, file := range files {
+			buffer, err := readFormFile(file, "files", maxUploadBytes)
+			if err == nil {
+				images[i], decoded[i], err = preprocessImageViews(c.UserContext(), buffer, preprocess)
+				if err != nil {
+					err = decodeError(err, "files", file.Filename)
+				}
+			}
+			if err != nil {
+				emitBatchFailure(c.UserContext(), events, userID, len(files), err)
+				return sendRequestError(c, err)
+			}
+		}
 
-		response := FileUploadResponse{
-			AnalysisID:        uuid.New().String(),
-			AnalysisTimestamp: time.Now(),
-			Results:           []AnalysisResult{},
+		start := time.Now()
+		analyses, err := inferenceService.AnalyzeBatchViews(c.UserContext(), images, service.AnalyzeOptions{
+			TopK:          topK,
+			MinConfidence: minConfidence,
+			Model:         modelName,
+		})
+		metrics.ObserveInference(metrics.TransportREST, time.Since(start))
+		if err != nil {
+			err = inferenceRequestError(err)
+			emitBatchFailure(c.UserContext(), events, userID, len(files), err)
+			return sendRequestError(c, err)
+		}
+
+		response := BatchUploadResponse{
+			Analyses: make([]FileUploadResponse, len(analyses)),
+		}
+		for i, analysis := range analyses {
+			recordAnalysis(metrics.TransportREST, analysis)
+			response.Analyses[i] = newFileUploadResponse(uuid.New().String(), analysis, decoded[i])
+			emitAnalysisEvent(c.UserContext(), events, event.Body{
+				AnalysisID:   response.Analyses[i].AnalysisID,
+				UserID:       userID,
+				Predictions:  analysis.Predictions,
+				Margin:       analysis.Margin,
+				NeedsReview:  analysis.NeedsReview,
+				ModelName:    analysis.Model,
+				ModelVersion: analysis.ModelVersion,
+			}, decoded[i])
 		}
 
 		return c.JSON(response)
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"model-inference-service/event"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newMultipartRequest returns a POST to target uploading each of files as
+// an image/png part of field.
+func newMultipartRequest(t *testing.T, target, field string, files ...[]byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for i, file := range files {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename="image%d.png"`, field, i))
+		header.Set("Content-Type", "image/png")
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(file)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(fiber.MethodPost, target, &body)
+	req.Header.Set(fiber.HeaderContentType, writer.FormDataContentType())
+	return req
+}
+
+// drainEvents returns the events buffered in events.
+func drainEvents(events chan event.Event) []event.Event {
+	var received []event.Event
+	for {
+		select {
+		case ev := <-events:
+			received = append(received, ev)
+		default:
+			return received
+		}
+	}
+}
+
+func TestHandleBatchUploadEmitsFailEventPerFile(t *testing.T) {
+	svc, stub := newStubService()
+	events := make(chan event.Event, 8)
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Post("/analyze-skin/batch", HandleBatchUpload(svc, events, PreprocessConfig{}, 1<<20))
+
+	png := encodePNG(t, gradientImage(64, 64))
+	req := newMultipartRequest(t, "/analyze-skin/batch", "files", png, []byte("not an image"), png)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test() error = %v", err)
+	}
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", resp.StatusCode)
+	}
+	if calls := stub.calls.Load(); calls != 0 {
+		t.Errorf("model ran %d times, want 0", calls)
+	}
+
+	assertFailEvents(t, drainEvents(events), 3)
+}
+
+// assertFailEvents checks that received holds one fail event with a reason
+// for each of n batch items, each under its own analysis ID.
+func assertFailEvents(t *testing.T, received []event.Event, n int) {
+	t.Helper()
+	if len(received) != n {
+		t.Fatalf("got %d events, want %d", len(received), n)
+	}
+	ids := make(map[string]bool)
+	for _, ev := range received {
+		if ev.Status != event.StatusFail || ev.Body.Error == "" {
+			t.Errorf("event = %s %q, want a fail event with a reason", ev.Status, ev.Body.Error)
+		}
+		ids[ev.Body.AnalysisID] = true
+	}
+	if len(ids) != n {
+		t.Errorf("events share analysis IDs: %v", ids)
+	}
+}
+
+func TestHandleFileUploadRejectsUnusableImages(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        []byte
+		wantMessage string
+	}{
+		{"empty file", []byte{}, "is empty"},
+		{"1x1 png", encodePNG(t, gradientImage(1, 1)), "below the 32 pixel minimum"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, stub := newStubService()
+			events := make(chan event.Event, 4)
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+			app.Post("/analyze-skin", HandleFileUpload(svc, events, PreprocessConfig{MinDimension: DefaultMinImageDimension}, 1<<20, nil))
+
+			resp, err := app.Test(newMultipartRequest(t, "/analyze-skin", "file", tt.file))
+			if err != nil {
+				t.Fatalf("app.Test() error = %v", err)
+			}
+			if resp.StatusCode != fiber.StatusBadRequest {
+				t.Errorf("status = %d, want 400", resp.StatusCode)
+			}
+			body := decodeErrorResponse(t, resp)
+			if body.Code != CodeInvalidImage || body.Field != "file" || !strings.Contains(body.Message, tt.wantMessage) {
+				t.Errorf("body = %+v, want %s on file mentioning %q", body, CodeInvalidImage, tt.wantMessage)
+			}
+			if calls := stub.calls.Load(); calls != 0 {
+				t.Errorf("model ran %d times, want 0", calls)
+			}
+		})
+	}
+}
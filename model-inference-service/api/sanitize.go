@@ -0,0 +1,58 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log/slog"
+	"model-inference-service/event"
+)
+
+// sanitizedJPEGQuality is the quality JPEG uploads are re-encoded at.
+const sanitizedJPEGQuality = 90
+
+// SanitizeImage decodes an upload and re-encodes its pixels, so the result
+// carries none of the metadata of the original: EXIF (including GPS
+// position and camera serial numbers), XMP, comments or text chunks. JPEGs
+// are rotated upright first, as their orientation is lost with the EXIF.
+func SanitizeImage(buffer []byte) (*event.Image, error) {
+	img, format, err := decodeImage(buffer, 0)
+	if err != nil {
+		return nil, err
+	}
+	return encodeSanitized(img, format)
+}
+
+// encodeSanitized encodes a decoded image: JPEGs as JPEG, PNG and WebP
+// images as PNG, since the standard library has no WebP encoder.
+func encodeSanitized(img image.Image, format string) (*event.Image, error) {
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: sanitizedJPEGQuality}); err != nil {
+			return nil, fmt.Errorf("failed to re-encode image: %w", err)
+		}
+		return &event.Image{ContentType: "image/jpeg", Data: buf.Bytes()}, nil
+	}
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to re-encode image: %w", err)
+	}
+	return &event.Image{ContentType: "image/png", Data: buf.Bytes()}, nil
+}
+
+// sanitizeCached sets the sanitized copy of buffer on an analysis served
+// from the cache, which does not keep them, when image storage is enabled.
+// The upload decoded when the analysis was cached, so a failure here is
+// only logged and the record is stored without its image.
+func sanitizeCached(analysis *imageAnalysis, buffer []byte, preprocess PreprocessConfig) {
+	if !preprocess.StoreImages {
+		return
+	}
+	sanitized, err := SanitizeImage(buffer)
+	if err != nil {
+		slog.Warn("failed to sanitize cached upload", "error", err)
+		return
+	}
+	analysis.Image.Sanitized = sanitized
+}
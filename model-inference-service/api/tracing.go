@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"model-inference-service/tracing"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fiberCarrier reads propagation headers from a Fiber request.
+type fiberCarrier struct {
+	c *fiber.Ctx
+}
+
+func (f fiberCarrier) Get(key string) string {
+	return f.c.Get(key)
+}
+
+func (f fiberCarrier) Set(key, value string) {
+	f.c.Request().Header.Set(key, value)
+}
+
+func (f fiberCarrier) Keys() []string {
+	var keys []string
+	f.c.Request().Header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
+
+// TracingMiddleware starts the root span of every REST request, continuing
+// the trace of an incoming traceparent header, and stores it in the user
+// context so handlers start their spans under it.
+func TracingMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), fiberCarrier{c: c})
+		ctx, span := tracing.Tracer().Start(ctx, c.Method(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Method()),
+				semconv.URLPath(strings.Clone(c.Path())),
+			),
+		)
+		defer span.End()
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if fiberErr, ok := err.(*fiber.Error); ok {
+			status = fiberErr.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+		route := strings.Clone(c.Route().Path)
+		span.SetName(c.Method() + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route), semconv.HTTPResponseStatusCode(status))
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, "")
+		}
+
+		return err
+	}
+}
+
+// metadataCarrier reads propagation headers from gRPC metadata.
+type metadataCarrier metadata.MD
+
+func (m metadataCarrier) Get(key string) string {
+	if values := metadata.MD(m).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (m metadataCarrier) Set(key, value string) {
+	metadata.MD(m).Set(key, value)
+}
+
+func (m metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// TracingStreamInterceptor starts the root span of every streaming gRPC
+// call, continuing the trace of incoming traceparent metadata.
+func TracingStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := startGRPCSpan(ss.Context(), info.FullMethod)
+		defer span.End()
+
+		err := handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+		endGRPCSpan(span, err)
+		return err
+	}
+}
+
+// TracingUnaryInterceptor is TracingStreamInterceptor for unary calls.
+func TracingUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, span := startGRPCSpan(ctx, info.FullMethod)
+		defer span.End()
+
+		resp, err := handler(ctx, req)
+		endGRPCSpan(span, err)
+		return resp, err
+	}
+}
+
+// startGRPCSpan starts the server span of a gRPC call.
+func startGRPCSpan(ctx context.Context, fullMethod string) (context.Context, trace.Span) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+	}
+
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	return tracing.Tracer().Start(ctx, fullMethod,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(semconv.RPCSystemGRPC, semconv.RPCService(service), semconv.RPCMethod(method)),
+	)
+}
+
+// endGRPCSpan records the status of a gRPC call on its span.
+func endGRPCSpan(span trace.Span, err error) {
+	code := status.Code(err)
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(code)))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, code.String())
+	}
+}
+
+// preprocessImage runs PreprocessImageWithInfo in a child span of ctx.
+func preprocessImage(ctx context.Context, buffer []byte, cfg PreprocessConfig) ([]float32, DecodedImage, error) {
+	_, span := tracing.Tracer().Start(ctx, "PreprocessImage")
+	defer span.End()
+
+	input, decoded, err := PreprocessImageWithInfo(buffer, cfg)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to decode image")
+	}
+	return input, decoded, err
+}
+
+// preprocessImageViews runs PreprocessImageViews in a child span of ctx.
+func preprocessImageViews(ctx context.Context, buffer []byte, cfg PreprocessConfig) ([][]float32, DecodedImage, error) {
+	_, span := tracing.Tracer().Start(ctx, "PreprocessImage")
+	defer span.End()
+	span.SetAttributes(attribute.String("preprocess.quality", string(cfg.Quality)))
+
+	inputs, decoded, err := PreprocessImageViews(buffer, cfg)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to decode image")
+	}
+	return inputs, decoded, err
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"errors"
+	"model-inference-service/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ValidateResponse struct {
+	// Valid reports whether /analyze-skin would accept the image.
+	Valid bool `json:"valid"`
+	// Reasons lists every check the image failed.
+	Reasons        []string `json:"reasons,omitempty"`
+	DetectedFormat string   `json:"detected_format,omitempty"`
+	InputWidth     int      `json:"input_width,omitempty"`
+	InputHeight    int      `json:"input_height,omitempty"`
+}
+
+// HandleValidateUpload runs the upload checks, decoding and preprocessing
+// of /analyze-skin on the "file" form field without running inference or
+// recording an analysis, so clients can check an image before sending it
+// for analysis. A rejected image is reported with valid set to false.
+func HandleValidateUpload(inferenceService *service.InferenceService, preprocess PreprocessConfig, maxUploadBytes int64) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		file, err := formFile(c, "file")
+		if err != nil {
+			return sendRequestError(c, err)
+		}
+
+		var response ValidateResponse
+		if err := checkContentType(file, "file"); err != nil {
+			response.Reasons = append(response.Reasons, err.Error())
+		}
+		if err := checkFileSize(file, "file", maxUploadBytes); err != nil {
+			response.Reasons = append(response.Reasons, err.Error())
+			return c.JSON(response)
+		}
+
+		buffer, err := readFormFile(file, "file", maxUploadBytes)
+		var reqErr *requestError
+		if errors.As(err, &reqErr) && reqErr.status == fiber.StatusInternalServerError {
+			return sendRequestError(c, err)
+		}
+		if err != nil {
+			response.Reasons = append(response.Reasons, err.Error())
+			return c.JSON(response)
+		}
+
+		if format, err := detectImageFormat(buffer); err != nil {
+			response.DetectedFormat = format
+			response.Reasons = append(response.Reasons, err.Error())
+			return c.JSON(response)
+		}
+
+		preprocess := preprocess.forModel(inferenceService, c.FormValue("image_type"))
+		preprocess.StoreImages = false
+		_, decoded, err := preprocessImage(c.UserContext(), buffer, preprocess)
+		if err != nil {
+			response.Reasons = append(response.Reasons, err.Error())
+			return c.JSON(response)
+		}
+
+		response.Valid = len(response.Reasons) == 0
+		response.DetectedFormat = decoded.Format
+		response.InputWidth = decoded.Width
+		response.InputHeight = decoded.Height
+		return c.JSON(response)
+	}
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"model-inference-service/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type VersionResponse struct {
+	// Version is the build version of the service.
+	Version string              `json:"version"`
+	Models  []service.ModelInfo `json:"models"`
+}
+
+// HandleVersion reports the service build version and, for every served
+// model, its file, SHA-256 digest and class labels.
+func HandleVersion(buildVersion string, inferenceService *service.InferenceService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(VersionResponse{
+			Version: buildVersion,
+			Models:  inferenceService.ModelInfos(),
+		})
+	}
+}
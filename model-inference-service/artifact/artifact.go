@@ -0,0 +1,239 @@
+// Package artifact reads deployment artifacts, such as models and class
+// dictionaries, from local paths, http(s) URLs or s3:// and gs:// object
+// storage URIs.
+package artifact
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// remoteSchemes are the URL schemes fetched by Fetcher.
+var remoteSchemes = []string{"http://", "https://", "s3://", "gs://"}
+
+// IsRemote reports whether location is a URL Fetcher downloads rather than
+// a local path.
+func IsRemote(location string) bool {
+	for _, scheme := range remoteSchemes {
+		if strings.HasPrefix(location, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fetcher downloads remote artifacts. s3:// URIs are fetched from S3 (or
+// an S3-compatible endpoint) and gs:// URIs from the Cloud Storage JSON
+// API's download endpoint, both over HTTPS.
+type Fetcher struct {
+	// CacheDir holds the artifacts downloaded by Fetch. It is created on
+	// first use.
+	CacheDir string
+	// Timeout bounds each download; 0 leaves it bounded by the context only.
+	Timeout time.Duration
+	// Client performs the requests; nil uses http.DefaultClient.
+	Client *http.Client
+	// S3 locates and signs s3:// requests.
+	S3 S3Config
+	// GCSToken is an OAuth 2.0 access token sent with gs:// requests; empty
+	// only works for public objects.
+	GCSToken string
+}
+
+// ReadFile returns the content of a local file or of a remote artifact.
+func (f *Fetcher) ReadFile(ctx context.Context, location string) ([]byte, error) {
+	if !IsRemote(location) {
+		return os.ReadFile(location)
+	}
+
+	cached, err := f.Fetch(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(cached)
+}
+
+// Fetch downloads the artifact at rawURL into the cache and returns the
+// path of the cached file. When the download fails and an earlier copy is
+// cached, that copy is returned instead, so a restart does not depend on
+// the source being reachable.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (string, error) {
+	cached, err := f.cachePath(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	fetchErr := f.downloadTo(ctx, rawURL, cached)
+	if fetchErr == nil {
+		return cached, nil
+	}
+	if _, err := os.Stat(cached); err == nil {
+		slog.Warn("failed to fetch artifact, using cached copy", "url", redact(rawURL), "path", cached, "error", fetchErr)
+		return cached, nil
+	}
+	return "", fetchErr
+}
+
+// Download fetches the artifact at rawURL into a new file in dir,
+// bypassing the cache, and returns its path. The caller owns the file.
+func (f *Fetcher) Download(ctx context.Context, rawURL, dir string) (string, error) {
+	return f.download(ctx, rawURL, dir, "artifact-*"+path.Ext(strings.SplitN(rawURL, "?", 2)[0]))
+}
+
+// downloadTo downloads next to dest and renames the file into place, so a
+// failed download never replaces a good copy.
+func (f *Fetcher) downloadTo(ctx context.Context, rawURL, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return fmt.Errorf("failed to create artifact cache: %w", err)
+	}
+	tmp, err := f.download(ctx, rawURL, filepath.Dir(dest), filepath.Base(dest)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write artifact cache file: %w", err)
+	}
+	return nil
+}
+
+// download writes the artifact to a new temporary file in dir named after
+// pattern. The file is removed unless the whole body, with the size given
+// by the server, was written.
+func (f *Fetcher) download(ctx context.Context, rawURL, dir, pattern string) (string, error) {
+	if f.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.Timeout)
+		defer cancel()
+	}
+
+	req, err := f.newRequest(ctx, rawURL)
+	if err != nil {
+		return "", err
+	}
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// The *url.Error message repeats the full URL.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return "", fmt.Errorf("failed to fetch %s: %w", redact(rawURL), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch %s: %s", redact(rawURL), resp.Status)
+	}
+
+	tmp, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create artifact file: %w", err)
+	}
+	written, err := io.Copy(tmp, resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	switch {
+	case err != nil:
+		err = fmt.Errorf("failed to download %s: %w", redact(rawURL), err)
+	case resp.ContentLength >= 0 && written != resp.ContentLength:
+		err = fmt.Errorf("failed to download %s: got %d bytes, expected %d", redact(rawURL), written, resp.ContentLength)
+	case written == 0:
+		err = fmt.Errorf("failed to download %s: artifact is empty", redact(rawURL))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// newRequest builds the GET request of a remote artifact, translating
+// object storage URIs to their HTTPS endpoints.
+func (f *Fetcher) newRequest(ctx context.Context, rawURL string) (*http.Request, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid artifact URL %s: %w", redact(rawURL), err)
+	}
+
+	bucket, object := u.Host, strings.TrimPrefix(u.Path, "/")
+	authorize := func(*http.Request) {}
+	switch u.Scheme {
+	case "http", "https":
+	case "s3":
+		if bucket == "" || object == "" {
+			return nil, fmt.Errorf("invalid artifact URL %s: expected s3://bucket/key", rawURL)
+		}
+		if u, err = f.S3.s3URL(bucket, object); err != nil {
+			return nil, err
+		}
+		authorize = func(req *http.Request) { f.S3.sign(req, time.Now()) }
+	case "gs":
+		if bucket == "" || object == "" {
+			return nil, fmt.Errorf("invalid artifact URL %s: expected gs://bucket/object", rawURL)
+		}
+		u = &url.URL{
+			Scheme:   "https",
+			Host:     "storage.googleapis.com",
+			Path:     "/storage/v1/b/" + bucket + "/o/" + object,
+			RawPath:  "/storage/v1/b/" + url.PathEscape(bucket) + "/o/" + url.PathEscape(object),
+			RawQuery: "alt=media",
+		}
+		if f.GCSToken != "" {
+			authorize = func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+f.GCSToken) }
+		}
+	default:
+		return nil, fmt.Errorf("invalid artifact URL %s: unsupported scheme %q", redact(rawURL), u.Scheme)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid artifact URL %s: %w", redact(rawURL), err)
+	}
+	authorize(req)
+	return req, nil
+}
+
+// cachePath names the cached copy of rawURL after a digest of the URL,
+// keeping the file name of the URL path for readability. The query string
+// is left out, so a pre-signed URL keeps its cached copy when re-signed.
+func (f *Fetcher) cachePath(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid artifact URL: %w", err)
+	}
+	digest := sha256.Sum256([]byte(redact(rawURL)))
+	name := hex.EncodeToString(digest[:8])
+	if base := path.Base(u.Path); base != "." && base != "/" {
+		name += "-" + base
+	}
+	return filepath.Join(f.CacheDir, name), nil
+}
+
+// redact drops the query string and credentials of a URL before it is
+// logged, since pre-signed URLs carry their signature there.
+func redact(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "<invalid URL>"
+	}
+	u.User = nil
+	u.RawQuery = ""
+	return u.String()
+}
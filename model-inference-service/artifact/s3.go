@@ -0,0 +1,133 @@
+package artifact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Config locates and authenticates s3:// artifacts. Requests are sent
+// unsigned when no access key is set, which only works for public objects.
+type S3Config struct {
+	// Region defaults to us-east-1.
+	Region string
+	// Endpoint overrides the AWS endpoint for S3-compatible stores such as
+	// MinIO, e.g. http://minio:9000. Objects are then addressed path-style.
+	Endpoint        string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+func (c S3Config) region() string {
+	if c.Region == "" {
+		return "us-east-1"
+	}
+	return c.Region
+}
+
+// s3URL returns the HTTPS URL of an object: virtual-hosted on AWS,
+// path-style on a custom endpoint.
+func (c S3Config) s3URL(bucket, key string) (*url.URL, error) {
+	if c.Endpoint == "" {
+		return &url.URL{
+			Scheme:  "https",
+			Host:    fmt.Sprintf("%s.s3.%s.amazonaws.com", bucket, c.region()),
+			Path:    "/" + key,
+			RawPath: "/" + s3Escape(key),
+		}, nil
+	}
+
+	endpoint, err := url.Parse(c.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", c.Endpoint)
+	}
+	base := strings.TrimSuffix(endpoint.Path, "/")
+	return &url.URL{
+		Scheme:  endpoint.Scheme,
+		Host:    endpoint.Host,
+		Path:    base + "/" + bucket + "/" + key,
+		RawPath: base + "/" + s3Escape(bucket) + "/" + s3Escape(key),
+	}, nil
+}
+
+// sign adds AWS Signature Version 4 headers to a GET request without a
+// body, see https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html.
+func (c S3Config) sign(req *http.Request, now time.Time) {
+	if c.AccessKeyID == "" {
+		return
+	}
+
+	const payloadHash = "UNSIGNED-PAYLOAD"
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	req.Header.Set("X-Amz-Date", amzDate)
+	headers := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	values := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+		headers = append(headers, "x-amz-security-token")
+		values["x-amz-security-token"] = c.SessionToken
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, h := range headers {
+		canonicalHeaders.WriteString(h + ":" + values[h] + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + c.region() + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), date)
+	key = hmacSHA256(key, c.region())
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Escape URI-encodes an object key as SigV4 requires: every byte except
+// unreserved characters and the path separator is percent-encoded.
+func s3Escape(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		ch := key[i]
+		if ch >= 'A' && ch <= 'Z' || ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' ||
+			ch == '-' || ch == '.' || ch == '_' || ch == '~' || ch == '/' {
+			b.WriteByte(ch)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", ch)
+	}
+	return b.String()
+}
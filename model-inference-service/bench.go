@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"model-inference-service/api"
+	"model-inference-service/service"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BenchLatency holds latency statistics in milliseconds.
+type BenchLatency struct {
+	Mean float64 `json:"mean_ms"`
+	P50  float64 `json:"p50_ms"`
+	P95  float64 `json:"p95_ms"`
+	P99  float64 `json:"p99_ms"`
+	Max  float64 `json:"max_ms"`
+}
+
+// BenchResult is the JSON report printed by the bench subcommand.
+type BenchResult struct {
+	Model       string `json:"model"`
+	Image       string `json:"image,omitempty"`
+	Quality     string `json:"quality"`
+	PoolSize    int    `json:"pool_size"`
+	Concurrency int    `json:"concurrency"`
+	Requests    int    `json:"requests"`
+	Errors      int    `json:"errors"`
+	// DurationSeconds is the wall-clock time of the whole run.
+	DurationSeconds float64 `json:"duration_seconds"`
+	// Throughput is the number of successful inferences per second.
+	Throughput float64      `json:"throughput_per_second"`
+	Latency    BenchLatency `json:"latency"`
+}
+
+// runBench implements the "bench" subcommand: it runs -n inferences across
+// -concurrency workers on the same pooled InferenceService the server uses
+// and prints latency percentiles and throughput as JSON to stdout. The input
+// is the preprocessed -image, or a zeroed tensor when no image is given;
+// decoding and preprocessing are done once and not measured. -quality
+// selects the views analyzed per image, so running it with fast and then
+// accurate shows the inference cost of the accurate profile.
+func runBench(args []string) error {
+	// Keep stdout for the JSON result.
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: &logLevel})))
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	logLevel.Set(config.LogLevel)
+
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	modelPath := flags.String("model", config.ModelPath, "path to the .onnx model file")
+	classesPath := flags.String("classes", config.ClassDictPath, "path to the class dictionary JSON file")
+	imagePath := flags.String("image", "", "optional sample image; a zeroed tensor is used when empty")
+	qualityName := flags.String("quality", string(config.Preprocess.Quality), "quality profile: fast or accurate")
+	requests := flags.Int("n", 200, "number of inferences to run")
+	concurrency := flags.Int("concurrency", config.PoolSize, "number of concurrent workers")
+	poolSize := flags.Int("pool-size", config.PoolSize, "number of model instances in the session pool")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if *requests < 1 || *concurrency < 1 || *poolSize < 1 {
+		return fmt.Errorf("bench: -n, -concurrency and -pool-size must be positive")
+	}
+	config.PoolSize = *poolSize
+	quality, err := api.ParseQualityProfile(*qualityName)
+	if err != nil {
+		return fmt.Errorf("bench: %v", err)
+	}
+	config.Preprocess.Quality = quality
+
+	classDict, err := loadClassDictionary(context.Background(), *classesPath, &config.Artifacts)
+	if err != nil {
+		return err
+	}
+
+	// The pinned digest only applies to the configured model file.
+	var expectedSHA256 string
+	if *modelPath == config.ModelPath {
+		expectedSHA256 = config.Models[config.PrimaryModel].SHA256
+	}
+	path, err := fetchModelFile(context.Background(), *modelPath, config)
+	if err != nil {
+		return err
+	}
+	defer removeDownloadedModels()
+
+	models, err := loadModelPool(service.DefaultModel, path, expectedSHA256, config)
+	if err != nil {
+		return err
+	}
+	set := service.ModelSet{Path: path, Predictors: toPredictors(models), ClassDict: classDict}
+	inferenceService, err := service.NewMultiModelInferenceService(
+		map[string]service.ModelSet{service.DefaultModel: set}, service.DefaultModel, config.InferenceTimeout)
+	if err != nil {
+		for _, m := range models {
+			m.Close()
+		}
+		return fmt.Errorf("model %s: %v", *modelPath, err)
+	}
+	defer inferenceService.Close()
+
+	views := make([][]float32, quality.ViewCount())
+	for i := range views {
+		views[i] = make([]float32, models[0].GetExpectedInputSize())
+	}
+	if *imagePath != "" {
+		buffer, err := os.ReadFile(*imagePath)
+		if err != nil {
+			return fmt.Errorf("failed to read image: %v", err)
+		}
+		config.Preprocess.Layout = inferenceService.InputLayout()
+		config.Preprocess.Width, config.Preprocess.Height = inferenceService.InputSize()
+		views, _, err = api.PreprocessImageViews(buffer, config.Preprocess)
+		if err != nil {
+			return err
+		}
+	}
+
+	latencies := make([]time.Duration, *requests)
+	var next, failures atomic.Int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	for range *concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= *requests {
+					return
+				}
+				callStart := time.Now()
+				_, err := inferenceService.AnalyzeViews(context.Background(), views, service.AnalyzeOptions{})
+				latencies[i] = time.Since(callStart)
+				if err != nil {
+					failures.Add(1)
+					slog.Warn("bench inference failed", "error", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	errorCount := int(failures.Load())
+	if errorCount == *requests {
+		return fmt.Errorf("bench: all %d inferences failed", *requests)
+	}
+
+	result := BenchResult{
+		Model:           *modelPath,
+		Image:           *imagePath,
+		Quality:         string(quality),
+		PoolSize:        *poolSize,
+		Concurrency:     *concurrency,
+		Requests:        *requests,
+		Errors:          errorCount,
+		DurationSeconds: elapsed.Seconds(),
+		Throughput:      float64(*requests-errorCount) / elapsed.Seconds(),
+		Latency:         latencyStats(latencies),
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
+
+// latencyStats computes the mean, nearest-rank percentiles and maximum of
+// a non-empty set of latencies. It sorts latencies in place.
+func latencyStats(latencies []time.Duration) BenchLatency {
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+	percentile := func(p float64) float64 {
+		rank := int(math.Ceil(p*float64(len(latencies)))) - 1
+		return milliseconds(latencies[max(rank, 0)])
+	}
+
+	return BenchLatency{
+		Mean: milliseconds(total / time.Duration(len(latencies))),
+		P50:  percentile(0.50),
+		P95:  percentile(0.95),
+		P99:  percentile(0.99),
+		Max:  milliseconds(latencies[len(latencies)-1]),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"model-inference-service/api"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigInferenceQueueDepth(t *testing.T) {
+	tests := []struct {
+		name      string
+		depth     string
+		wantDepth int
+		wantErr   bool
+	}{
+		{name: "defaults to the concurrency cap", depth: "", wantDepth: 3},
+		{name: "no queue", depth: "0", wantDepth: 0},
+		{name: "explicit depth", depth: "10", wantDepth: 10},
+		{name: "disabled", depth: "-1", wantDepth: -1},
+		{name: "below -1", depth: "-2", wantErr: true},
+		{name: "not a number", depth: "many", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAX_CONCURRENT_INFERENCES", "3")
+			t.Setenv("INFERENCE_QUEUE_DEPTH", tt.depth)
+
+			cfg, err := loadConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("loadConfig() succeeded with INFERENCE_QUEUE_DEPTH=%q, want an error", tt.depth)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadConfig() error = %v", err)
+			}
+			if cfg.InferenceQueueDepth != tt.wantDepth {
+				t.Errorf("InferenceQueueDepth = %d, want %d", cfg.InferenceQueueDepth, tt.wantDepth)
+			}
+		})
+	}
+}
+
+func TestValidateRequiresDatabaseOnlyForDBSink(t *testing.T) {
+	dir := t.TempDir()
+	modelPath := filepath.Join(dir, "model.onnx")
+	classDictPath := filepath.Join(dir, "classes.json")
+	for _, path := range []string{modelPath, classDictPath} {
+		if err := os.WriteFile(path, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		sink    string
+		wantErr bool
+	}{
+		{eventSinkDB, true},
+		{eventSinkStdout, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sink, func(t *testing.T) {
+			cfg := &Config{
+				EventSink:     tt.sink,
+				ModelPath:     modelPath,
+				ClassDictPath: classDictPath,
+				DBConfig:      DBConfig{SSLRootCert: filepath.Join(dir, "missing.pem")},
+			}
+
+			err := cfg.Validate()
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Validate() succeeded without the DB_* settings")
+			}
+			for _, want := range []string{"DB_HOST is not set", "DB_PASSWORD is not set", "DB_SSLROOTCERT"} {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() error = %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizationSettingsParseFallsBackToDefaults(t *testing.T) {
+	settings := NormalizationSettings{Mode: "zscore", Mean: "0.1,0.2,0.3", Std: "0,1,1"}
+
+	normalization, problems := settings.parse()
+	if len(problems) != 2 {
+		t.Errorf("parse() reported %d problems, want 2: %v", len(problems), problems)
+	}
+	if normalization.Mode != api.NormalizeZeroOne {
+		t.Errorf("Mode = %q, want the %q default", normalization.Mode, api.NormalizeZeroOne)
+	}
+	if normalization.Mean != [3]float32{0.1, 0.2, 0.3} {
+		t.Errorf("Mean = %v, want the valid override", normalization.Mean)
+	}
+	if normalization.Std != api.ImageNetStd {
+		t.Errorf("Std = %v, want the ImageNet default", normalization.Std)
+	}
+}
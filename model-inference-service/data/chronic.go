@@ -2,17 +2,110 @@ package data
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"model-inference-service/event"
+	"model-inference-service/tracing"
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrNotFound is returned when no record matches the requested ID.
+var ErrNotFound = errors.New("record not found")
+
+// Chronic is the audit record of one analysis. Body holds an event.Body
+// serialized as JSON. Error repeats the body's error message of a failed
+// analysis in its own column, so failures can be queried directly.
+//
+// UserID repeats the body's user ID so a user's history can be looked up
+// by index.
+//
+// Records are soft-deleted: Delete sets DeletedAt and the regular queries
+// skip such rows. The deleted_at, error and user_id columns and their
+// indexes are added by AutoMigrate; with SKIP_AUTOMIGRATE, apply
+//
+//	ALTER TABLE chronics ADD COLUMN deleted_at timestamptz;
+//	CREATE INDEX idx_chronics_deleted_at ON chronics (deleted_at);
+//	ALTER TABLE chronics ADD COLUMN error text NOT NULL DEFAULT '';
+//	ALTER TABLE chronics ADD COLUMN user_id varchar(255) NOT NULL DEFAULT '';
+//	CREATE INDEX idx_chronics_user_id ON chronics (user_id);
+//
+// Records stored before the user_id column existed can be backfilled with
+//
+//	UPDATE chronics SET user_id = body->>'user_id'
+//	    WHERE user_id = '' AND body->>'user_id' IS NOT NULL;
+//
+// AutoMigrate does not update an existing check constraint, so databases
+// created before the pending status existed need
+//
+//	ALTER TABLE chronics DROP CONSTRAINT chk_chronics_status;
+//	ALTER TABLE chronics ADD CONSTRAINT chk_chronics_status
+//	    CHECK (status IN ('success','fail','pending'));
 type Chronic struct {
-	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	Body      string    `gorm:"type:json" json:"body"`
-	Status    string    `gorm:"type:varchar(10);check:status IN ('success','fail')" json:"status"`
-	CreatedAt time.Time `gorm:"type:timestamp;not null" json:"created_at"`
+	ID        uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Body      string         `gorm:"type:json" json:"body"`
+	Status    string         `gorm:"type:varchar(10);check:status IN ('success','fail','pending')" json:"status"`
+	CreatedAt time.Time      `gorm:"type:timestamp;not null" json:"created_at"`
+	Error     string         `gorm:"type:text;not null;default:''" json:"error,omitempty"`
+	UserID    string         `gorm:"type:varchar(255);not null;default:'';index" json:"user_id,omitempty"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+}
+
+// ParseBody unmarshals Body into the structured analysis result.
+func (c *Chronic) ParseBody() (event.Body, error) {
+	var body event.Body
+	if err := json.Unmarshal([]byte(c.Body), &body); err != nil {
+		return event.Body{}, fmt.Errorf("failed to parse chronic body: %w", err)
+	}
+	return body, nil
+}
+
+// Pagination selects one page of results. Page is 1-based.
+type Pagination struct {
+	Page     int
+	PageSize int
+}
+
+// Offset returns the number of rows to skip for the page.
+func (p Pagination) Offset() int {
+	if p.Page < 1 {
+		return 0
+	}
+	return (p.Page - 1) * p.PageSize
+}
+
+// ChronicFilter narrows the records returned by FindAll. Zero values match everything.
+type ChronicFilter struct {
+	Status string
+	UserID string
+	// From and To bound the creation time of the records: From is
+	// inclusive, To exclusive.
+	From time.Time
+	To   time.Time
+}
+
+// apply adds the conditions of the filter to query.
+func (f ChronicFilter) apply(query *gorm.DB) *gorm.DB {
+	if f.Status != "" {
+		query = query.Where("status = ?", f.Status)
+	}
+	if f.UserID != "" {
+		query = query.Where("user_id = ?", f.UserID)
+	}
+	if !f.From.IsZero() {
+		query = query.Where("created_at >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		query = query.Where("created_at < ?", f.To)
+	}
+	return query
 }
 
 type ChronicRepository struct {
@@ -26,5 +119,210 @@ func NewChronicRepository(db *gorm.DB) *ChronicRepository {
 }
 
 func (r *ChronicRepository) Create(ctx context.Context, chronic *Chronic) error {
-	return r.db.WithContext(ctx).Create(chronic).Error
+	ctx, span := startSpan(ctx, "ChronicRepository.Create")
+	defer span.End()
+	return endSpan(span, r.db.WithContext(ctx).Create(chronic).Error)
+}
+
+// Save inserts the record, or, if a record with the same ID exists,
+// replaces its body, status and error. This lets a pending record be completed
+// while keeping its original creation time.
+func (r *ChronicRepository) Save(ctx context.Context, chronic *Chronic) error {
+	ctx, span := startSpan(ctx, "ChronicRepository.Save")
+	defer span.End()
+	return endSpan(span, r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"body", "status", "error"}),
+	}).Create(chronic).Error)
+}
+
+// NewChronic builds the record of ev, stored under its analysis ID or, if
+// that is not a UUID, under a new one.
+func NewChronic(ev event.Event) (*Chronic, error) {
+	id, err := uuid.Parse(ev.Body.AnalysisID)
+	if err != nil {
+		id = uuid.New()
+	}
+	body, err := json.Marshal(ev.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize chronic body: %w", err)
+	}
+	return &Chronic{
+		ID:        id,
+		Body:      string(body),
+		Status:    ev.Status,
+		Error:     ev.Body.Error,
+		UserID:    ev.Body.UserID,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// Store saves ev as a chronic record with Save, then its image, if any,
+// with SaveImage, making the repository an event.Sink. Both steps can be
+// repeated, so a failed Store may be retried.
+func (r *ChronicRepository) Store(ctx context.Context, ev event.Event) error {
+	chronic, err := NewChronic(ev)
+	if err != nil {
+		return err
+	}
+	if err := r.Save(ctx, chronic); err != nil {
+		return err
+	}
+	if ev.Image == nil {
+		return nil
+	}
+	image := &ChronicImage{
+		ID:          chronic.ID,
+		ContentType: ev.Image.ContentType,
+		Data:        ev.Image.Data,
+		CreatedAt:   chronic.CreatedAt,
+	}
+	if err := r.SaveImage(ctx, image); err != nil {
+		return fmt.Errorf("failed to save chronic image: %w", err)
+	}
+	return nil
+}
+
+// startSpan starts a client span for a query on the chronic table.
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemNamePostgreSQL, semconv.DBCollectionName("chronic")),
+	)
+}
+
+// endSpan records err on span and returns it.
+func endSpan(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "query failed")
+	}
+	return err
+}
+
+// FindAll returns one page of records matching filter, newest first, along
+// with the total number of matching records across all pages. Soft-deleted
+// records are excluded.
+func (r *ChronicRepository) FindAll(ctx context.Context, filter ChronicFilter, page Pagination) ([]Chronic, int64, error) {
+	return findAll(r.db.WithContext(ctx), filter, page)
+}
+
+// FindByUser is FindAll restricted to the records of userID.
+func (r *ChronicRepository) FindByUser(ctx context.Context, userID string, filter ChronicFilter, page Pagination) ([]Chronic, int64, error) {
+	filter.UserID = userID
+	return findAll(r.db.WithContext(ctx), filter, page)
+}
+
+// FindAllIncludingDeleted is FindAll for administrators: soft-deleted
+// records are included, with DeletedAt set.
+func (r *ChronicRepository) FindAllIncludingDeleted(ctx context.Context, filter ChronicFilter, page Pagination) ([]Chronic, int64, error) {
+	return findAll(r.db.WithContext(ctx).Unscoped(), filter, page)
+}
+
+func findAll(db *gorm.DB, filter ChronicFilter, page Pagination) ([]Chronic, int64, error) {
+	query := filter.apply(db.Model(&Chronic{}))
+	// Start a new session so the count and page queries don't share statement state.
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var chronics []Chronic
+	err := query.
+		Order("created_at DESC").
+		Offset(page.Offset()).
+		Limit(page.PageSize).
+		Find(&chronics).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return chronics, total, nil
+}
+
+// Count returns the number of records matching filter. Soft-deleted records
+// are excluded.
+func (r *ChronicRepository) Count(ctx context.Context, filter ChronicFilter) (int64, error) {
+	ctx, span := startSpan(ctx, "ChronicRepository.Count")
+	defer span.End()
+
+	var total int64
+	err := filter.apply(r.db.WithContext(ctx).Model(&Chronic{})).Count(&total).Error
+	return total, endSpan(span, err)
+}
+
+// Export calls fn with each record matching filter, oldest first, and stops
+// after limit records or at the first error of fn. Records are read from
+// the database one row at a time, so exports of any size use constant
+// memory. Soft-deleted records are excluded.
+func (r *ChronicRepository) Export(ctx context.Context, filter ChronicFilter, limit int, fn func(*Chronic) error) error {
+	ctx, span := startSpan(ctx, "ChronicRepository.Export")
+	defer span.End()
+
+	db := r.db.WithContext(ctx)
+	rows, err := filter.apply(db.Model(&Chronic{})).Order("created_at, id").Limit(limit).Rows()
+	if err != nil {
+		return endSpan(span, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var chronic Chronic
+		if err := db.ScanRows(rows, &chronic); err != nil {
+			return endSpan(span, err)
+		}
+		if err := fn(&chronic); err != nil {
+			return endSpan(span, err)
+		}
+	}
+	return endSpan(span, rows.Err())
+}
+
+// FindById returns the record with the given ID, or ErrNotFound. Soft-deleted
+// records are treated as not found.
+func (r *ChronicRepository) FindById(ctx context.Context, id uuid.UUID) (*Chronic, error) {
+	var chronic Chronic
+	err := r.db.WithContext(ctx).First(&chronic, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &chronic, nil
+}
+
+// Delete soft-deletes the record with the given ID, or returns ErrNotFound
+// if there is no such record or it is already deleted. The row is kept and
+// remains visible to FindAllIncludingDeleted.
+func (r *ChronicRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	result := r.db.WithContext(ctx).Delete(&Chronic{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteOlderThan permanently removes the records created before cutoff,
+// including soft-deleted ones, together with their stored images, and
+// returns the number of records removed.
+func (r *ChronicRepository) DeleteOlderThan(ctx context.Context, cutoff time.Time) (int64, error) {
+	ctx, span := startSpan(ctx, "ChronicRepository.DeleteOlderThan")
+	defer span.End()
+
+	var removed int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id IN (SELECT id FROM chronics WHERE created_at < ?)", cutoff).Delete(&ChronicImage{}).Error; err != nil {
+			return err
+		}
+		result := tx.Unscoped().Where("created_at < ?", cutoff).Delete(&Chronic{})
+		removed = result.RowsAffected
+		return result.Error
+	})
+	return removed, endSpan(span, err)
 }
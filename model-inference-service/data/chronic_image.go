@@ -0,0 +1,39 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+// ChronicImage is the uploaded image of an analysis, stored under the ID of
+// its chronic record when STORE_IMAGES is enabled. Data is re-encoded from
+// the decoded pixels, so it never holds the original upload or its
+// metadata. The table is created by AutoMigrate; with SKIP_AUTOMIGRATE,
+// apply
+//
+//	CREATE TABLE chronic_images (
+//	    id uuid PRIMARY KEY,
+//	    content_type varchar(32) NOT NULL,
+//	    data bytea NOT NULL,
+//	    created_at timestamp NOT NULL
+//	);
+//
+// Images are kept when their chronic record is soft-deleted and removed
+// with it by DeleteOlderThan.
+type ChronicImage struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key"`
+	ContentType string    `gorm:"type:varchar(32);not null"`
+	Data        []byte    `gorm:"type:bytea;not null"`
+	CreatedAt   time.Time `gorm:"type:timestamp;not null"`
+}
+
+// SaveImage stores the image of a chronic record. An image already stored
+// under the same ID is kept.
+func (r *ChronicRepository) SaveImage(ctx context.Context, image *ChronicImage) error {
+	ctx, span := startSpan(ctx, "ChronicRepository.SaveImage")
+	defer span.End()
+	return endSpan(span, r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(image).Error)
+}
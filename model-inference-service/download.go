@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"model-inference-service/artifact"
+	"os"
+	"slices"
+	"sync"
+)
+
+// downloadedModels are the model files fetched from remote locations. ONNX
+// Runtime reopens the file for batch sessions, so each is kept until the
+// instances loaded from it are closed rather than removed once loaded.
+var downloadedModels struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+// fetchModelFile returns a local path for the model at location. Remote
+// locations (http(s)://, s3://, gs://) are downloaded to a new temporary
+// file, which removeDownloadedModel or removeDownloadedModels deletes; local
+// paths are returned as is.
+func fetchModelFile(ctx context.Context, location string, config *Config) (string, error) {
+	if !artifact.IsRemote(location) {
+		return location, nil
+	}
+
+	path, err := config.Artifacts.Download(ctx, location, os.TempDir())
+	if err != nil {
+		return "", fmt.Errorf("failed to download ONNX model: %v", err)
+	}
+	downloadedModels.mu.Lock()
+	downloadedModels.paths = append(downloadedModels.paths, path)
+	downloadedModels.mu.Unlock()
+
+	log.Printf("Downloaded ONNX model to %s", path)
+	return path, nil
+}
+
+// removeDownloadedModel deletes path if it was downloaded by fetchModelFile
+// and is still present; other paths, such as local model files, are left
+// alone. It must only be called once the instances loaded from path are
+// closed.
+func removeDownloadedModel(path string) {
+	downloadedModels.mu.Lock()
+	defer downloadedModels.mu.Unlock()
+
+	i := slices.Index(downloadedModels.paths, path)
+	if i < 0 {
+		return
+	}
+	downloadedModels.paths = slices.Delete(downloadedModels.paths, i, i+1)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove downloaded model %s: %v", path, err)
+	}
+}
+
+// removeDownloadedModels deletes every file downloaded by fetchModelFile
+// that is still present. It must only be called once every model is closed.
+func removeDownloadedModels() {
+	downloadedModels.mu.Lock()
+	defer downloadedModels.mu.Unlock()
+
+	for _, path := range downloadedModels.paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove downloaded model %s: %v", path, err)
+		}
+	}
+	downloadedModels.paths = nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveDownloadedModelKeepsLocalFiles(t *testing.T) {
+	dir := t.TempDir()
+	downloaded := filepath.Join(dir, "downloaded.onnx")
+	local := filepath.Join(dir, "local.onnx")
+	for _, path := range []string{downloaded, local} {
+		if err := os.WriteFile(path, []byte("model"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	downloadedModels.mu.Lock()
+	downloadedModels.paths = append(downloadedModels.paths, downloaded)
+	downloadedModels.mu.Unlock()
+	t.Cleanup(removeDownloadedModels)
+
+	removeDownloadedModel(downloaded)
+	removeDownloadedModel(local)
+
+	if _, err := os.Stat(downloaded); !os.IsNotExist(err) {
+		t.Errorf("downloaded model still exists: %v", err)
+	}
+	if _, err := os.Stat(local); err != nil {
+		t.Errorf("local model was removed: %v", err)
+	}
+	downloadedModels.mu.Lock()
+	defer downloadedModels.mu.Unlock()
+	if len(downloadedModels.paths) != 0 {
+		t.Errorf("downloadedModels still tracks %v", downloadedModels.paths)
+	}
+}
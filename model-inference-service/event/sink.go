@@ -0,0 +1,61 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Sink stores the events of finished analyses. data.ChronicRepository is
+// the database sink; EVENT_SINK selects the sink the service uses.
+type Sink interface {
+	Store(ctx context.Context, ev Event) error
+}
+
+// WriterSink writes each event as a JSON line to a writer, for example
+// stdout, so a log pipeline can collect the audit trail. Images are left
+// out; only the event's status, body and request ID are written.
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink returns a sink writing to w. Writes are serialized, so
+// each line is written whole.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// writtenEvent is one line written by WriterSink.
+type writtenEvent struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	RequestID string    `json:"request_id,omitempty"`
+	Status    string    `json:"status"`
+	Body      Body      `json:"body"`
+}
+
+// writtenEventType tells the event lines apart from the service logs
+// written to the same stream.
+const writtenEventType = "analysis_event"
+
+// Store writes ev as one JSON line.
+func (s *WriterSink) Store(ctx context.Context, ev Event) error {
+	line, err := json.Marshal(writtenEvent{
+		Time:      time.Now(),
+		Type:      writtenEventType,
+		RequestID: ev.RequestID,
+		Status:    ev.Status,
+		Body:      ev.Body,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
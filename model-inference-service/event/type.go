@@ -1,6 +1,83 @@
 package event
 
+import "model-inference-service/service"
+
+// Status values accepted by the chronic table. StatusPending marks an
+// asynchronous analysis that has been accepted but not yet run.
+const (
+	StatusSuccess = "success"
+	StatusFail    = "fail"
+	StatusPending = "pending"
+)
+
 type Event struct {
+	// RequestID correlates the event with the request that produced it.
+	RequestID string
+	// Trace carries the trace context of the request, as captured by
+	// tracing.Inject, so the event is persisted under the request's trace.
+	Trace  map[string]string
 	Status string
-	Body   string
+	Body   Body
+	// Image is the sanitized upload to store with the chronic record, nil
+	// unless image storage is enabled. It never holds the original bytes.
+	Image *Image
+}
+
+// Image is an uploaded image re-encoded without its metadata.
+type Image struct {
+	// ContentType is image/jpeg or image/png.
+	ContentType string
+	Data        []byte
+}
+
+// Body is the structured result of an analysis. It is serialized as the
+// JSON body of the chronic record, which is stored under AnalysisID so the
+// analysis can be looked up later.
+type Body struct {
+	// AnalysisID is the ID reported to the client.
+	AnalysisID  string                     `json:"analysis_id"`
+	UserID      string                     `json:"user_id,omitempty"`
+	Predictions []service.PredictionResult `json:"predictions,omitempty"`
+	Margin      *float32                   `json:"margin,omitempty"`
+	NeedsReview bool                       `json:"needs_review,omitempty"`
+	// ModelName and ModelVersion identify the model that produced the
+	// predictions: its name and the SHA-256 digest of its file.
+	ModelName    string `json:"model_name,omitempty"`
+	ModelVersion string `json:"model_version,omitempty"`
+	// Cached is set when the result was served from the analysis cache
+	// rather than a new inference.
+	Cached bool `json:"cached,omitempty"`
+	// Preprocessing is how the image was turned into model input, so the
+	// result can be reproduced after the defaults change. It is not set on
+	// failed analyses.
+	Preprocessing *Preprocessing `json:"preprocessing,omitempty"`
+	Error         string         `json:"error,omitempty"`
+}
+
+// Preprocessing holds the effective preprocessing parameters of an
+// analysis: the settings the request resolved to, with the ones that did
+// not apply left out.
+type Preprocessing struct {
+	// Width, Height and Layout are the model input the image was fitted to.
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Layout string `json:"layout"`
+	// ResizeMode is stretch, center_crop or pad; PadColor, as #rrggbb, is
+	// only set in pad mode.
+	ResizeMode string `json:"resize_mode"`
+	PadColor   string `json:"pad_color,omitempty"`
+	// Quality is the quality profile, which selects Filter, the resize
+	// interpolation, and Views, the number of views whose outputs were
+	// averaged.
+	Quality string `json:"quality"`
+	Filter  string `json:"filter"`
+	Views   int    `json:"views"`
+	// Normalization is zero_one, neg_one_one or imagenet; Mean and Std are
+	// only set for imagenet.
+	Normalization string      `json:"normalization"`
+	Mean          *[3]float32 `json:"mean,omitempty"`
+	Std           *[3]float32 `json:"std,omitempty"`
+	// Background, as #rrggbb, is the color transparent pixels are
+	// composited over.
+	Background string `json:"background"`
 }
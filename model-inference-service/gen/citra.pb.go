@@ -30,9 +30,32 @@ type ImageInfo struct {
 	UserId string `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
 	// Tipe file gambar, mis. "jpeg", "png", "webp".
 	// Ini sangat penting agar server tahu cara mendekode byte stream.
+	// Jika nilainya sama dengan nama model yang dimuat (mis. "face"),
+	// permintaan dialihkan ke model tersebut; selain itu model utama dipakai.
 	ImageType string `protobuf:"bytes,2,opt,name=image_type,json=imageType,proto3" json:"image_type,omitempty"`
 	// Opsional: Metadata tambahan apa pun yang mungkin diperlukan model
-	Metadata      map[string]string `protobuf:"bytes,3,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Metadata map[string]string `protobuf:"bytes,3,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Opsional: Batas minimum skor keyakinan (0.0 - 1.0). Prediksi di bawah
+	// batas ini dibuang; jika semuanya terbuang, server mengembalikan satu
+	// hasil "uncertain". Nilai 0 berarti tanpa penyaringan.
+	MinConfidence float32 `protobuf:"fixed32,4,opt,name=min_confidence,json=minConfidence,proto3" json:"min_confidence,omitempty"`
+	// Opsional: Ukuran total gambar dalam byte. Jika diisi, server menolak
+	// stream lebih awal bila ukurannya melebihi batas, sebelum chunk dikirim.
+	// Untuk beberapa gambar, ini adalah jumlah ukuran semua gambar.
+	ImageSize int64 `protobuf:"varint,5,opt,name=image_size,json=imageSize,proto3" json:"image_size,omitempty"`
+	// Opsional: Jumlah prediksi teratas yang dikembalikan, dibatasi antara 1
+	// dan jumlah kelas model. Nilai 0 memakai bawaan server (DEFAULT_TOP_K).
+	TopK int32 `protobuf:"varint,6,opt,name=top_k,json=topK,proto3" json:"top_k,omitempty"`
+	// Opsional: Jumlah gambar yang dikirim dalam satu panggilan AnalyzeSkin,
+	// paling banyak 16. Nilai 0 atau 1 berarti satu gambar, dan penanda
+	// 'end_of_frame' diabaikan. Tidak berlaku untuk AnalyzeSkinFrames.
+	ImageCount int32 `protobuf:"varint,7,opt,name=image_count,json=imageCount,proto3" json:"image_count,omitempty"`
+	// Opsional: Profil kualitas analisis. "fast" mengubah ukuran gambar
+	// dengan filter bilinear dan menjalankan satu inferensi; "accurate"
+	// memakai filter Catmull-Rom dan merata-ratakan hasil gambar utuh dengan
+	// lima potongan (tengah dan keempat sudut), sehingga sekitar enam kali
+	// lebih lambat. Kosong berarti bawaan server (PREPROCESS_QUALITY).
+	Quality       string `protobuf:"bytes,8,opt,name=quality,proto3" json:"quality,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -88,6 +111,41 @@ func (x *ImageInfo) GetMetadata() map[string]string {
 	return nil
 }
 
+func (x *ImageInfo) GetMinConfidence() float32 {
+	if x != nil {
+		return x.MinConfidence
+	}
+	return 0
+}
+
+func (x *ImageInfo) GetImageSize() int64 {
+	if x != nil {
+		return x.ImageSize
+	}
+	return 0
+}
+
+func (x *ImageInfo) GetTopK() int32 {
+	if x != nil {
+		return x.TopK
+	}
+	return 0
+}
+
+func (x *ImageInfo) GetImageCount() int32 {
+	if x != nil {
+		return x.ImageCount
+	}
+	return 0
+}
+
+func (x *ImageInfo) GetQuality() string {
+	if x != nil {
+		return x.Quality
+	}
+	return ""
+}
+
 // Pesan ini di-stream dari klien ke server.
 type AnalyzeSkinRequest struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
@@ -98,9 +156,21 @@ type AnalyzeSkinRequest struct {
 	//
 	//	*AnalyzeSkinRequest_Info
 	//	*AnalyzeSkinRequest_Chunk
+	//	*AnalyzeSkinRequest_EndOfFrame
 	RequestPayload isAnalyzeSkinRequest_RequestPayload `protobuf_oneof:"request_payload"`
-	unknownFields  protoimpl.UnknownFields
-	sizeCache      protoimpl.SizeCache
+	// Opsional: Posisi byte pertama 'chunk' ini di dalam gambar (atau frame)
+	// yang sedang dikirim, dimulai dari 0 dan kembali ke 0 setelah setiap
+	// 'end_of_frame'. Jika diisi, server memeriksa bahwa setiap chunk tepat
+	// melanjutkan chunk sebelumnya: chunk yang dikirim ulang (offset lebih
+	// kecil dari jumlah byte yang sudah diterima) atau yang melompat (offset
+	// lebih besar) ditolak dengan INVALID_ARGUMENT, sehingga pengiriman ulang
+	// oleh klien tidak merusak gambar tanpa terdeteksi. Klien yang memakai
+	// offset harus mengisinya pada semua chunk dalam stream; chunk tanpa
+	// offset setelah chunk dengan offset, atau sebaliknya, juga ditolak.
+	// Diabaikan pada pesan 'info' dan 'end_of_frame'.
+	Offset        *int64 `protobuf:"varint,4,opt,name=offset,proto3,oneof" json:"offset,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *AnalyzeSkinRequest) Reset() {
@@ -158,6 +228,22 @@ func (x *AnalyzeSkinRequest) GetChunk() []byte {
 	return nil
 }
 
+func (x *AnalyzeSkinRequest) GetEndOfFrame() bool {
+	if x != nil {
+		if x, ok := x.RequestPayload.(*AnalyzeSkinRequest_EndOfFrame); ok {
+			return x.EndOfFrame
+		}
+	}
+	return false
+}
+
+func (x *AnalyzeSkinRequest) GetOffset() int64 {
+	if x != nil && x.Offset != nil {
+		return *x.Offset
+	}
+	return 0
+}
+
 type isAnalyzeSkinRequest_RequestPayload interface {
 	isAnalyzeSkinRequest_RequestPayload()
 }
@@ -170,10 +256,74 @@ type AnalyzeSkinRequest_Chunk struct {
 	Chunk []byte `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"` // Data gambar mentah, dikirim dalam potongan
 }
 
+type AnalyzeSkinRequest_EndOfFrame struct {
+	// Penanda akhir frame untuk AnalyzeSkinFrames, atau akhir setiap gambar
+	// untuk AnalyzeSkin dengan 'image_count' lebih dari 1.
+	EndOfFrame bool `protobuf:"varint,3,opt,name=end_of_frame,json=endOfFrame,proto3,oneof"`
+}
+
 func (*AnalyzeSkinRequest_Info) isAnalyzeSkinRequest_RequestPayload() {}
 
 func (*AnalyzeSkinRequest_Chunk) isAnalyzeSkinRequest_RequestPayload() {}
 
+func (*AnalyzeSkinRequest_EndOfFrame) isAnalyzeSkinRequest_RequestPayload() {}
+
+// Permintaan AnalyzeSkinImage: metadata dan seluruh byte gambar dalam satu
+// pesan.
+type AnalyzeSkinImageRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 'image_size' diabaikan, dan 'image_count' lebih dari 1 ditolak.
+	Info *ImageInfo `protobuf:"bytes,1,opt,name=info,proto3" json:"info,omitempty"`
+	// Data gambar mentah yang lengkap.
+	Image         []byte `protobuf:"bytes,2,opt,name=image,proto3" json:"image,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AnalyzeSkinImageRequest) Reset() {
+	*x = AnalyzeSkinImageRequest{}
+	mi := &file_citra_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AnalyzeSkinImageRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AnalyzeSkinImageRequest) ProtoMessage() {}
+
+func (x *AnalyzeSkinImageRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_citra_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AnalyzeSkinImageRequest.ProtoReflect.Descriptor instead.
+func (*AnalyzeSkinImageRequest) Descriptor() ([]byte, []int) {
+	return file_citra_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *AnalyzeSkinImageRequest) GetInfo() *ImageInfo {
+	if x != nil {
+		return x.Info
+	}
+	return nil
+}
+
+func (x *AnalyzeSkinImageRequest) GetImage() []byte {
+	if x != nil {
+		return x.Image
+	}
+	return nil
+}
+
 // Satu hasil prediksi dari model CNN.
 type AnalysisResult struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
@@ -191,7 +341,7 @@ type AnalysisResult struct {
 
 func (x *AnalysisResult) Reset() {
 	*x = AnalysisResult{}
-	mi := &file_citra_proto_msgTypes[2]
+	mi := &file_citra_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -203,7 +353,7 @@ func (x *AnalysisResult) String() string {
 func (*AnalysisResult) ProtoMessage() {}
 
 func (x *AnalysisResult) ProtoReflect() protoreflect.Message {
-	mi := &file_citra_proto_msgTypes[2]
+	mi := &file_citra_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -216,7 +366,7 @@ func (x *AnalysisResult) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use AnalysisResult.ProtoReflect.Descriptor instead.
 func (*AnalysisResult) Descriptor() ([]byte, []int) {
-	return file_citra_proto_rawDescGZIP(), []int{2}
+	return file_citra_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *AnalysisResult) GetLabel() string {
@@ -257,14 +407,42 @@ type AnalyzeSkinResponse struct {
 	AnalysisTimestamp *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=analysis_timestamp,json=analysisTimestamp,proto3" json:"analysis_timestamp,omitempty"`
 	// Daftar hasil prediksi dari model
 	// (mungkin 1 hasil teratas, atau 3 teratas, dst.)
-	Results       []*AnalysisResult `protobuf:"bytes,3,rep,name=results,proto3" json:"results,omitempty"`
+	Results []*AnalysisResult `protobuf:"bytes,3,rep,name=results,proto3" json:"results,omitempty"`
+	// Selisih skor keyakinan antara prediksi teratas dan prediksi kedua,
+	// dihitung dari seluruh vektor keluaran model. Tidak diisi jika
+	// model hanya memiliki satu kelas.
+	Margin *float32 `protobuf:"fixed32,4,opt,name=margin,proto3,oneof" json:"margin,omitempty"`
+	// Lebar dan tinggi gambar dalam piksel seperti yang didekode server,
+	// setelah rotasi sesuai orientasi EXIF, sebelum diubah ukurannya.
+	InputWidth  int32 `protobuf:"varint,5,opt,name=input_width,json=inputWidth,proto3" json:"input_width,omitempty"`
+	InputHeight int32 `protobuf:"varint,6,opt,name=input_height,json=inputHeight,proto3" json:"input_height,omitempty"`
+	// Format gambar yang terdeteksi dari isi byte: "jpeg", "png" atau "webp".
+	DetectedFormat string `protobuf:"bytes,7,opt,name=detected_format,json=detectedFormat,proto3" json:"detected_format,omitempty"`
+	// Diisi true jika keyakinan prediksi teratas di bawah ambang peninjauan,
+	// sehingga hasil sebaiknya tidak disajikan sebagai diagnosis.
+	// review_message lalu berisi saran untuk berkonsultasi dengan tenaga
+	// kesehatan profesional.
+	NeedsReview   bool   `protobuf:"varint,8,opt,name=needs_review,json=needsReview,proto3" json:"needs_review,omitempty"`
+	ReviewMessage string `protobuf:"bytes,9,opt,name=review_message,json=reviewMessage,proto3" json:"review_message,omitempty"`
+	// Hasil per gambar jika 'image_count' lebih dari 1, sesuai urutan kirim.
+	// Field lain di tingkat atas lalu kosong, kecuali analysis_timestamp.
+	Analyses []*AnalyzeSkinResponse `protobuf:"bytes,10,rep,name=analyses,proto3" json:"analyses,omitempty"`
+	// Diisi true jika hasil diambil dari cache analisis karena gambar yang
+	// sama persis sudah pernah dianalisis, tanpa menjalankan inferensi ulang.
+	Cached bool `protobuf:"varint,11,opt,name=cached,proto3" json:"cached,omitempty"`
+	// Nama model yang menghasilkan analisis, dan versinya berupa digest
+	// SHA-256 dari berkas model saat analisis dijalankan, agar hasil dapat
+	// ditelusuri ke model yang tepat meski model dimuat ulang. model_version
+	// kosong untuk model yang tidak dimuat dari berkas.
+	ModelName     string `protobuf:"bytes,12,opt,name=model_name,json=modelName,proto3" json:"model_name,omitempty"`
+	ModelVersion  string `protobuf:"bytes,13,opt,name=model_version,json=modelVersion,proto3" json:"model_version,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *AnalyzeSkinResponse) Reset() {
 	*x = AnalyzeSkinResponse{}
-	mi := &file_citra_proto_msgTypes[3]
+	mi := &file_citra_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -276,7 +454,7 @@ func (x *AnalyzeSkinResponse) String() string {
 func (*AnalyzeSkinResponse) ProtoMessage() {}
 
 func (x *AnalyzeSkinResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_citra_proto_msgTypes[3]
+	mi := &file_citra_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -289,7 +467,7 @@ func (x *AnalyzeSkinResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use AnalyzeSkinResponse.ProtoReflect.Descriptor instead.
 func (*AnalyzeSkinResponse) Descriptor() ([]byte, []int) {
-	return file_citra_proto_rawDescGZIP(), []int{3}
+	return file_citra_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *AnalyzeSkinResponse) GetAnalysisId() string {
@@ -313,37 +491,137 @@ func (x *AnalyzeSkinResponse) GetResults() []*AnalysisResult {
 	return nil
 }
 
+func (x *AnalyzeSkinResponse) GetMargin() float32 {
+	if x != nil && x.Margin != nil {
+		return *x.Margin
+	}
+	return 0
+}
+
+func (x *AnalyzeSkinResponse) GetInputWidth() int32 {
+	if x != nil {
+		return x.InputWidth
+	}
+	return 0
+}
+
+func (x *AnalyzeSkinResponse) GetInputHeight() int32 {
+	if x != nil {
+		return x.InputHeight
+	}
+	return 0
+}
+
+func (x *AnalyzeSkinResponse) GetDetectedFormat() string {
+	if x != nil {
+		return x.DetectedFormat
+	}
+	return ""
+}
+
+func (x *AnalyzeSkinResponse) GetNeedsReview() bool {
+	if x != nil {
+		return x.NeedsReview
+	}
+	return false
+}
+
+func (x *AnalyzeSkinResponse) GetReviewMessage() string {
+	if x != nil {
+		return x.ReviewMessage
+	}
+	return ""
+}
+
+func (x *AnalyzeSkinResponse) GetAnalyses() []*AnalyzeSkinResponse {
+	if x != nil {
+		return x.Analyses
+	}
+	return nil
+}
+
+func (x *AnalyzeSkinResponse) GetCached() bool {
+	if x != nil {
+		return x.Cached
+	}
+	return false
+}
+
+func (x *AnalyzeSkinResponse) GetModelName() string {
+	if x != nil {
+		return x.ModelName
+	}
+	return ""
+}
+
+func (x *AnalyzeSkinResponse) GetModelVersion() string {
+	if x != nil {
+		return x.ModelVersion
+	}
+	return ""
+}
+
 var File_citra_proto protoreflect.FileDescriptor
 
 const file_citra_proto_rawDesc = "" +
 	"\n" +
-	"\vcitra.proto\x12\tdermatoai\x1a\x1fgoogle/protobuf/timestamp.proto\"\xc0\x01\n" +
+	"\vcitra.proto\x12\tdermatoai\x1a\x1fgoogle/protobuf/timestamp.proto\"\xd6\x02\n" +
 	"\tImageInfo\x12\x17\n" +
 	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x1d\n" +
 	"\n" +
 	"image_type\x18\x02 \x01(\tR\timageType\x12>\n" +
-	"\bmetadata\x18\x03 \x03(\v2\".dermatoai.ImageInfo.MetadataEntryR\bmetadata\x1a;\n" +
+	"\bmetadata\x18\x03 \x03(\v2\".dermatoai.ImageInfo.MetadataEntryR\bmetadata\x12%\n" +
+	"\x0emin_confidence\x18\x04 \x01(\x02R\rminConfidence\x12\x1d\n" +
+	"\n" +
+	"image_size\x18\x05 \x01(\x03R\timageSize\x12\x13\n" +
+	"\x05top_k\x18\x06 \x01(\x05R\x04topK\x12\x1f\n" +
+	"\vimage_count\x18\a \x01(\x05R\n" +
+	"imageCount\x12\x18\n" +
+	"\aquality\x18\b \x01(\tR\aquality\x1a;\n" +
 	"\rMetadataEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"k\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xb7\x01\n" +
 	"\x12AnalyzeSkinRequest\x12*\n" +
 	"\x04info\x18\x01 \x01(\v2\x14.dermatoai.ImageInfoH\x00R\x04info\x12\x16\n" +
-	"\x05chunk\x18\x02 \x01(\fH\x00R\x05chunkB\x11\n" +
-	"\x0frequest_payload\"\x90\x01\n" +
+	"\x05chunk\x18\x02 \x01(\fH\x00R\x05chunk\x12\"\n" +
+	"\fend_of_frame\x18\x03 \x01(\bH\x00R\n" +
+	"endOfFrame\x12\x1b\n" +
+	"\x06offset\x18\x04 \x01(\x03H\x01R\x06offset\x88\x01\x01B\x11\n" +
+	"\x0frequest_payloadB\t\n" +
+	"\a_offset\"Y\n" +
+	"\x17AnalyzeSkinImageRequest\x12(\n" +
+	"\x04info\x18\x01 \x01(\v2\x14.dermatoai.ImageInfoR\x04info\x12\x14\n" +
+	"\x05image\x18\x02 \x01(\fR\x05image\"\x90\x01\n" +
 	"\x0eAnalysisResult\x12\x14\n" +
 	"\x05label\x18\x01 \x01(\tR\x05label\x12\x1e\n" +
 	"\n" +
 	"confidence\x18\x02 \x01(\x02R\n" +
 	"confidence\x12 \n" +
 	"\vdescription\x18\x03 \x01(\tR\vdescription\x12&\n" +
-	"\x0erecommendation\x18\x04 \x01(\tR\x0erecommendation\"\xb6\x01\n" +
+	"\x0erecommendation\x18\x04 \x01(\tR\x0erecommendation\"\xad\x04\n" +
 	"\x13AnalyzeSkinResponse\x12\x1f\n" +
 	"\vanalysis_id\x18\x01 \x01(\tR\n" +
 	"analysisId\x12I\n" +
 	"\x12analysis_timestamp\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x11analysisTimestamp\x123\n" +
-	"\aresults\x18\x03 \x03(\v2\x19.dermatoai.AnalysisResultR\aresults2e\n" +
+	"\aresults\x18\x03 \x03(\v2\x19.dermatoai.AnalysisResultR\aresults\x12\x1b\n" +
+	"\x06margin\x18\x04 \x01(\x02H\x00R\x06margin\x88\x01\x01\x12\x1f\n" +
+	"\vinput_width\x18\x05 \x01(\x05R\n" +
+	"inputWidth\x12!\n" +
+	"\finput_height\x18\x06 \x01(\x05R\vinputHeight\x12'\n" +
+	"\x0fdetected_format\x18\a \x01(\tR\x0edetectedFormat\x12!\n" +
+	"\fneeds_review\x18\b \x01(\bR\vneedsReview\x12%\n" +
+	"\x0ereview_message\x18\t \x01(\tR\rreviewMessage\x12:\n" +
+	"\banalyses\x18\n" +
+	" \x03(\v2\x1e.dermatoai.AnalyzeSkinResponseR\banalyses\x12\x16\n" +
+	"\x06cached\x18\v \x01(\bR\x06cached\x12\x1d\n" +
+	"\n" +
+	"model_name\x18\f \x01(\tR\tmodelName\x12#\n" +
+	"\rmodel_version\x18\r \x01(\tR\fmodelVersionB\t\n" +
+	"\a_margin2\x95\x02\n" +
 	"\x13SkinAnalysisService\x12N\n" +
-	"\vAnalyzeSkin\x12\x1d.dermatoai.AnalyzeSkinRequest\x1a\x1e.dermatoai.AnalyzeSkinResponse(\x01B#Z!model-inference-service/gen;citrab\x06proto3"
+	"\vAnalyzeSkin\x12\x1d.dermatoai.AnalyzeSkinRequest\x1a\x1e.dermatoai.AnalyzeSkinResponse(\x01\x12V\n" +
+	"\x11AnalyzeSkinFrames\x12\x1d.dermatoai.AnalyzeSkinRequest\x1a\x1e.dermatoai.AnalyzeSkinResponse(\x010\x01\x12V\n" +
+	"\x10AnalyzeSkinImage\x12\".dermatoai.AnalyzeSkinImageRequest\x1a\x1e.dermatoai.AnalyzeSkinResponseB#Z!model-inference-service/gen;citrab\x06proto3"
 
 var (
 	file_citra_proto_rawDescOnce sync.Once
@@ -357,27 +635,34 @@ func file_citra_proto_rawDescGZIP() []byte {
 	return file_citra_proto_rawDescData
 }
 
-var file_citra_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_citra_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
 var file_citra_proto_goTypes = []any{
-	(*ImageInfo)(nil),             // 0: dermatoai.ImageInfo
-	(*AnalyzeSkinRequest)(nil),    // 1: dermatoai.AnalyzeSkinRequest
-	(*AnalysisResult)(nil),        // 2: dermatoai.AnalysisResult
-	(*AnalyzeSkinResponse)(nil),   // 3: dermatoai.AnalyzeSkinResponse
-	nil,                           // 4: dermatoai.ImageInfo.MetadataEntry
-	(*timestamppb.Timestamp)(nil), // 5: google.protobuf.Timestamp
+	(*ImageInfo)(nil),               // 0: dermatoai.ImageInfo
+	(*AnalyzeSkinRequest)(nil),      // 1: dermatoai.AnalyzeSkinRequest
+	(*AnalyzeSkinImageRequest)(nil), // 2: dermatoai.AnalyzeSkinImageRequest
+	(*AnalysisResult)(nil),          // 3: dermatoai.AnalysisResult
+	(*AnalyzeSkinResponse)(nil),     // 4: dermatoai.AnalyzeSkinResponse
+	nil,                             // 5: dermatoai.ImageInfo.MetadataEntry
+	(*timestamppb.Timestamp)(nil),   // 6: google.protobuf.Timestamp
 }
 var file_citra_proto_depIdxs = []int32{
-	4, // 0: dermatoai.ImageInfo.metadata:type_name -> dermatoai.ImageInfo.MetadataEntry
+	5, // 0: dermatoai.ImageInfo.metadata:type_name -> dermatoai.ImageInfo.MetadataEntry
 	0, // 1: dermatoai.AnalyzeSkinRequest.info:type_name -> dermatoai.ImageInfo
-	5, // 2: dermatoai.AnalyzeSkinResponse.analysis_timestamp:type_name -> google.protobuf.Timestamp
-	2, // 3: dermatoai.AnalyzeSkinResponse.results:type_name -> dermatoai.AnalysisResult
-	1, // 4: dermatoai.SkinAnalysisService.AnalyzeSkin:input_type -> dermatoai.AnalyzeSkinRequest
-	3, // 5: dermatoai.SkinAnalysisService.AnalyzeSkin:output_type -> dermatoai.AnalyzeSkinResponse
-	5, // [5:6] is the sub-list for method output_type
-	4, // [4:5] is the sub-list for method input_type
-	4, // [4:4] is the sub-list for extension type_name
-	4, // [4:4] is the sub-list for extension extendee
-	0, // [0:4] is the sub-list for field type_name
+	0, // 2: dermatoai.AnalyzeSkinImageRequest.info:type_name -> dermatoai.ImageInfo
+	6, // 3: dermatoai.AnalyzeSkinResponse.analysis_timestamp:type_name -> google.protobuf.Timestamp
+	3, // 4: dermatoai.AnalyzeSkinResponse.results:type_name -> dermatoai.AnalysisResult
+	4, // 5: dermatoai.AnalyzeSkinResponse.analyses:type_name -> dermatoai.AnalyzeSkinResponse
+	1, // 6: dermatoai.SkinAnalysisService.AnalyzeSkin:input_type -> dermatoai.AnalyzeSkinRequest
+	1, // 7: dermatoai.SkinAnalysisService.AnalyzeSkinFrames:input_type -> dermatoai.AnalyzeSkinRequest
+	2, // 8: dermatoai.SkinAnalysisService.AnalyzeSkinImage:input_type -> dermatoai.AnalyzeSkinImageRequest
+	4, // 9: dermatoai.SkinAnalysisService.AnalyzeSkin:output_type -> dermatoai.AnalyzeSkinResponse
+	4, // 10: dermatoai.SkinAnalysisService.AnalyzeSkinFrames:output_type -> dermatoai.AnalyzeSkinResponse
+	4, // 11: dermatoai.SkinAnalysisService.AnalyzeSkinImage:output_type -> dermatoai.AnalyzeSkinResponse
+	9, // [9:12] is the sub-list for method output_type
+	6, // [6:9] is the sub-list for method input_type
+	6, // [6:6] is the sub-list for extension type_name
+	6, // [6:6] is the sub-list for extension extendee
+	0, // [0:6] is the sub-list for field type_name
 }
 
 func init() { file_citra_proto_init() }
@@ -388,14 +673,16 @@ func file_citra_proto_init() {
 	file_citra_proto_msgTypes[1].OneofWrappers = []any{
 		(*AnalyzeSkinRequest_Info)(nil),
 		(*AnalyzeSkinRequest_Chunk)(nil),
+		(*AnalyzeSkinRequest_EndOfFrame)(nil),
 	}
+	file_citra_proto_msgTypes[4].OneofWrappers = []any{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_citra_proto_rawDesc), len(file_citra_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   5,
+			NumMessages:   6,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -19,7 +19,9 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	SkinAnalysisService_AnalyzeSkin_FullMethodName = "/dermatoai.SkinAnalysisService/AnalyzeSkin"
+	SkinAnalysisService_AnalyzeSkin_FullMethodName       = "/dermatoai.SkinAnalysisService/AnalyzeSkin"
+	SkinAnalysisService_AnalyzeSkinFrames_FullMethodName = "/dermatoai.SkinAnalysisService/AnalyzeSkinFrames"
+	SkinAnalysisService_AnalyzeSkinImage_FullMethodName  = "/dermatoai.SkinAnalysisService/AnalyzeSkinImage"
 )
 
 // SkinAnalysisServiceClient is the client API for SkinAnalysisService service.
@@ -37,7 +39,30 @@ type SkinAnalysisServiceClient interface {
 	// 3. Klien menutup stream setelah semua chunk dikirim.
 	// Server akan merakit kembali gambar, memprosesnya dengan CNN,
 	// lalu mengirimkan satu AnalyzeSkinResponse.
+	// Untuk beberapa gambar sekaligus, isi 'image_count' pada 'info' dan
+	// akhiri chunk setiap gambar dengan 'end_of_frame' bernilai true
+	// (opsional untuk gambar terakhir). Semua gambar dianalisis dalam satu
+	// panggilan model dan hasilnya dikembalikan di 'analyses', satu per
+	// gambar sesuai urutan kirim. Jumlah gambar yang diterima harus sama
+	// dengan 'image_count'.
 	AnalyzeSkin(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[AnalyzeSkinRequest, AnalyzeSkinResponse], error)
+	// Varian dua arah untuk stream frame, mis. dari video:
+	// 1. Pesan pertama berisi 'info', yang berlaku untuk semua frame
+	//    berikutnya. 'info' boleh dikirim ulang di antara frame untuk
+	//    mengganti pengaturannya.
+	// 2. Setiap frame dikirim sebagai satu atau lebih 'chunk', lalu diakhiri
+	//    dengan pesan 'end_of_frame' bernilai true.
+	// 3. Server menjalankan inferensi untuk setiap frame yang lengkap dan
+	//    langsung mengirimkan satu AnalyzeSkinResponse, tanpa menunggu
+	//    stream ditutup. Chunk yang tersisa saat klien menutup stream
+	//    diproses sebagai frame terakhir.
+	// Frame yang gagal dianalisis menghentikan stream dengan status error.
+	AnalyzeSkinFrames(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[AnalyzeSkinRequest, AnalyzeSkinResponse], error)
+	// Varian unary untuk gambar kecil yang muat dalam satu pesan: seluruh
+	// byte gambar dikirim bersama 'info' dan dianalisis seperti AnalyzeSkin
+	// dengan satu gambar. Ukuran pesan dibatasi oleh batas pesan gRPC server
+	// (bawaan 4 MB); gunakan AnalyzeSkin untuk gambar yang lebih besar.
+	AnalyzeSkinImage(ctx context.Context, in *AnalyzeSkinImageRequest, opts ...grpc.CallOption) (*AnalyzeSkinResponse, error)
 }
 
 type skinAnalysisServiceClient struct {
@@ -61,6 +86,29 @@ func (c *skinAnalysisServiceClient) AnalyzeSkin(ctx context.Context, opts ...grp
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type SkinAnalysisService_AnalyzeSkinClient = grpc.ClientStreamingClient[AnalyzeSkinRequest, AnalyzeSkinResponse]
 
+func (c *skinAnalysisServiceClient) AnalyzeSkinFrames(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[AnalyzeSkinRequest, AnalyzeSkinResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SkinAnalysisService_ServiceDesc.Streams[1], SkinAnalysisService_AnalyzeSkinFrames_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[AnalyzeSkinRequest, AnalyzeSkinResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SkinAnalysisService_AnalyzeSkinFramesClient = grpc.BidiStreamingClient[AnalyzeSkinRequest, AnalyzeSkinResponse]
+
+func (c *skinAnalysisServiceClient) AnalyzeSkinImage(ctx context.Context, in *AnalyzeSkinImageRequest, opts ...grpc.CallOption) (*AnalyzeSkinResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AnalyzeSkinResponse)
+	err := c.cc.Invoke(ctx, SkinAnalysisService_AnalyzeSkinImage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // SkinAnalysisServiceServer is the server API for SkinAnalysisService service.
 // All implementations must embed UnimplementedSkinAnalysisServiceServer
 // for forward compatibility.
@@ -76,7 +124,30 @@ type SkinAnalysisServiceServer interface {
 	// 3. Klien menutup stream setelah semua chunk dikirim.
 	// Server akan merakit kembali gambar, memprosesnya dengan CNN,
 	// lalu mengirimkan satu AnalyzeSkinResponse.
+	// Untuk beberapa gambar sekaligus, isi 'image_count' pada 'info' dan
+	// akhiri chunk setiap gambar dengan 'end_of_frame' bernilai true
+	// (opsional untuk gambar terakhir). Semua gambar dianalisis dalam satu
+	// panggilan model dan hasilnya dikembalikan di 'analyses', satu per
+	// gambar sesuai urutan kirim. Jumlah gambar yang diterima harus sama
+	// dengan 'image_count'.
 	AnalyzeSkin(grpc.ClientStreamingServer[AnalyzeSkinRequest, AnalyzeSkinResponse]) error
+	// Varian dua arah untuk stream frame, mis. dari video:
+	// 1. Pesan pertama berisi 'info', yang berlaku untuk semua frame
+	//    berikutnya. 'info' boleh dikirim ulang di antara frame untuk
+	//    mengganti pengaturannya.
+	// 2. Setiap frame dikirim sebagai satu atau lebih 'chunk', lalu diakhiri
+	//    dengan pesan 'end_of_frame' bernilai true.
+	// 3. Server menjalankan inferensi untuk setiap frame yang lengkap dan
+	//    langsung mengirimkan satu AnalyzeSkinResponse, tanpa menunggu
+	//    stream ditutup. Chunk yang tersisa saat klien menutup stream
+	//    diproses sebagai frame terakhir.
+	// Frame yang gagal dianalisis menghentikan stream dengan status error.
+	AnalyzeSkinFrames(grpc.BidiStreamingServer[AnalyzeSkinRequest, AnalyzeSkinResponse]) error
+	// Varian unary untuk gambar kecil yang muat dalam satu pesan: seluruh
+	// byte gambar dikirim bersama 'info' dan dianalisis seperti AnalyzeSkin
+	// dengan satu gambar. Ukuran pesan dibatasi oleh batas pesan gRPC server
+	// (bawaan 4 MB); gunakan AnalyzeSkin untuk gambar yang lebih besar.
+	AnalyzeSkinImage(context.Context, *AnalyzeSkinImageRequest) (*AnalyzeSkinResponse, error)
 	mustEmbedUnimplementedSkinAnalysisServiceServer()
 }
 
@@ -90,6 +161,12 @@ type UnimplementedSkinAnalysisServiceServer struct{}
 func (UnimplementedSkinAnalysisServiceServer) AnalyzeSkin(grpc.ClientStreamingServer[AnalyzeSkinRequest, AnalyzeSkinResponse]) error {
 	return status.Errorf(codes.Unimplemented, "method AnalyzeSkin not implemented")
 }
+func (UnimplementedSkinAnalysisServiceServer) AnalyzeSkinFrames(grpc.BidiStreamingServer[AnalyzeSkinRequest, AnalyzeSkinResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method AnalyzeSkinFrames not implemented")
+}
+func (UnimplementedSkinAnalysisServiceServer) AnalyzeSkinImage(context.Context, *AnalyzeSkinImageRequest) (*AnalyzeSkinResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AnalyzeSkinImage not implemented")
+}
 func (UnimplementedSkinAnalysisServiceServer) mustEmbedUnimplementedSkinAnalysisServiceServer() {}
 func (UnimplementedSkinAnalysisServiceServer) testEmbeddedByValue()                             {}
 
@@ -118,19 +195,55 @@ func _SkinAnalysisService_AnalyzeSkin_Handler(srv interface{}, stream grpc.Serve
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type SkinAnalysisService_AnalyzeSkinServer = grpc.ClientStreamingServer[AnalyzeSkinRequest, AnalyzeSkinResponse]
 
+func _SkinAnalysisService_AnalyzeSkinFrames_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SkinAnalysisServiceServer).AnalyzeSkinFrames(&grpc.GenericServerStream[AnalyzeSkinRequest, AnalyzeSkinResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SkinAnalysisService_AnalyzeSkinFramesServer = grpc.BidiStreamingServer[AnalyzeSkinRequest, AnalyzeSkinResponse]
+
+func _SkinAnalysisService_AnalyzeSkinImage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AnalyzeSkinImageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SkinAnalysisServiceServer).AnalyzeSkinImage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SkinAnalysisService_AnalyzeSkinImage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SkinAnalysisServiceServer).AnalyzeSkinImage(ctx, req.(*AnalyzeSkinImageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // SkinAnalysisService_ServiceDesc is the grpc.ServiceDesc for SkinAnalysisService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
 var SkinAnalysisService_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "dermatoai.SkinAnalysisService",
 	HandlerType: (*SkinAnalysisServiceServer)(nil),
-	Methods:     []grpc.MethodDesc{},
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AnalyzeSkinImage",
+			Handler:    _SkinAnalysisService_AnalyzeSkinImage_Handler,
+		},
+	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "AnalyzeSkin",
 			Handler:       _SkinAnalysisService_AnalyzeSkin_Handler,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "AnalyzeSkinFrames",
+			Handler:       _SkinAnalysisService_AnalyzeSkinFrames_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "citra.proto",
 }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"model-inference-service/api"
+	"model-inference-service/model"
+	"model-inference-service/service"
+	"os"
+)
+
+// runInfer implements the "infer" subcommand: it classifies a single image
+// and prints the analysis as JSON to stdout, without connecting to the
+// database or starting any server. Model and preprocessing settings are read
+// from the same environment variables as the server; the flags override the
+// model and class dictionary paths.
+func runInfer(args []string) error {
+	// Keep stdout for the JSON result.
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: &logLevel})))
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	logLevel.Set(config.LogLevel)
+
+	flags := flag.NewFlagSet("infer", flag.ContinueOnError)
+	modelPath := flags.String("model", config.ModelPath, "path to the .onnx model file")
+	classesPath := flags.String("classes", config.ClassDictPath, "path to the class dictionary JSON file")
+	labelMapPath := flags.String("label-map", config.LabelMapPath, "optional label map merging classes into reported labels")
+	imagePath := flags.String("image", "", "path to the image to classify")
+	topK := flags.Int("top-k", config.DefaultTopK, "number of predictions to print")
+	qualityName := flags.String("quality", string(config.Preprocess.Quality), "quality profile: fast or accurate")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if *imagePath == "" {
+		return fmt.Errorf("infer: -image is required")
+	}
+	quality, err := api.ParseQualityProfile(*qualityName)
+	if err != nil {
+		return fmt.Errorf("infer: %v", err)
+	}
+	config.Preprocess.Quality = quality
+
+	classDict, err := loadClassDictionary(context.Background(), *classesPath, &config.Artifacts)
+	if err != nil {
+		return err
+	}
+
+	labelGroups, err := loadLabelMap(*labelMapPath)
+	if err != nil {
+		return err
+	}
+
+	path, err := fetchModelFile(context.Background(), *modelPath, config)
+	if err != nil {
+		return err
+	}
+	defer removeDownloadedModels()
+
+	modelConfig, err := resolveModelConfig(path, config.ModelConfig)
+	if err != nil {
+		return err
+	}
+	m, err := model.NewONNXModelWithConfig(path, modelConfig)
+	if err != nil {
+		return fmt.Errorf("failed to load ONNX model: %v", err)
+	}
+	defer m.Close()
+
+	set := service.ModelSet{Predictors: []service.Predictor{m}, ClassDict: classDict, LabelGroups: labelGroups}
+	inferenceService, err := service.NewMultiModelInferenceService(
+		map[string]service.ModelSet{service.DefaultModel: set}, service.DefaultModel, config.InferenceTimeout)
+	if err != nil {
+		return fmt.Errorf("model %s: %v", *modelPath, err)
+	}
+	config.Preprocess.Layout = inferenceService.InputLayout()
+	config.Preprocess.Width, config.Preprocess.Height = inferenceService.InputSize()
+
+	buffer, err := os.ReadFile(*imagePath)
+	if err != nil {
+		return fmt.Errorf("failed to read image: %v", err)
+	}
+	views, _, err := api.PreprocessImageViews(buffer, config.Preprocess)
+	if err != nil {
+		return err
+	}
+
+	analysis, err := inferenceService.AnalyzeViews(context.Background(), views, service.AnalyzeOptions{TopK: *topK})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(analysis)
+}
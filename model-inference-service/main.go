@@ -4,16 +4,29 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"image/color"
+	"io/fs"
 	"log"
+	"log/slog"
 	"model-inference-service/api"
+	"model-inference-service/artifact"
 	"model-inference-service/data"
 	"model-inference-service/event"
 	"model-inference-service/model"
 	"model-inference-service/service"
+	"model-inference-service/tracing"
 	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -21,17 +34,218 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/joho/godotenv"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
+// version is the build version reported by GET /version. Release builds set
+// it with -ldflags "-X main.version=<version>".
+var version = "dev"
+
+// buildVersion returns version, or the VCS revision embedded by the Go
+// toolchain when version was not set at build time.
+func buildVersion() string {
+	if version != "dev" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return version + "-" + setting.Value
+			}
+		}
+	}
+	return version
+}
+
 type Config struct {
+	// LogLevel is the minimum level logged, from LOG_LEVEL (debug, info,
+	// warn or error; default info). Per-request logs are at debug level.
+	LogLevel slog.Level
+	// ModelPath and ClassDictPath are the files of the primary model. With
+	// ARTIFACTS_DIR set, relative ONNX_MODEL_PATH, CLASS_DICTIONARY_PATH and
+	// LABEL_MAP_PATH values and MODELS_FILE paths are resolved against it,
+	// and the model and class dictionary default to its model.onnx and
+	// classes.json.
 	ModelPath     string
 	ClassDictPath string
-	DBConfig      DBConfig
-	RestMode      bool
+	// LabelMapPath is the optional LABEL_MAP_PATH of the primary model,
+	// merging its classes into coarser reported labels.
+	LabelMapPath string
+	// ModelsFile is the MODELS_FILE the named models were read from, or
+	// empty when only the ONNX_MODEL_PATH model is served.
+	ModelsFile string
+	// Models maps each served model name, matched against the request
+	// image_type, to its files.
+	Models map[string]ModelSpec
+	// PrimaryModel serves requests whose image_type names no model.
+	PrimaryModel string
+	// ModelConfig holds the ONNX_* overrides, applied to every model; unset
+	// fields are detected from each model file.
+	ModelConfig model.ModelConfig
+	// InferenceTimeout bounds each inference call; 0 disables the limit.
+	InferenceTimeout time.Duration
+	// DefaultTopK is the number of predictions returned when a request does
+	// not set top_k.
+	DefaultTopK int
+	// ReviewThreshold flags analyses whose top confidence is below it as
+	// needing review, with ReviewMessage as advice; 0 disables the flag.
+	ReviewThreshold float32
+	ReviewMessage   string
+	// PoolSize is the number of model instances used for concurrent inference.
+	PoolSize int
+	DBConfig DBConfig
+	// Transports lists the servers to start: "grpc", "rest" or both.
+	Transports []string
+	GRPCPort   int
+	RESTPort   int
+	// GRPCReflection registers the gRPC server reflection service so tools
+	// such as grpcurl can discover SkinAnalysisService without the .proto
+	// file. Off by default; enable it with GRPC_REFLECTION=true outside
+	// production.
+	GRPCReflection bool
+	// MaxUploadBytes caps the size of each multipart image upload and of the
+	// image reassembled from a gRPC stream.
+	MaxUploadBytes int64
+	// MaxBase64BodyBytes caps the body size of /analyze-skin/base64 and
+	// /predict.
+	MaxBase64BodyBytes int
+	// Preprocess controls image resizing. Its Layout, Width and Height are
+	// filled in from the loaded model. Transparent pixels are composited
+	// over PREPROCESS_BACKGROUND_COLOR, white by default. PREPROCESS_QUALITY
+	// (fast, the default, or accurate) is the quality profile of requests
+	// that do not choose one. With STORE_IMAGES=true, each analyzed upload
+	// is also re-encoded without metadata and stored with its chronic
+	// record; the original bytes are never stored.
+	Preprocess api.PreprocessConfig
+	// Normalization holds the raw PREPROCESS_NORMALIZATION, PREPROCESS_MEAN
+	// and PREPROCESS_STD values. They are validated by the startup
+	// self-check; Preprocess.Normalization falls back to the defaults for
+	// values that are invalid.
+	Normalization NormalizationSettings
+	// APIKeys are the keys accepted in the X-API-Key header of REST requests.
+	// When empty, the REST endpoints are unauthenticated.
+	APIKeys []string
+	// AdminAPIKeys are the keys accepted on the /admin endpoints and GET
+	// /analyses/export. When empty, those endpoints are not registered.
+	AdminAPIKeys []string
+	// AllowedOrigins are the browser origins allowed to call the REST API
+	// cross-origin. When empty, no CORS headers are sent and browsers only
+	// allow same-origin requests.
+	AllowedOrigins []string
+	// ResponseCase names the fields of REST responses: "snake", the default,
+	// or "camel" (RESPONSE_CASE), e.g. analysis_id or analysisId. Request
+	// bodies are always read in snake_case.
+	ResponseCase string
+	// RateLimitPerMinute caps the REST requests one client may make per
+	// minute; 0 disables rate limiting.
+	RateLimitPerMinute int
+	// MaxConcurrentInferences caps the analyses running at once; requests
+	// beyond it wait in a queue of InferenceQueueDepth for at most
+	// InferenceQueueTimeout and are otherwise rejected with 503/Unavailable.
+	// MAX_CONCURRENT_INFERENCES defaults to the pool size and
+	// INFERENCE_QUEUE_DEPTH to MaxConcurrentInferences; a depth of 0 rejects
+	// excess requests at once, and -1 explicitly disables the limiter.
+	MaxConcurrentInferences int
+	InferenceQueueDepth     int
+	InferenceQueueTimeout   time.Duration
+	// ReservedInferences keeps part of MaxConcurrentInferences for each
+	// transport (INFERENCE_RESERVED_REST, INFERENCE_RESERVED_GRPC), so a
+	// flood on one cannot starve the other. When both transports run, each
+	// reserves a quarter of the slots by default. The queue depth applies
+	// to each transport separately.
+	ReservedInferences map[string]int
+	// AnalysisCacheSize is the number of analyses kept in the cache of
+	// repeated uploads, for at most AnalysisCacheTTL; 0, the default,
+	// disables the cache.
+	AnalysisCacheSize int
+	AnalysisCacheTTL  time.Duration
+	// Artifacts fetches models and class dictionaries given as http(s),
+	// s3:// or gs:// URLs. Class dictionaries are cached under
+	// REMOTE_CACHE_DIR; models are downloaded to a temporary file.
+	Artifacts artifact.Fetcher
+	// SkipWarmup skips the warm-up inference run on each model instance at startup.
+	SkipWarmup bool
+	// SelfCheckWarnOnly logs startup self-check problems instead of aborting.
+	SelfCheckWarnOnly bool
+	// EventSink is where the event of each analysis is stored, from
+	// EVENT_SINK: "db", the default, saves it as a chronic record, and
+	// "stdout" writes it as a JSON line next to the logs instead. The
+	// stdout sink runs without a database: the DB_* settings are not
+	// required, readiness does not ping it, and the endpoints reading
+	// stored analyses, including POST /analyze-skin/async, are not
+	// registered.
+	EventSink string
+	// DeadLetterPath is a file chronic records are appended to, as JSON
+	// lines, when they still cannot be saved after retrying. When empty,
+	// such records are only logged.
+	DeadLetterPath string
+	// Retention is how long chronic records and their images are kept,
+	// from RETENTION_DAYS; older ones are purged at startup and then every
+	// retentionInterval. 0, the default, keeps them forever.
+	Retention time.Duration
+}
+
+// ModelSpec is one entry of MODELS_FILE.
+type ModelSpec struct {
+	ModelPath     string `json:"model_path"`
+	ClassDictPath string `json:"class_dictionary_path"`
+	// LabelMapPath is optional, see service.ParseLabelMap.
+	LabelMapPath string `json:"label_map_path,omitempty"`
+	// SHA256 optionally pins the model file: every load of the model,
+	// including reloads, fails unless the file has this digest.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// loadModelSpecs reads a MODELS_FILE, a JSON object mapping model names to
+// their model and class dictionary paths and optional label map, e.g.
+//
+//	{"face": {"model_path": "./models/face.onnx", "class_dictionary_path": "./models/face.json"}}
+func loadModelSpecs(path string) (map[string]ModelSpec, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MODELS_FILE: %v", err)
+	}
+
+	var specs map[string]ModelSpec
+	if err := json.Unmarshal(content, &specs); err != nil {
+		return nil, fmt.Errorf("failed to parse MODELS_FILE %s: %v", path, err)
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("MODELS_FILE %s defines no models", path)
+	}
+	for name, spec := range specs {
+		if name == "" || spec.ModelPath == "" || spec.ClassDictPath == "" {
+			return nil, fmt.Errorf("MODELS_FILE %s: model %q needs a name, model_path and class_dictionary_path", path, name)
+		}
+	}
+	return specs, nil
+}
+
+// defaultArtifactsDir holds the artifacts when ARTIFACTS_DIR is not set.
+const defaultArtifactsDir = "./models"
+
+// resolveArtifactPath resolves an artifact path against ARTIFACTS_DIR:
+// relative paths are joined to dir, while absolute paths and remote URLs
+// are used as is. An empty path stands for the file named defaultName in
+// dir, or in ./models when dir is not set either.
+func resolveArtifactPath(dir, path, defaultName string) string {
+	switch {
+	case path == "":
+		if dir == "" {
+			dir = defaultArtifactsDir
+		}
+		return filepath.Join(dir, defaultName)
+	case dir == "" || filepath.IsAbs(path) || artifact.IsRemote(path):
+		return path
+	}
+	return filepath.Join(dir, path)
 }
 
 type DBConfig struct {
@@ -40,70 +254,857 @@ type DBConfig struct {
 	Password string
 	Name     string
 	Port     string
+	// SSLMode is the libpq sslmode of the connection, e.g. "require" or
+	// "verify-full" for managed databases.
+	SSLMode string
+	// SSLRootCert is the CA certificate file used to verify the server in
+	// the verify-ca and verify-full modes; empty uses the system roots.
+	SSLRootCert string
+	// SkipAutoMigrate disables GORM AutoMigrate for environments where the
+	// schema is managed externally.
+	SkipAutoMigrate bool
+	// MaxOpenConns and MaxIdleConns size the connection pool; 0 means no
+	// limit for MaxOpenConns and no idle connections for MaxIdleConns.
+	MaxOpenConns int
+	MaxIdleConns int
+	// ConnMaxLifetime closes connections older than it, so connections
+	// dropped by a proxy or failover are not reused; 0 keeps them forever.
+	ConnMaxLifetime time.Duration
+}
+
+// sslModes lists the sslmode values accepted in DB_SSLMODE.
+var sslModes = map[string]bool{
+	"disable":     true,
+	"allow":       true,
+	"prefer":      true,
+	"require":     true,
+	"verify-ca":   true,
+	"verify-full": true,
+}
+
+// logLevel is the minimum level of the default logger. Loggers are set up
+// before the configuration is read, so it starts at info and is raised or
+// lowered to LOG_LEVEL once loadConfig succeeds.
+var logLevel slog.LevelVar
+
+// Connection pool defaults, sized for a single small instance well below
+// the default Postgres max_connections of 100.
+const (
+	defaultDBMaxOpenConns    = 10
+	defaultDBMaxIdleConns    = 5
+	defaultDBConnMaxLifetime = 30 * time.Minute
+)
+
+// defaultReviewThreshold is the top confidence below which an analysis is
+// flagged for review unless REVIEW_CONFIDENCE_THRESHOLD is set.
+const defaultReviewThreshold = 0.5
+
+// loadEnvFile loads variables from ENV_FILE, or ./.env when ENV_FILE is
+// unset, without overriding variables already in the environment. A missing
+// ./.env is normal in containers and only logged; a missing ENV_FILE or an
+// unparsable file is an error.
+func loadEnvFile() error {
+	path := os.Getenv("ENV_FILE")
+	explicit := path != ""
+	if !explicit {
+		path = ".env"
+	}
+
+	err := godotenv.Load(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		log.Printf("No %s file found, using environment variables only", path)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load env file %s: %v", path, err)
+	}
+
+	log.Printf("Loaded environment from %s", path)
+	return nil
 }
 
 func loadConfig() (*Config, error) {
-	_ = godotenv.Load()
+	if err := loadEnvFile(); err != nil {
+		return nil, err
+	}
+
+	artifactsDir := os.Getenv("ARTIFACTS_DIR")
+	modelPath := resolveArtifactPath(artifactsDir, os.Getenv("ONNX_MODEL_PATH"), "model.onnx")
+	classDictPath := resolveArtifactPath(artifactsDir, os.Getenv("CLASS_DICTIONARY_PATH"), "classes.json")
+	labelMapPath := os.Getenv("LABEL_MAP_PATH")
+	if labelMapPath != "" {
+		labelMapPath = resolveArtifactPath(artifactsDir, labelMapPath, "")
+	}
+
+	models := map[string]ModelSpec{
+		service.DefaultModel: {
+			ModelPath:     modelPath,
+			ClassDictPath: classDictPath,
+			LabelMapPath:  labelMapPath,
+			SHA256:        os.Getenv("MODEL_SHA256"),
+		},
+	}
+	primaryModel := service.DefaultModel
+	modelsFile := os.Getenv("MODELS_FILE")
+	if modelsFile != "" {
+		specs, err := loadModelSpecs(modelsFile)
+		if err != nil {
+			return nil, err
+		}
+		for name, spec := range specs {
+			spec.ModelPath = resolveArtifactPath(artifactsDir, spec.ModelPath, "")
+			spec.ClassDictPath = resolveArtifactPath(artifactsDir, spec.ClassDictPath, "")
+			if spec.LabelMapPath != "" {
+				spec.LabelMapPath = resolveArtifactPath(artifactsDir, spec.LabelMapPath, "")
+			}
+			specs[name] = spec
+		}
+		models = specs
+
+		primaryModel = os.Getenv("PRIMARY_MODEL")
+		if primaryModel == "" && len(models) == 1 {
+			for name := range models {
+				primaryModel = name
+			}
+		}
+		primary, ok := models[primaryModel]
+		if !ok {
+			return nil, fmt.Errorf("PRIMARY_MODEL %q is not defined in MODELS_FILE %s", primaryModel, modelsFile)
+		}
+		modelPath, classDictPath, labelMapPath = primary.ModelPath, primary.ClassDictPath, primary.LabelMapPath
+	}
+
+	var level slog.Level
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if err := level.UnmarshalText([]byte(v)); err != nil {
+			return nil, fmt.Errorf("invalid LOG_LEVEL %q: must be debug, info, warn or error", v)
+		}
+	}
+
+	var modelConfig model.ModelConfig
+	if name := os.Getenv("ONNX_INPUT_NAME"); name != "" {
+		modelConfig.InputNames = []string{name}
+	}
+	if name := os.Getenv("ONNX_OUTPUT_NAME"); name != "" {
+		modelConfig.OutputNames = []string{name}
+	}
+	if v := os.Getenv("ONNX_INPUT_SHAPE"); v != "" {
+		shape, err := parseShape(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ONNX_INPUT_SHAPE: %v", err)
+		}
+		modelConfig.InputShape = shape
+	}
+	if v := os.Getenv("ONNX_OUTPUT_SHAPE"); v != "" {
+		shape, err := parseShape(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ONNX_OUTPUT_SHAPE: %v", err)
+		}
+		modelConfig.OutputShape = shape
+	}
+
+	if v := os.Getenv("ONNX_INPUT_LAYOUT"); v != "" {
+		modelConfig.Layout = model.Layout(strings.ToUpper(v))
+	}
+	modelConfig.ApplySoftmax = os.Getenv("ONNX_APPLY_SOFTMAX") == "true"
+	if v := os.Getenv("ONNX_OUTPUT_ACTIVATION"); v != "" {
+		modelConfig.OutputActivation = model.Activation(strings.ToLower(v))
+	}
+	if v := os.Getenv("ONNX_MULTI_LABEL_THRESHOLD"); v != "" {
+		f, err := strconv.ParseFloat(v, 32)
+		if err != nil || f <= 0 || f > 1 {
+			return nil, fmt.Errorf("invalid ONNX_MULTI_LABEL_THRESHOLD %q: must be a number in (0, 1]", v)
+		}
+		modelConfig.MultiLabelThreshold = float32(f)
+	}
+	if v := os.Getenv("ONNX_EXECUTION_PROVIDER"); v != "" {
+		modelConfig.ExecutionProvider = model.ExecutionProvider(strings.ToLower(v))
+	}
+
+	inferenceTimeout := 10 * time.Second
+	if v := os.Getenv("INFERENCE_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid INFERENCE_TIMEOUT %q: must be a duration such as 5s", v)
+		}
+		inferenceTimeout = d
+	}
+
+	poolSize := runtime.NumCPU()
+	if v := os.Getenv("POOL_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid POOL_SIZE %q: must be a positive integer", v)
+		}
+		poolSize = n
+	}
+
+	// With several instances in the pool, each session defaults to a single
+	// thread so the pool as a whole does not oversubscribe the CPU.
+	defaultThreads := 0
+	if poolSize > 1 {
+		defaultThreads = 1
+	}
+	// A thread count of 0 keeps the runtime default.
+	intraOpThreads, err := parseNonNegativeInt("ONNX_INTRA_OP_THREADS", defaultThreads)
+	if err != nil {
+		return nil, err
+	}
+	interOpThreads, err := parseNonNegativeInt("ONNX_INTER_OP_THREADS", defaultThreads)
+	if err != nil {
+		return nil, err
+	}
+	modelConfig.IntraOpThreads = intraOpThreads
+	modelConfig.InterOpThreads = interOpThreads
+
+	transports, err := parseTransports(os.Getenv("TRANSPORTS"), os.Getenv("REST_MODE") == "true")
+	if err != nil {
+		return nil, err
+	}
+
+	grpcPort, err := parsePort("GRPC_PORT", 8008)
+	if err != nil {
+		return nil, err
+	}
+	restPort, err := parsePort("REST_PORT", 8088)
+	if err != nil {
+		return nil, err
+	}
+
+	maxUploadBytes := int64(4 * 1024 * 1024)
+	if v := os.Getenv("MAX_UPLOAD_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid MAX_UPLOAD_BYTES: %q", v)
+		}
+		maxUploadBytes = n
+	}
+
+	maxBase64BodyBytes := 4 * 1024 * 1024
+	if v := os.Getenv("MAX_BASE64_BODY_BYTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid MAX_BASE64_BODY_BYTES: %q", v)
+		}
+		maxBase64BodyBytes = n
+	}
+
+	resizeMode, err := api.ParseResizeMode(strings.ToLower(os.Getenv("PREPROCESS_RESIZE_MODE")))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PREPROCESS_RESIZE_MODE: %v", err)
+	}
+	quality, err := api.ParseQualityProfile(strings.ToLower(os.Getenv("PREPROCESS_QUALITY")))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PREPROCESS_QUALITY: %v", err)
+	}
+	padColor := color.RGBA{A: 255}
+	if v := os.Getenv("PREPROCESS_PAD_COLOR"); v != "" {
+		padColor, err = parseColor(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PREPROCESS_PAD_COLOR: %v", err)
+		}
+	}
+
+	background := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	if v := os.Getenv("PREPROCESS_BACKGROUND_COLOR"); v != "" {
+		background, err = parseColor(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PREPROCESS_BACKGROUND_COLOR: %v", err)
+		}
+	}
+
+	normalizationSettings := NormalizationSettings{
+		Mode: os.Getenv("PREPROCESS_NORMALIZATION"),
+		Mean: os.Getenv("PREPROCESS_MEAN"),
+		Std:  os.Getenv("PREPROCESS_STD"),
+	}
+	// Problems are reported by SelfCheck along with the model checks.
+	normalization, _ := normalizationSettings.parse()
+
+	// 0 accepts images of any size.
+	minImageDimension, err := parseNonNegativeInt("MIN_IMAGE_DIMENSION", api.DefaultMinImageDimension)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys are rotated by changing API_KEYS and restarting; no rebuild is needed.
+	apiKeys := parseList(os.Getenv("API_KEYS"))
+	adminAPIKeys := parseList(os.Getenv("ADMIN_API_KEYS"))
+	allowedOrigins := parseList(os.Getenv("ALLOWED_ORIGINS"))
 
-	modelPath := os.Getenv("ONNX_MODEL_PATH")
-	if modelPath == "" {
-		modelPath = "./models/model.onnx"
+	rateLimitPerMinute := 60
+	if v := os.Getenv("RATE_LIMIT_PER_MINUTE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid RATE_LIMIT_PER_MINUTE %q: must be a non-negative integer", v)
+		}
+		rateLimitPerMinute = n
+	}
+
+	maxConcurrentInferences := poolSize
+	if v := os.Getenv("MAX_CONCURRENT_INFERENCES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid MAX_CONCURRENT_INFERENCES %q: must be a positive integer", v)
+		}
+		maxConcurrentInferences = n
+	}
+
+	// Up to one request per slot waits by default, so short bursts queue
+	// instead of failing.
+	inferenceQueueDepth := maxConcurrentInferences
+	if v := os.Getenv("INFERENCE_QUEUE_DEPTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("invalid INFERENCE_QUEUE_DEPTH %q: must be a non-negative integer, or -1 to disable the limiter", v)
+		}
+		inferenceQueueDepth = n
+	}
+
+	defaultReserved := 0
+	if len(transports) > 1 {
+		defaultReserved = maxConcurrentInferences / 4
+	}
+	reservedREST, err := parseNonNegativeInt("INFERENCE_RESERVED_REST", defaultReserved)
+	if err != nil {
+		return nil, err
+	}
+	reservedGRPC, err := parseNonNegativeInt("INFERENCE_RESERVED_GRPC", defaultReserved)
+	if err != nil {
+		return nil, err
+	}
+	if reserved := reservedREST + reservedGRPC; reserved > maxConcurrentInferences {
+		return nil, fmt.Errorf("invalid INFERENCE_RESERVED_REST and INFERENCE_RESERVED_GRPC: %d reserved slots exceed MAX_CONCURRENT_INFERENCES %d", reserved, maxConcurrentInferences)
+	}
+
+	retentionDays, err := parseNonNegativeInt("RETENTION_DAYS", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	analysisCacheSize, err := parseNonNegativeInt("ANALYSIS_CACHE_SIZE", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	analysisCacheTTL := 10 * time.Minute
+	if v := os.Getenv("ANALYSIS_CACHE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid ANALYSIS_CACHE_TTL %q: must be a duration such as 10m", v)
+		}
+		analysisCacheTTL = d
+	}
+
+	inferenceQueueTimeout := 5 * time.Second
+	if v := os.Getenv("INFERENCE_QUEUE_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid INFERENCE_QUEUE_TIMEOUT %q: must be a duration such as 5s", v)
+		}
+		inferenceQueueTimeout = d
+	}
+
+	defaultTopK := service.DefaultTopK
+	if v := os.Getenv("DEFAULT_TOP_K"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid DEFAULT_TOP_K %q: must be a positive integer", v)
+		}
+		defaultTopK = n
 	}
 
-	classDictPath := os.Getenv("CLASS_DICTIONARY_PATH")
-	if classDictPath == "" {
-		classDictPath = "./models/classes.json"
+	reviewThreshold := float32(defaultReviewThreshold)
+	if v := os.Getenv("REVIEW_CONFIDENCE_THRESHOLD"); v != "" {
+		f, err := strconv.ParseFloat(v, 32)
+		if err != nil || f < 0 || f > 1 {
+			return nil, fmt.Errorf("invalid REVIEW_CONFIDENCE_THRESHOLD %q: must be a number between 0 and 1", v)
+		}
+		reviewThreshold = float32(f)
 	}
 
-	restMode := os.Getenv("REST_MODE") == "true"
+	dbMaxOpenConns, err := parseNonNegativeInt("DB_MAX_OPEN_CONNS", defaultDBMaxOpenConns)
+	if err != nil {
+		return nil, err
+	}
+	dbMaxIdleConns, err := parseNonNegativeInt("DB_MAX_IDLE_CONNS", defaultDBMaxIdleConns)
+	if err != nil {
+		return nil, err
+	}
+	dbConnMaxLifetime := defaultDBConnMaxLifetime
+	if v := os.Getenv("DB_CONN_MAX_LIFETIME"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid DB_CONN_MAX_LIFETIME %q: must be a duration such as 30m", v)
+		}
+		dbConnMaxLifetime = d
+	}
+
+	dbSSLMode := os.Getenv("DB_SSLMODE")
+	if dbSSLMode == "" {
+		dbSSLMode = "disable"
+	}
+	if !sslModes[dbSSLMode] {
+		return nil, fmt.Errorf("invalid DB_SSLMODE %q: must be disable, allow, prefer, require, verify-ca or verify-full", dbSSLMode)
+	}
+
+	remoteCacheDir := os.Getenv("REMOTE_CACHE_DIR")
+	if remoteCacheDir == "" {
+		remoteCacheDir = "./cache"
+	}
+	s3Region := os.Getenv("AWS_REGION")
+	if s3Region == "" {
+		s3Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+
+	remoteFetchTimeout := 5 * time.Minute
+	if v := os.Getenv("REMOTE_FETCH_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid REMOTE_FETCH_TIMEOUT %q: must be a duration such as 2m", v)
+		}
+		remoteFetchTimeout = d
+	}
+
+	eventSink := os.Getenv("EVENT_SINK")
+	switch eventSink {
+	case "":
+		eventSink = eventSinkDB
+	case eventSinkDB, eventSinkStdout:
+	default:
+		return nil, fmt.Errorf("invalid EVENT_SINK %q: must be db or stdout", eventSink)
+	}
+
+	responseCase := os.Getenv("RESPONSE_CASE")
+	switch responseCase {
+	case "":
+		responseCase = api.ResponseCaseSnake
+	case api.ResponseCaseSnake, api.ResponseCaseCamel:
+	default:
+		return nil, fmt.Errorf("invalid RESPONSE_CASE %q: must be snake or camel", responseCase)
+	}
+
+	skipWarmup := os.Getenv("SKIP_WARMUP") == "true"
+	selfCheckWarnOnly := os.Getenv("SELF_CHECK_WARN_ONLY") == "true"
 
 	return &Config{
-		ModelPath:     modelPath,
-		ClassDictPath: classDictPath,
-		RestMode:      restMode,
+		LogLevel:           level,
+		ModelPath:          modelPath,
+		ClassDictPath:      classDictPath,
+		LabelMapPath:       labelMapPath,
+		ModelsFile:         modelsFile,
+		Models:             models,
+		PrimaryModel:       primaryModel,
+		ModelConfig:        modelConfig,
+		InferenceTimeout:   inferenceTimeout,
+		DefaultTopK:        defaultTopK,
+		ReviewThreshold:    reviewThreshold,
+		ReviewMessage:      os.Getenv("REVIEW_MESSAGE"),
+		PoolSize:           poolSize,
+		Transports:         transports,
+		GRPCPort:           grpcPort,
+		RESTPort:           restPort,
+		GRPCReflection:     os.Getenv("GRPC_REFLECTION") == "true",
+		MaxUploadBytes:     maxUploadBytes,
+		MaxBase64BodyBytes: maxBase64BodyBytes,
+		Preprocess: api.PreprocessConfig{
+			ResizeMode:    resizeMode,
+			Quality:       quality,
+			PadColor:      padColor,
+			Background:    background,
+			Normalization: normalization,
+			MinDimension:  minImageDimension,
+			StoreImages:   os.Getenv("STORE_IMAGES") == "true",
+		},
+		Normalization:           normalizationSettings,
+		APIKeys:                 apiKeys,
+		AdminAPIKeys:            adminAPIKeys,
+		AllowedOrigins:          allowedOrigins,
+		ResponseCase:            responseCase,
+		RateLimitPerMinute:      rateLimitPerMinute,
+		MaxConcurrentInferences: maxConcurrentInferences,
+		InferenceQueueDepth:     inferenceQueueDepth,
+		InferenceQueueTimeout:   inferenceQueueTimeout,
+		ReservedInferences:      map[string]int{transportREST: reservedREST, transportGRPC: reservedGRPC},
+		AnalysisCacheSize:       analysisCacheSize,
+		AnalysisCacheTTL:        analysisCacheTTL,
+		Artifacts: artifact.Fetcher{
+			CacheDir: remoteCacheDir,
+			Timeout:  remoteFetchTimeout,
+			S3: artifact.S3Config{
+				Region:          s3Region,
+				Endpoint:        os.Getenv("S3_ENDPOINT"),
+				AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+				SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+				SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+			},
+			GCSToken: os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"),
+		},
+		SkipWarmup:        skipWarmup,
+		SelfCheckWarnOnly: selfCheckWarnOnly,
+		EventSink:         eventSink,
+		DeadLetterPath:    os.Getenv("DEAD_LETTER_PATH"),
+		Retention:         time.Duration(retentionDays) * 24 * time.Hour,
 		DBConfig: DBConfig{
-			Host:     os.Getenv("DB_HOST"),
-			User:     os.Getenv("DB_USER"),
-			Password: os.Getenv("DB_PASSWORD"),
-			Name:     os.Getenv("DB_NAME"),
-			Port:     os.Getenv("DB_PORT"),
+			Host:            os.Getenv("DB_HOST"),
+			User:            os.Getenv("DB_USER"),
+			Password:        os.Getenv("DB_PASSWORD"),
+			Name:            os.Getenv("DB_NAME"),
+			Port:            os.Getenv("DB_PORT"),
+			SSLMode:         dbSSLMode,
+			SSLRootCert:     os.Getenv("DB_SSLROOTCERT"),
+			SkipAutoMigrate: os.Getenv("SKIP_AUTOMIGRATE") == "true",
+			MaxOpenConns:    dbMaxOpenConns,
+			MaxIdleConns:    dbMaxIdleConns,
+			ConnMaxLifetime: dbConnMaxLifetime,
 		},
 	}, nil
 }
 
-func loadClassDictionary(path string) ([]string, error) {
-	classesFile, err := os.ReadFile(path)
+// Validate reports every missing required setting at once: the database
+// connection fields, the model and class dictionary files of every model
+// and the database CA certificate, when set. The database settings are
+// only required with the db event sink.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.EventSink == eventSinkDB {
+		required := []struct {
+			name  string
+			value string
+		}{
+			{"DB_HOST", c.DBConfig.Host},
+			{"DB_USER", c.DBConfig.User},
+			{"DB_PASSWORD", c.DBConfig.Password},
+			{"DB_NAME", c.DBConfig.Name},
+		}
+		for _, r := range required {
+			if r.value == "" {
+				errs = append(errs, fmt.Errorf("%s is not set", r.name))
+			}
+		}
+	}
+
+	type file struct {
+		name string
+		path string
+	}
+	var files []file
+	if c.ModelsFile == "" {
+		files = []file{
+			{"ONNX_MODEL_PATH", c.ModelPath},
+			{"CLASS_DICTIONARY_PATH", c.ClassDictPath},
+		}
+		if c.LabelMapPath != "" {
+			files = append(files, file{"LABEL_MAP_PATH", c.LabelMapPath})
+		}
+	} else {
+		for _, name := range sortedModelNames(c.Models) {
+			spec := c.Models[name]
+			files = append(files,
+				file{fmt.Sprintf("MODELS_FILE %s model_path", name), spec.ModelPath},
+				file{fmt.Sprintf("MODELS_FILE %s class_dictionary_path", name), spec.ClassDictPath},
+			)
+			if spec.LabelMapPath != "" {
+				files = append(files, file{fmt.Sprintf("MODELS_FILE %s label_map_path", name), spec.LabelMapPath})
+			}
+		}
+	}
+	if c.EventSink == eventSinkDB && c.DBConfig.SSLRootCert != "" {
+		files = append(files, file{"DB_SSLROOTCERT", c.DBConfig.SSLRootCert})
+	}
+	for _, f := range files {
+		// Remote artifacts are checked when they are fetched.
+		if artifact.IsRemote(f.path) {
+			continue
+		}
+		info, err := os.Stat(f.path)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("%s %q: %v", f.name, f.path, err))
+		case info.IsDir():
+			errs = append(errs, fmt.Errorf("%s %q is a directory, expected a file", f.name, f.path))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid configuration:\n%v", err)
+	}
+	return nil
+}
+
+// parseTransports parses a comma-separated TRANSPORTS value such as
+// "grpc,rest". When it is empty, the legacy REST_MODE flag selects a single
+// transport: REST when set, gRPC otherwise.
+func parseTransports(value string, restMode bool) ([]string, error) {
+	if value == "" {
+		if restMode {
+			return []string{transportREST}, nil
+		}
+		return []string{transportGRPC}, nil
+	}
+
+	var transports []string
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(value, ",") {
+		transport := strings.ToLower(strings.TrimSpace(part))
+		if transport != transportGRPC && transport != transportREST {
+			return nil, fmt.Errorf("invalid TRANSPORTS entry %q: expected %q or %q", part, transportGRPC, transportREST)
+		}
+		if !seen[transport] {
+			seen[transport] = true
+			transports = append(transports, transport)
+		}
+	}
+
+	return transports, nil
+}
+
+// parseList splits a comma-separated list, trimming entries and dropping
+// empty ones.
+func parseList(value string) []string {
+	var items []string
+	for _, part := range strings.Split(value, ",") {
+		if item := strings.TrimSpace(part); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parsePort reads a TCP port from the named environment variable, falling
+// back to def when it is unset.
+func parsePort(name string, def int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+
+	port, err := strconv.Atoi(v)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid %s %q: must be a port number between 1 and 65535", name, v)
+	}
+
+	return port, nil
+}
+
+// parseNonNegativeInt reads a count such as an ONNX Runtime thread count
+// from the named environment variable, falling back to def when it is unset.
+func parseNonNegativeInt(name string, def int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be a non-negative integer", name, v)
+	}
+
+	return n, nil
+}
+
+// NormalizationSettings are the PREPROCESS_NORMALIZATION mode and, for the
+// imagenet mode, the optional PREPROCESS_MEAN and PREPROCESS_STD overrides
+// of the ImageNet channel statistics, as set in the environment.
+type NormalizationSettings struct {
+	Mode string
+	Mean string
+	Std  string
+}
+
+// parse returns the normalization described by s and every problem with
+// it. An invalid value is replaced by its default in the result.
+func (s NormalizationSettings) parse() (api.Normalization, []error) {
+	var problems []error
+
+	mode, err := api.ParseNormalizationMode(strings.ToLower(s.Mode))
+	if err != nil {
+		problems = append(problems, fmt.Errorf("invalid PREPROCESS_NORMALIZATION: %v", err))
+		mode = api.NormalizeZeroOne
+	}
+
+	normalization := api.Normalization{Mode: mode, Mean: api.ImageNetMean, Std: api.ImageNetStd}
+	if s.Mean != "" {
+		if mean, err := parseChannelValues(s.Mean); err != nil {
+			problems = append(problems, fmt.Errorf("invalid PREPROCESS_MEAN: %v", err))
+		} else {
+			normalization.Mean = mean
+		}
+	}
+	if s.Std != "" {
+		std, err := parseChannelValues(s.Std)
+		if err == nil {
+			for i, v := range std {
+				if v <= 0 {
+					err = fmt.Errorf("channel %d must be positive", i)
+					break
+				}
+			}
+		}
+		if err != nil {
+			problems = append(problems, fmt.Errorf("invalid PREPROCESS_STD: %v", err))
+		} else {
+			normalization.Std = std
+		}
+	}
+
+	return normalization, problems
+}
+
+// parseChannelValues parses three comma-separated floats, one per RGB channel.
+func parseChannelValues(value string) ([3]float32, error) {
+	var values [3]float32
+	parts := strings.Split(value, ",")
+	if len(parts) != 3 {
+		return values, fmt.Errorf("expected 3 comma-separated values, got %q", value)
+	}
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 32)
+		if err != nil {
+			return values, fmt.Errorf("invalid value %q", part)
+		}
+		values[i] = float32(v)
+	}
+	return values, nil
+}
+
+// parseColor parses an opaque color written as "r,g,b" with components 0-255.
+func parseColor(value string) (color.RGBA, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 3 {
+		return color.RGBA{}, fmt.Errorf("expected r,g,b, got %q", value)
+	}
+	var rgb [3]uint8
+	for i, part := range parts {
+		c, err := strconv.ParseUint(strings.TrimSpace(part), 10, 8)
+		if err != nil {
+			return color.RGBA{}, fmt.Errorf("invalid color component %q: must be 0-255", part)
+		}
+		rgb[i] = uint8(c)
+	}
+	return color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 255}, nil
+}
+
+// parseShape parses a comma-separated list of dimensions such as "1,180,180,3".
+func parseShape(value string) ([]int64, error) {
+	parts := strings.Split(value, ",")
+	shape := make([]int64, len(parts))
+	for i, part := range parts {
+		d, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("dimension %q is not an integer", part)
+		}
+		shape[i] = d
+	}
+	return shape, nil
+}
+
+// loadClassDictionary reads a class dictionary from a local file or an
+// http(s) URL, see artifact.Fetcher.
+func loadClassDictionary(ctx context.Context, path string, fetcher *artifact.Fetcher) ([]service.ClassInfo, error) {
+	classesFile, err := fetcher.ReadFile(ctx, path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read class dictionary: %v", err)
 	}
 
-	var classDict []string
-	if err := json.Unmarshal(classesFile, &classDict); err != nil {
+	classDict, err := service.ParseClassDictionary(classesFile)
+	if err != nil {
 		return nil, fmt.Errorf("failed to parse class dictionary: %v", err)
 	}
 
 	return classDict, nil
 }
 
+// loadLabelMap reads the label groups of a model, or none when path is empty.
+func loadLabelMap(path string) ([]service.LabelGroup, error) {
+	if path == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read label map: %v", err)
+	}
+
+	groups, err := service.ParseLabelMap(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse label map %s: %v", path, err)
+	}
+
+	return groups, nil
+}
+
+// initDB opens the connection pool without connecting, so an unreachable
+// database is reported by the startup self-check rather than here.
+// Migrations are run separately by migrateDB once the self-check passed.
 func initDB(config DBConfig) (*gorm.DB, error) {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		config.Host, config.User, config.Password, config.Name, config.Port)
+	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
+		config.Host, config.User, config.Password, config.Name, config.Port, config.SSLMode)
+	if config.SSLRootCert != "" {
+		dsn += " sslrootcert=" + config.SSLRootCert
+	}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{DisableAutomaticPing: true})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %v", err)
 	}
 
-	if err := db.AutoMigrate(&data.Chronic{}); err != nil {
-		return nil, fmt.Errorf("failed to migrate database: %v", err)
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to access database pool: %v", err)
 	}
+	sqlDB.SetMaxOpenConns(config.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(config.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(config.ConnMaxLifetime)
+	log.Printf("Database pool: max_open=%d max_idle=%d conn_max_lifetime=%v",
+		config.MaxOpenConns, config.MaxIdleConns, config.ConnMaxLifetime)
 
 	return db, nil
 }
 
-func startChronicEventProcessor(ctx context.Context, repository *data.ChronicRepository, events chan event.Event) {
+// migrateDB runs the database migrations unless SKIP_AUTOMIGRATE is set.
+func migrateDB(db *gorm.DB, config DBConfig) error {
+	if config.SkipAutoMigrate {
+		log.Println("SKIP_AUTOMIGRATE is set, skipping database migrations")
+		return nil
+	}
+	return migrate(db)
+}
+
+// migrationModels lists every model managed by AutoMigrate, in migration order.
+var migrationModels = []any{
+	&data.Chronic{},
+	&data.ChronicImage{},
+}
+
+// migrate runs AutoMigrate one model at a time so a failure names the model
+// and table involved, along with the Postgres error details when available.
+func migrate(db *gorm.DB) error {
+	for _, m := range migrationModels {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(m); err != nil {
+			return fmt.Errorf("failed to parse model %T for migration: %v", m, err)
+		}
+		table := stmt.Schema.Table
+
+		if err := db.AutoMigrate(m); err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) {
+				log.Printf("Migration of %T (table %q) failed: code=%s message=%q detail=%q hint=%q column=%q",
+					m, table, pgErr.Code, pgErr.Message, pgErr.Detail, pgErr.Hint, pgErr.ColumnName)
+			}
+			return fmt.Errorf("failed to migrate %T (table %q): %v", m, table, err)
+		}
+		log.Printf("Migrated %T (table %q)", m, table)
+	}
+
+	return nil
+}
+
+func startChronicEventProcessor(ctx context.Context, sink event.Sink, events chan event.Event, deadLetterPath string) {
+	// The channel is never closed: handlers may still be sending while the
+	// servers drain, and a send on a closed channel would panic.
 	go func() {
-		defer close(events)
 		for {
 			select {
 			case <-ctx.Done():
@@ -113,72 +1114,498 @@ func startChronicEventProcessor(ctx context.Context, repository *data.ChronicRep
 				if !ok {
 					return
 				}
-				err := repository.Create(ctx, &data.Chronic{
-					ID:        uuid.New(),
-					Body:      ev.Body,
-					Status:    ev.Status,
-					CreatedAt: time.Now(),
-				})
-				if err != nil {
-					log.Printf("failed to save chronic event: %v", err)
-				}
+				persistChronicEvent(ctx, sink, ev, deadLetterPath)
 			}
 		}
 	}()
 }
 
-func startServers(ctx context.Context, inferenceService *service.InferenceService, events chan event.Event, mode bool) error {
-	errChan := make(chan error, 1)
+// retentionInterval is how often records past the retention period are purged.
+const retentionInterval = time.Hour
 
-	if !mode {
-		grpcServer := grpc.NewServer()
-		pb.RegisterSkinAnalysisServiceServer(grpcServer, api.NewSkinAnalysisServer(inferenceService, events))
+// startRetentionJob purges the chronic records older than retention, once
+// at startup and then every retentionInterval, until ctx is cancelled.
+func startRetentionJob(ctx context.Context, repository *data.ChronicRepository, retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(retentionInterval)
+		defer ticker.Stop()
+		for {
+			cutoff := time.Now().Add(-retention)
+			removed, err := repository.DeleteOlderThan(ctx, cutoff)
+			switch {
+			case err != nil && ctx.Err() == nil:
+				log.Printf("Failed to purge chronic records older than %s: %v", cutoff.Format(time.RFC3339), err)
+			case removed > 0:
+				log.Printf("Purged %d chronic records older than %s", removed, cutoff.Format(time.RFC3339))
+			}
 
-		lis, err := net.Listen("tcp", ":8008")
-		if err != nil {
-			return fmt.Errorf("failed to listen: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
 		}
+	}()
+}
 
-		go func() {
-			log.Printf("Starting gRPC server on :8008")
-			if err := grpcServer.Serve(lis); err != nil {
-				errChan <- fmt.Errorf("failed to serve gRPC: %v", err)
+// persistChronicEvent stores ev in sink, in a span continuing the trace of
+// the request that produced it.
+func persistChronicEvent(ctx context.Context, sink event.Sink, ev event.Event, deadLetterPath string) {
+	ctx, span := tracing.Tracer().Start(tracing.Extract(ctx, ev.Trace), "persist chronic event")
+	defer span.End()
+
+	logger := slog.With("request_id", ev.RequestID, "analysis_id", ev.Body.AnalysisID)
+	if err := storeWithRetry(ctx, sink, ev, logger); err != nil {
+		logger.Error("failed to save chronic event, dead-lettering it", "error", err, "body", ev.Body)
+		if deadLetterPath != "" {
+			if err := writeDeadLetter(deadLetterPath, ev, err); err != nil {
+				logger.Error("failed to write dead letter", "path", deadLetterPath, "error", err)
 			}
-		}()
+		}
+		return
+	}
+	logger.Debug("chronic event saved", "status", ev.Status)
+}
 
-		go func() {
-			<-ctx.Done()
-			grpcServer.GracefulStop()
-		}()
+// Retry policy of storeWithRetry: up to saveAttempts tries, waiting
+// saveRetryDelay before the second and doubling up to saveRetryMaxDelay.
+const (
+	saveAttempts      = 5
+	saveRetryDelay    = 200 * time.Millisecond
+	saveRetryMaxDelay = 5 * time.Second
+)
 
-	} else {
-		app := fiber.New()
-		app.Post("/analyze-skin", api.HandleFileUpload(inferenceService, events))
+// storeWithRetry stores ev, retrying transient database errors with
+// exponential backoff. Permanent errors are returned at once, and the
+// backoff is cut short when ctx is done.
+func storeWithRetry(ctx context.Context, sink event.Sink, ev event.Event, logger *slog.Logger) error {
+	delay := saveRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := sink.Store(ctx, ev)
+		if err == nil || !data.IsTransient(err) || attempt == saveAttempts {
+			return err
+		}
 
-		go func() {
-			log.Printf("Starting Fiber server on :8088")
-			if err := app.Listen(":8088"); err != nil {
-				errChan <- fmt.Errorf("failed to serve Fiber: %v", err)
-			}
-		}()
+		logger.Warn("failed to save chronic event, retrying",
+			"attempt", attempt, "retry_in", delay.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%v (retry aborted: %v)", err, ctx.Err())
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, saveRetryMaxDelay)
+	}
+}
+
+// deadLetter is one line of the DEAD_LETTER_PATH file: a chronic record
+// that could not be saved, in a form that can be replayed later.
+type deadLetter struct {
+	FailedAt  time.Time       `json:"failed_at"`
+	RequestID string          `json:"request_id,omitempty"`
+	ID        uuid.UUID       `json:"id"`
+	Status    string          `json:"status"`
+	Body      json.RawMessage `json:"body"`
+	CreatedAt time.Time       `json:"created_at"`
+	Error     string          `json:"error"`
+}
+
+// writeDeadLetter appends the chronic record of ev to the dead-letter file
+// as a JSON line.
+func writeDeadLetter(path string, ev event.Event, saveErr error) error {
+	chronic, err := data.NewChronic(ev)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(deadLetter{
+		FailedAt:  time.Now(),
+		RequestID: ev.RequestID,
+		ID:        chronic.ID,
+		Status:    chronic.Status,
+		Body:      json.RawMessage(chronic.Body),
+		CreatedAt: chronic.CreatedAt,
+		Error:     saveErr.Error(),
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Supported values of Config.EventSink.
+const (
+	eventSinkDB     = "db"
+	eventSinkStdout = "stdout"
+)
+
+// Supported values of Config.Transports.
+const (
+	transportGRPC = "grpc"
+	transportREST = "rest"
+)
+
+// startServers launches every configured transport and blocks until one of
+// them fails or ctx is cancelled. On cancellation it waits for all started
+// servers to shut down before returning.
+func startServers(ctx context.Context, config *Config, inferenceService *service.InferenceService, repository *data.ChronicRepository, events chan event.Event, ready api.ReadinessCheck) error {
+	errChan := make(chan error, len(config.Transports))
+	var stopped sync.WaitGroup
 
-		go func() {
-			<-ctx.Done()
-			if err := app.Shutdown(); err != nil {
-				log.Printf("Error shutting down Fiber server: %v", err)
+	// Both transports share one limiter, so the cap applies to their sum
+	// while each keeps its reserved slots.
+	var limiter *api.ConcurrencyLimiter
+	if config.InferenceQueueDepth >= 0 {
+		limiter = api.NewConcurrencyLimiter(config.MaxConcurrentInferences, config.InferenceQueueDepth, config.InferenceQueueTimeout, config.ReservedInferences)
+	}
+
+	var cache *api.AnalysisCache
+	if config.AnalysisCacheSize > 0 {
+		cache = api.NewAnalysisCache(config.AnalysisCacheSize, config.AnalysisCacheTTL)
+	}
+
+	for _, transport := range config.Transports {
+		switch transport {
+		case transportGRPC:
+			if err := startGRPCServer(ctx, &stopped, errChan, config, inferenceService, events, ready, limiter, cache); err != nil {
+				return err
 			}
-		}()
+		case transportREST:
+			startRESTServer(ctx, &stopped, errChan, config, inferenceService, repository, events, ready, limiter, cache)
+		}
 	}
 
 	select {
 	case err := <-errChan:
 		return err
 	case <-ctx.Done():
+		stopped.Wait()
 		return nil
 	}
 }
 
+func startGRPCServer(ctx context.Context, stopped *sync.WaitGroup, errChan chan<- error, config *Config, inferenceService *service.InferenceService, events chan event.Event, ready api.ReadinessCheck, limiter *api.ConcurrencyLimiter, cache *api.AnalysisCache) error {
+	grpcServer := grpc.NewServer(
+		grpc.ChainStreamInterceptor(
+			api.TracingStreamInterceptor(),
+			api.RequestIDStreamInterceptor(),
+			api.MetricsStreamInterceptor(),
+			api.RecoveryStreamInterceptor(events),
+		),
+		grpc.ChainUnaryInterceptor(
+			api.TracingUnaryInterceptor(),
+			api.RequestIDUnaryInterceptor(),
+			api.MetricsUnaryInterceptor(),
+			api.RecoveryUnaryInterceptor(events),
+		),
+	)
+	skinAnalysisServer := api.NewSkinAnalysisServer(inferenceService, events, config.Preprocess, config.MaxUploadBytes)
+	skinAnalysisServer.SetConcurrencyLimiter(limiter)
+	skinAnalysisServer.SetAnalysisCache(cache)
+	pb.RegisterSkinAnalysisServiceServer(grpcServer, skinAnalysisServer)
+
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	go api.WatchGRPCHealth(ctx, healthServer, ready, pb.SkinAnalysisService_ServiceDesc.ServiceName)
+
+	if config.GRPCReflection {
+		reflection.Register(grpcServer)
+		log.Println("gRPC server reflection enabled")
+	}
+
+	addr := fmt.Sprintf(":%d", config.GRPCPort)
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", addr, err)
+	}
+
+	go func() {
+		log.Printf("Starting gRPC server on %s", addr)
+		if err := grpcServer.Serve(lis); err != nil {
+			errChan <- fmt.Errorf("failed to serve gRPC: %v", err)
+		}
+	}()
+
+	stopped.Add(1)
+	go func() {
+		defer stopped.Done()
+		<-ctx.Done()
+		grpcServer.GracefulStop()
+		log.Println("gRPC server stopped")
+	}()
+
+	return nil
+}
+
+func startRESTServer(ctx context.Context, stopped *sync.WaitGroup, errChan chan<- error, config *Config, inferenceService *service.InferenceService, repository *data.ChronicRepository, events chan event.Event, ready api.ReadinessCheck, limiter *api.ConcurrencyLimiter, cache *api.AnalysisCache) {
+	// Bodies are streamed so the batch endpoint can accept more than
+	// BodyLimit; BodyLimitMiddleware enforces the limit of each route.
+	bodyLimit := api.MaxRequestBodyBytes(config.MaxUploadBytes, config.MaxBase64BodyBytes)
+	fiberConfig := fiber.Config{
+		BodyLimit:                    bodyLimit,
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
+		ErrorHandler:                 api.ErrorHandler,
+	}
+	if config.ResponseCase == api.ResponseCaseCamel {
+		fiberConfig.JSONEncoder = api.CamelCaseJSON
+	}
+	app := fiber.New(fiberConfig)
+	app.Use(api.TracingMiddleware())
+	app.Use(api.RequestIDMiddleware())
+	app.Use(api.RecoverMiddleware(events, "/analyze-skin", "/predict"))
+	app.Use(api.BodyLimitMiddleware(bodyLimit, map[string]int{
+		"/analyze-skin/batch": api.MaxBatchBodyBytes(config.MaxUploadBytes),
+	}))
+	// CORS runs before authentication so preflight requests, which carry no
+	// API key, are answered.
+	if len(config.AllowedOrigins) > 0 {
+		app.Use(api.CORSMiddleware(config.AllowedOrigins))
+	}
+	// The admin endpoints are checked against the admin keys instead.
+	unauthenticated := []string{"/healthz", "/readyz"}
+	if len(config.AdminAPIKeys) > 0 {
+		unauthenticated = append(unauthenticated, "/admin/reload", "/analyses/export")
+	}
+	if len(config.APIKeys) > 0 {
+		app.Use(api.APIKeyMiddleware(config.APIKeys, unauthenticated...))
+	} else {
+		log.Println("API_KEYS is not set, REST endpoints are unauthenticated")
+	}
+	if config.RateLimitPerMinute > 0 {
+		app.Use(api.RateLimitMiddleware(config.RateLimitPerMinute, "/healthz", "/readyz"))
+	}
+	app.Get("/healthz", api.HandleHealthz())
+	app.Get("/readyz", api.HandleReadyz(ready))
+	app.Get("/metrics", api.HandleMetrics())
+	app.Get("/version", api.HandleVersion(buildVersion(), inferenceService))
+	app.Use("/analyze-skin", api.MetricsMiddleware())
+	// Asynchronous uploads take their limiter slot in the handler and hold
+	// it until the background analysis ends.
+	limit := api.ConcurrencyMiddleware(limiter)
+	app.Post("/analyze-skin", limit, api.HandleFileUpload(inferenceService, events, config.Preprocess, config.MaxUploadBytes, cache))
+	app.Post("/analyze-skin/batch", limit, api.HandleBatchUpload(inferenceService, events, config.Preprocess, config.MaxUploadBytes))
+	if config.EventSink == eventSinkDB {
+		app.Post("/analyze-skin/async", api.HandleAsyncUpload(inferenceService, repository, events, config.Preprocess, config.MaxUploadBytes, cache, limiter))
+	}
+	app.Post("/analyze-skin/base64", limit, api.HandleBase64Upload(inferenceService, events, config.Preprocess, config.MaxBase64BodyBytes, cache))
+	app.Post("/validate", api.HandleValidateUpload(inferenceService, config.Preprocess, config.MaxUploadBytes))
+	app.Post("/predict", limit, api.HandlePredict(inferenceService, config.MaxBase64BodyBytes))
+	// The stdout sink stores nothing for these endpoints to read.
+	if config.EventSink == eventSinkDB {
+		app.Get("/analyses", api.HandleListAnalyses(repository))
+		// Registered before /analyses/:id, which would match it otherwise.
+		if len(config.AdminAPIKeys) > 0 {
+			app.Get("/analyses/export", api.APIKeyMiddleware(config.AdminAPIKeys), api.HandleExportAnalyses(repository))
+		} else {
+			app.Get("/analyses/export", api.HandleExportDisabled())
+		}
+		app.Get("/analyses/:id", api.HandleGetAnalysis(repository))
+		app.Get("/users/:user_id/analyses", api.HandleListUserAnalyses(repository))
+	}
+	if len(config.AdminAPIKeys) > 0 {
+		app.Post("/admin/reload", api.APIKeyMiddleware(config.AdminAPIKeys), api.HandleReloadModel(inferenceService, &config.Artifacts))
+	} else {
+		log.Println("ADMIN_API_KEYS is not set, POST /admin/reload and GET /analyses/export are disabled")
+	}
+
+	addr := fmt.Sprintf(":%d", config.RESTPort)
+	go func() {
+		log.Printf("Starting Fiber server on %s", addr)
+		if err := app.Listen(addr); err != nil {
+			errChan <- fmt.Errorf("failed to serve Fiber: %v", err)
+		}
+	}()
+
+	stopped.Add(1)
+	go func() {
+		defer stopped.Done()
+		<-ctx.Done()
+		if err := app.Shutdown(); err != nil {
+			log.Printf("Error shutting down Fiber server: %v", err)
+		}
+		log.Println("Fiber server stopped")
+	}()
+}
+
+// resolveModelConfig fills the fields of overrides left unset by the ONNX_*
+// environment variables from the metadata of the model file.
+func resolveModelConfig(path string, overrides model.ModelConfig) (model.ModelConfig, error) {
+	detected, err := model.DetectModelConfig(path)
+	if err != nil {
+		return model.ModelConfig{}, fmt.Errorf("failed to read ONNX model metadata: %v", err)
+	}
+	modelConfig := overrides.WithDefaults(detected)
+	log.Printf("ONNX model input %v %v (%s), output %v %v",
+		modelConfig.InputNames, modelConfig.InputShape, modelConfig.Layout, modelConfig.OutputNames, modelConfig.OutputShape)
+	return modelConfig, nil
+}
+
+// sortedModelNames returns the names of models in a stable order for
+// loading and logging.
+func sortedModelNames(models map[string]ModelSpec) []string {
+	names := make([]string, 0, len(models))
+	for name := range models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadModel loads the class dictionary and the instance pool of one named
+// model and runs the startup self-check on them.
+func loadModel(ctx context.Context, name string, spec ModelSpec, config *Config, sqlDB pinger) (service.ModelSet, error) {
+	classDict, err := loadClassDictionary(ctx, spec.ClassDictPath, &config.Artifacts)
+	if err != nil {
+		return service.ModelSet{}, fmt.Errorf("model %s: %v", name, err)
+	}
+
+	labelGroups, err := loadLabelMap(spec.LabelMapPath)
+	if err != nil {
+		return service.ModelSet{}, fmt.Errorf("model %s: %v", name, err)
+	}
+
+	path, err := fetchModelFile(ctx, spec.ModelPath, config)
+	if err != nil {
+		return service.ModelSet{}, fmt.Errorf("model %s: %v", name, err)
+	}
+	models, err := loadModelPool(name, path, spec.SHA256, config)
+	if err != nil {
+		removeDownloadedModel(path)
+		return service.ModelSet{}, err
+	}
+
+	if err := runSelfCheck(ctx, models[0], classDict, config.Normalization, sqlDB, config.SelfCheckWarnOnly); err != nil {
+		closePredictors(toPredictors(models))
+		removeDownloadedModel(path)
+		return service.ModelSet{}, fmt.Errorf("model %s: %v", name, err)
+	}
+
+	set := service.ModelSet{Path: path, Predictors: toPredictors(models), ClassDict: classDict, LabelGroups: labelGroups}
+	if path != spec.ModelPath {
+		set.Source = spec.ModelPath
+	}
+	return set, nil
+}
+
+// loadModelPool loads config.PoolSize instances of the model at path and
+// warms them up unless SKIP_WARMUP is set. When expectedSHA256 is set the
+// file must have that digest. It is used at startup and by model reloads.
+func loadModelPool(name, path, expectedSHA256 string, config *Config) ([]*model.ONNXModel, error) {
+	modelConfig, err := resolveModelConfig(path, config.ModelConfig)
+	if err != nil {
+		return nil, fmt.Errorf("model %s: %v", name, err)
+	}
+	modelConfig.SHA256 = expectedSHA256
+
+	models, err := model.NewONNXModelPool(path, modelConfig, config.PoolSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ONNX model %s: %v", name, err)
+	}
+	log.Printf("Loaded %d instance(s) of ONNX model %s from %s", len(models), name, path)
+
+	if config.SkipWarmup {
+		log.Printf("SKIP_WARMUP is set, skipping warm-up of model %s", name)
+		return models, nil
+	}
+	for i, m := range models {
+		elapsed, err := m.Warmup()
+		if err != nil {
+			for _, m := range models {
+				m.Close()
+			}
+			return nil, fmt.Errorf("failed to warm up ONNX model %s instance %d: %v", name, i, err)
+		}
+		log.Printf("Warmed up ONNX model %s instance %d in %v", name, i, elapsed)
+	}
+	return models, nil
+}
+
+// loadInferenceService loads every configured model and builds the service
+// over them. On failure, the models loaded so far are closed and every
+// downloaded model file is removed before the error is returned.
+func loadInferenceService(ctx context.Context, config *Config, sqlDB pinger) (*service.InferenceService, error) {
+	modelSets := make(map[string]service.ModelSet, len(config.Models))
+	fail := func(err error) (*service.InferenceService, error) {
+		for _, set := range modelSets {
+			closePredictors(set.Predictors)
+		}
+		removeDownloadedModels()
+		return nil, err
+	}
+
+	for _, name := range sortedModelNames(config.Models) {
+		set, err := loadModel(ctx, name, config.Models[name], config, sqlDB)
+		if err != nil {
+			return fail(err)
+		}
+		modelSets[name] = set
+	}
+
+	inferenceService, err := service.NewMultiModelInferenceService(modelSets, config.PrimaryModel, config.InferenceTimeout)
+	if err != nil {
+		return fail(err)
+	}
+	return inferenceService, nil
+}
+
+// closePredictors closes model instances that were never handed to an
+// InferenceService.
+func closePredictors(predictors []service.Predictor) {
+	for _, m := range predictors {
+		if err := m.Close(); err != nil {
+			log.Printf("Failed to close model instance: %v", err)
+		}
+	}
+}
+
+func toPredictors(models []*model.ONNXModel) []service.Predictor {
+	predictors := make([]service.Predictor, len(models))
+	for i, m := range models {
+		predictors[i] = m
+	}
+	return predictors
+}
+
 func main() {
+	if len(os.Args) > 1 && (os.Args[1] == "infer" || os.Args[1] == "bench") {
+		run := runInfer
+		if os.Args[1] == "bench" {
+			run = runBench
+		}
+		if err := run(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Route the standard log package through slog as well, so every line the
+	// service writes is a JSON object.
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: &logLevel})))
+
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("Failed to flush traces: %v", err)
+		}
+	}()
+	if tracing.Enabled() {
+		log.Println("OpenTelemetry tracing enabled")
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -195,46 +1622,102 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	classDict, err := loadClassDictionary(config.ClassDictPath)
-	if err != nil {
+	logLevel.Set(config.LogLevel)
+	if err := config.Validate(); err != nil {
 		log.Fatal(err)
 	}
 
-	db, err := initDB(config.DBConfig)
-	if err != nil {
-		log.Fatal(err)
-	}
+	// The stdout sink runs without a database, so dbCheck stays nil and
+	// neither the self-check nor readiness pings one.
+	var db *gorm.DB
+	var repository *data.ChronicRepository
+	var dbCheck pinger
+	if config.EventSink == eventSinkDB {
+		db, err = initDB(config.DBConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-	sqlDB, err := db.DB()
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer func(sqlDB *sql.DB) {
-		err := sqlDB.Close()
+		sqlDB, err := db.DB()
 		if err != nil {
-			log.Printf("Failed to close database connection: %v", err)
+			log.Fatal(err)
 		}
-	}(sqlDB)
+		defer func(sqlDB *sql.DB) {
+			err := sqlDB.Close()
+			if err != nil {
+				log.Printf("Failed to close database connection: %v", err)
+			}
+		}(sqlDB)
+		repository = data.NewChronicRepository(db)
+		dbCheck = sqlDB
+	}
 
-	onnxModel, err := model.NewONNXModel(config.ModelPath)
+	inferenceService, err := loadInferenceService(ctx, config, dbCheck)
 	if err != nil {
-		log.Fatalf("Failed to load ONNX model: %v", err)
+		log.Fatal(err)
 	}
-	defer func() {
-		if err := onnxModel.Close(); err != nil {
-			log.Printf("Failed to close ONNX model: %v", err)
+	// Deferred first so downloaded model files are removed after the models
+	// using them are closed. log.Fatal skips deferred calls, so later
+	// failures go through fatal.
+	defer removeDownloadedModels()
+	defer inferenceService.Close()
+	fatal := func(err error) {
+		inferenceService.Close()
+		removeDownloadedModels()
+		log.Fatal(err)
+	}
+	if db != nil {
+		if err := migrateDB(db, config.DBConfig); err != nil {
+			fatal(err)
 		}
-	}()
+	}
 
-	repository := data.NewChronicRepository(db)
 	chronicEvents := make(chan event.Event, 100)
-	startChronicEventProcessor(ctx, repository, chronicEvents)
+	var sink event.Sink = repository
+	if config.EventSink == eventSinkStdout {
+		sink = event.NewWriterSink(os.Stdout)
+		log.Println("EVENT_SINK is stdout, analyses are written to stdout and no database is used")
+	}
+	startChronicEventProcessor(ctx, sink, chronicEvents, config.DeadLetterPath)
+	if config.Retention > 0 && repository != nil {
+		startRetentionJob(ctx, repository, config.Retention)
+	}
+
+	config.Preprocess.Layout = inferenceService.InputLayout()
+	config.Preprocess.Width, config.Preprocess.Height = inferenceService.InputSize()
+	inferenceService.SetDefaultTopK(config.DefaultTopK)
+	inferenceService.SetReviewPolicy(config.ReviewThreshold, config.ReviewMessage)
+	inferenceService.SetModelLoader(func(name, location string) ([]service.Predictor, string, error) {
+		path, err := fetchModelFile(ctx, location, config)
+		if err != nil {
+			return nil, "", err
+		}
+		models, err := loadModelPool(name, path, config.Models[name].SHA256, config)
+		if err != nil {
+			removeDownloadedModel(path)
+			return nil, "", err
+		}
+		return toPredictors(models), path, nil
+	})
+	inferenceService.SetModelRemover(func(_, path string) {
+		removeDownloadedModel(path)
+	})
 
-	inferenceService := service.NewInferenceService(onnxModel, classDict)
+	ready := func(ctx context.Context) error {
+		if !inferenceService.Ready() {
+			return errors.New("model not loaded")
+		}
+		if dbCheck == nil {
+			return nil
+		}
+		if err := dbCheck.PingContext(ctx); err != nil {
+			return fmt.Errorf("database ping failed: %v", err)
+		}
+		return nil
+	}
 
-	if err := startServers(ctx, inferenceService, chronicEvents, config.RestMode); err != nil {
-		log.Fatal(err)
+	if err := startServers(ctx, config, inferenceService, repository, chronicEvents, ready); err != nil {
+		fatal(err)
 	}
 
 	<-ctx.Done()
@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Transport labels used on every metric.
+const (
+	TransportREST = "rest"
+	TransportGRPC = "grpc"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "skin_analysis_requests_total",
+		Help: "Analysis requests received, by transport.",
+	}, []string{"transport"})
+
+	requestFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "skin_analysis_request_failures_total",
+		Help: "Analysis requests that ended in an error, by transport.",
+	}, []string{"transport"})
+
+	analysesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "skin_analysis_successes_total",
+		Help: "Successful analyses, by transport and predicted top class.",
+	}, []string{"transport", "top_class"})
+
+	inferenceDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "skin_analysis_inference_duration_seconds",
+		Help:    "Time spent in model inference, excluding decoding and preprocessing.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"transport"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "skin_analysis_request_duration_seconds",
+		Help:    "End-to-end latency of analysis requests.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"transport"})
+
+	predictedClassesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "skin_analysis_predicted_class_total",
+		Help: "Inferences by model and top-1 predicted class, before the minimum confidence filter.",
+	}, []string{"model", "class"})
+
+	cacheLookupsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "skin_analysis_cache_lookups_total",
+		Help: "Analysis cache lookups, by result (hit or miss).",
+	}, []string{"result"})
+
+	inflightRequests = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "skin_analysis_inflight_requests",
+		Help: "Analysis requests admitted by the concurrency limiter and holding a slot, by transport.",
+	}, []string{"transport"})
+
+	queuedRequests = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "skin_analysis_queued_requests",
+		Help: "Analysis requests waiting for a concurrency limiter slot, by transport.",
+	}, []string{"transport"})
+
+	rejectedRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "skin_analysis_rejected_requests_total",
+		Help: "Analysis requests rejected by the concurrency limiter, by transport.",
+	}, []string{"transport"})
+)
+
+// ObserveRequest records one finished analysis request and its latency.
+func ObserveRequest(transport string, elapsed time.Duration, failed bool) {
+	requestsTotal.WithLabelValues(transport).Inc()
+	requestDuration.WithLabelValues(transport).Observe(elapsed.Seconds())
+	if failed {
+		requestFailuresTotal.WithLabelValues(transport).Inc()
+	}
+}
+
+// ObserveInference records the duration of one model call.
+func ObserveInference(transport string, elapsed time.Duration) {
+	inferenceDuration.WithLabelValues(transport).Observe(elapsed.Seconds())
+}
+
+// RecordAnalysis counts a successful analysis under its top predicted class.
+func RecordAnalysis(transport, topClass string) {
+	analysesTotal.WithLabelValues(transport, topClass).Inc()
+}
+
+// InitPredictedClasses exports a zero count for every class a model can
+// predict, so dashboards see a class before its first prediction.
+func InitPredictedClasses(model string, classes []string) {
+	for _, class := range classes {
+		predictedClassesTotal.WithLabelValues(model, class)
+	}
+}
+
+// RecordPrediction counts one inference under its model and top-1 class.
+func RecordPrediction(model, class string) {
+	predictedClassesTotal.WithLabelValues(model, class).Inc()
+}
+
+// RecordCacheLookup counts one analysis cache lookup.
+func RecordCacheLookup(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheLookupsTotal.WithLabelValues(result).Inc()
+}
+
+// SetLimiterState records the number of in-flight and queued requests of
+// one transport in the concurrency limiter.
+func SetLimiterState(transport string, inflight, queued int) {
+	inflightRequests.WithLabelValues(transport).Set(float64(inflight))
+	queuedRequests.WithLabelValues(transport).Set(float64(queued))
+}
+
+// RecordRejection counts a request rejected by the concurrency limiter.
+func RecordRejection(transport string) {
+	rejectedRequestsTotal.WithLabelValues(transport).Inc()
+}
@@ -0,0 +1,87 @@
+package model
+
+import "math"
+
+// Activation is the function applied to the raw model output in Predict
+type Activation string
+
+const (
+	// ActivationNone returns the output as is, for models ending in their
+	// own softmax or sigmoid layer
+	ActivationNone Activation = "none"
+	// ActivationSoftmax normalizes logits of mutually exclusive classes into
+	// probabilities that sum to 1
+	ActivationSoftmax Activation = "softmax"
+	// ActivationSigmoid maps each logit to an independent probability, for
+	// multi-label models where an image can show several classes at once
+	ActivationSigmoid Activation = "sigmoid"
+)
+
+// DefaultMultiLabelThreshold is the probability a class of a sigmoid model
+// must reach to be reported when ModelConfig.MultiLabelThreshold is 0
+const DefaultMultiLabelThreshold = 0.5
+
+// Apply runs the activation on one raw output row, as returned by
+// PredictRaw, returning a new slice
+func (a Activation) Apply(output []float32) []float32 {
+	switch a {
+	case ActivationSoftmax:
+		return Softmax(output)
+	case ActivationSigmoid:
+		return Sigmoid(output)
+	}
+	result := make([]float32, len(output))
+	copy(result, output)
+	return result
+}
+
+// Softmax converts raw logits into probabilities that sum to 1
+// The maximum logit is subtracted before exponentiating so large values
+// do not overflow
+//
+// Parameters:
+//   - logits: raw model output values
+//
+// Returns:
+//   - []float32: probabilities, same length as logits
+func Softmax(logits []float32) []float32 {
+	result := make([]float32, len(logits))
+	if len(logits) == 0 {
+		return result
+	}
+
+	maxLogit := logits[0]
+	for _, v := range logits[1:] {
+		if v > maxLogit {
+			maxLogit = v
+		}
+	}
+
+	var sum float64
+	exps := make([]float64, len(logits))
+	for i, v := range logits {
+		exps[i] = math.Exp(float64(v - maxLogit))
+		sum += exps[i]
+	}
+
+	for i := range exps {
+		result[i] = float32(exps[i] / sum)
+	}
+
+	return result
+}
+
+// Sigmoid converts each raw logit into an independent probability in (0, 1)
+//
+// Parameters:
+//   - logits: raw model output values
+//
+// Returns:
+//   - []float32: probabilities, same length as logits
+func Sigmoid(logits []float32) []float32 {
+	result := make([]float32, len(logits))
+	for i, v := range logits {
+		result[i] = float32(1 / (1 + math.Exp(-float64(v))))
+	}
+	return result
+}
@@ -0,0 +1,104 @@
+package model
+
+import (
+	"fmt"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// PredictBatch performs inference on several inputs in a single session run
+// The inputs are stacked into an [N, ...] tensor, which requires the model's
+// batch dimension to be dynamic
+//
+// Parameters:
+//   - inputs: preprocessed images, each of size GetExpectedInputSize()
+//
+// Returns:
+//   - [][]float32: prediction probabilities per input, in input order
+//   - error: ErrConcurrentUse if the instance is busy, or an error if any
+//     input has the wrong size or inference fails
+func (m *ONNXModel) PredictBatch(inputs [][]float32) ([][]float32, error) {
+	outputs, err := m.PredictBatchRaw(inputs)
+	if err != nil {
+		return nil, err
+	}
+	for i, output := range outputs {
+		outputs[i] = m.activation.Apply(output)
+	}
+	return outputs, nil
+}
+
+// PredictBatchRaw performs batch inference like PredictBatch but returns
+// the outputs before the configured activation
+//
+// Parameters:
+//   - inputs: preprocessed images, each of size GetExpectedInputSize()
+//
+// Returns:
+//   - [][]float32: raw model output per input, in input order
+//   - error: ErrConcurrentUse if the instance is busy, or an error if any
+//     input has the wrong size or inference fails
+func (m *ONNXModel) PredictBatchRaw(inputs [][]float32) ([][]float32, error) {
+	if err := m.acquire(); err != nil {
+		return nil, err
+	}
+	defer m.release()
+
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("batch must contain at least one input")
+	}
+
+	sampleSize := m.GetExpectedInputSize()
+	batchData := make([]float32, 0, len(inputs)*sampleSize)
+	for i, input := range inputs {
+		if len(input) != sampleSize {
+			return nil, fmt.Errorf("input %d size mismatch: expected %d, got %d", i, sampleSize, len(input))
+		}
+		batchData = append(batchData, input...)
+	}
+
+	if m.batchSession == nil {
+		options, err := newSessionOptions(m.settings)
+		if err != nil {
+			return nil, err
+		}
+		defer options.Destroy()
+
+		session, err := ort.NewDynamicAdvancedSession(m.path, m.inputNames, m.outputNames, options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create batch session: %w", err)
+		}
+		m.batchSession = session
+	}
+
+	batchSize := int64(len(inputs))
+	inputShape := append([]int64{batchSize}, m.inputShape[1:]...)
+	outputShape := append([]int64{batchSize}, m.outputShape[1:]...)
+
+	inputTensor, err := ort.NewTensor(ort.NewShape(inputShape...), batchData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create batch input tensor: %w", err)
+	}
+	defer inputTensor.Destroy()
+
+	outputTensor, err := ort.NewEmptyTensor[float32](ort.NewShape(outputShape...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create batch output tensor: %w", err)
+	}
+	defer outputTensor.Destroy()
+
+	if err := m.batchSession.Run([]ort.Value{inputTensor}, []ort.Value{outputTensor}); err != nil {
+		return nil, fmt.Errorf("failed to run batch inference (model batch dimension must be dynamic): %w", err)
+	}
+
+	numClasses := m.GetNumClasses()
+	outputData := outputTensor.GetData()
+	results := make([][]float32, len(inputs))
+	for i := range results {
+		// The output tensor is destroyed on return
+		results[i] = make([]float32, numClasses)
+		copy(results[i], outputData[i*numClasses:(i+1)*numClasses])
+	}
+
+	return results, nil
+}
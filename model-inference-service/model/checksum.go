@@ -0,0 +1,57 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// FileSHA256 computes the SHA-256 digest of a model file
+//
+// Parameters:
+//   - path: path to the file
+//
+// Returns:
+//   - string: lowercase hex digest
+//   - error: error if the file cannot be read
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash model file: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash model file: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// validSHA256 reports whether s is a 64 character hex digest
+func validSHA256(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// verifyChecksum hashes the model file and logs the digest so operators can
+// record it. When expected is set, a different digest is an error
+func verifyChecksum(path, expected string) error {
+	digest, err := FileSHA256(path)
+	if err != nil {
+		return err
+	}
+	slog.Info("model file checksum", "path", path, "sha256", digest)
+
+	if expected != "" && !strings.EqualFold(digest, expected) {
+		return fmt.Errorf("model file %s checksum mismatch: expected SHA-256 %s, got %s", path, strings.ToLower(expected), digest)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"fmt"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// DetectModelConfig reads the input and output node names and shapes declared
+// in an ONNX model file
+// Dynamic or unknown dimensions (such as a batch dimension of -1) are
+// replaced with 1. The layout is guessed from the input shape: NCHW when
+// dimension 1 has 3 channels and dimension 3 does not, NHWC otherwise
+//
+// Parameters:
+//   - path: path to the .onnx model file
+//
+// Returns:
+//   - ModelConfig: node names, shapes and layout of the model graph
+//   - error: error if the file cannot be read, or the model does not have
+//     exactly one float32 tensor input and output
+func DetectModelConfig(path string) (ModelConfig, error) {
+	if err := acquireEnvironment(); err != nil {
+		return ModelConfig{}, err
+	}
+	defer releaseEnvironment()
+
+	inputs, outputs, err := ort.GetInputOutputInfo(path)
+	if err != nil {
+		return ModelConfig{}, fmt.Errorf("failed to read model inputs and outputs: %w", err)
+	}
+
+	if len(inputs) != 1 {
+		return ModelConfig{}, fmt.Errorf("model %s has %d inputs, expected exactly 1", path, len(inputs))
+	}
+	if len(outputs) != 1 {
+		return ModelConfig{}, fmt.Errorf("model %s has %d outputs, expected exactly 1", path, len(outputs))
+	}
+
+	inputShape, err := tensorShape("input", inputs[0])
+	if err != nil {
+		return ModelConfig{}, err
+	}
+	outputShape, err := tensorShape("output", outputs[0])
+	if err != nil {
+		return ModelConfig{}, err
+	}
+
+	layout := LayoutNHWC
+	if len(inputShape) == 4 && inputShape[1] == 3 && inputShape[3] != 3 {
+		layout = LayoutNCHW
+	}
+
+	return ModelConfig{
+		InputNames:  []string{inputs[0].Name},
+		OutputNames: []string{outputs[0].Name},
+		InputShape:  inputShape,
+		OutputShape: outputShape,
+		Layout:      layout,
+	}, nil
+}
+
+// tensorShape returns the dimensions of a float32 tensor node, replacing
+// dynamic dimensions with 1
+func tensorShape(kind string, info ort.InputOutputInfo) ([]int64, error) {
+	if info.OrtValueType != ort.ONNXTypeTensor {
+		return nil, fmt.Errorf("model %s %q is a %s, expected a tensor", kind, info.Name, info.OrtValueType)
+	}
+	if info.DataType != ort.TensorElementDataTypeFloat {
+		return nil, fmt.Errorf("model %s %q has element type %s, expected float32", kind, info.Name, info.DataType)
+	}
+
+	shape := make([]int64, len(info.Dimensions))
+	for i, d := range info.Dimensions {
+		if d <= 0 {
+			d = 1
+		}
+		shape[i] = d
+	}
+	return shape, nil
+}
+
+// WithDefaults returns c with every unset field taken from defaults
+// The output activation, ApplySoftmax and the session settings are kept
+// from c since they are not part of the graph
+//
+// Parameters:
+//   - defaults: configuration supplying the missing fields, typically from DetectModelConfig
+//
+// Returns:
+//   - ModelConfig: the merged configuration
+func (c ModelConfig) WithDefaults(defaults ModelConfig) ModelConfig {
+	if len(c.InputNames) == 0 {
+		c.InputNames = defaults.InputNames
+	}
+	if len(c.OutputNames) == 0 {
+		c.OutputNames = defaults.OutputNames
+	}
+	if len(c.InputShape) == 0 {
+		c.InputShape = defaults.InputShape
+	}
+	if len(c.OutputShape) == 0 {
+		c.OutputShape = defaults.OutputShape
+	}
+	if c.Layout == "" {
+		c.Layout = defaults.Layout
+	}
+	return c
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// The ONNX Runtime environment is process-global, while several ONNXModel
+// instances may be alive at once (e.g. a session pool). It is initialized
+// by the first model and destroyed when the last one is closed.
+var (
+	environmentMu   sync.Mutex
+	environmentRefs int
+)
+
+func acquireEnvironment() error {
+	environmentMu.Lock()
+	defer environmentMu.Unlock()
+
+	if environmentRefs == 0 {
+		if err := ort.InitializeEnvironment(); err != nil {
+			return fmt.Errorf("failed to initialize ONNX runtime: %w", err)
+		}
+	}
+	environmentRefs++
+	return nil
+}
+
+func releaseEnvironment() error {
+	environmentMu.Lock()
+	defer environmentMu.Unlock()
+
+	environmentRefs--
+	if environmentRefs > 0 {
+		return nil
+	}
+	environmentRefs = 0
+	return ort.DestroyEnvironment()
+}
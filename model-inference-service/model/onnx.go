@@ -1,50 +1,274 @@
 package model
 
 import (
+	"errors"
 	"fmt"
+	"sync/atomic"
+	"time"
 
 	ort "github.com/yalue/onnxruntime_go"
 )
 
+// ErrConcurrentUse is returned by Predict and PredictBatch when another
+// inference is already running on the same ONNXModel instance
+var ErrConcurrentUse = errors.New("model instance is already running an inference; use one instance per goroutine (see NewONNXModelPool)")
+
 // ONNXModel represents a wrapper for ONNX Runtime model operations
-// Designed for image classification with 8 classes (from TensorFlow.js converted model)
+// Designed for image classification; defaults to the 8 class TensorFlow.js converted model
+//
+// An instance owns a single input/output tensor pair that every call
+// overwrites, so it runs one inference at a time. Concurrent calls on the
+// same instance fail with ErrConcurrentUse instead of mixing their inputs;
+// load one instance per worker with NewONNXModelPool to run in parallel
 type ONNXModel struct {
+	// inUse is set while Predict or PredictBatch is running
+	inUse atomic.Bool
+
 	session      *ort.AdvancedSession
 	inputTensor  *ort.Tensor[float32]
 	outputTensor *ort.Tensor[float32]
 	inputShape   []int64
 	outputShape  []int64
+	layout       Layout
+	activation   Activation
+	threshold    float32
+
+	// Batch inference uses a separate dynamic session created on first use
+	path         string
+	inputNames   []string
+	outputNames  []string
+	settings     sessionSettings
+	batchSession *ort.DynamicAdvancedSession
+}
+
+// Layout is the memory ordering of the 4D image input tensor
+type Layout string
+
+const (
+	// LayoutNHWC orders the input as [batch, height, width, channels]: the
+	// channel values of each pixel are interleaved (RGBRGB...)
+	LayoutNHWC Layout = "NHWC"
+	// LayoutNCHW orders the input as [batch, channels, height, width]: each
+	// channel is a contiguous plane (RR...GG...BB...), as in most PyTorch exports
+	LayoutNCHW Layout = "NCHW"
+)
+
+// ModelConfig describes the graph interface of an ONNX classification model
+type ModelConfig struct {
+	// InputNames are the names of the model input nodes
+	InputNames []string
+	// OutputNames are the names of the model output nodes
+	OutputNames []string
+	// InputShape is the input tensor shape, e.g. [1, 180, 180, 3]
+	InputShape []int64
+	// OutputShape is the output tensor shape, e.g. [1, 8]
+	OutputShape []int64
+	// Layout is the ordering of InputShape; it decides where the height,
+	// width and channel dimensions are read from and how callers must
+	// arrange the flattened input. Defaults to LayoutNHWC when empty
+	Layout Layout
+	// OutputActivation is applied to the raw output in Predict. When empty,
+	// ApplySoftmax selects ActivationSoftmax and otherwise ActivationNone
+	OutputActivation Activation
+	// ApplySoftmax applies Softmax to the raw output in Predict; enable it for
+	// models that output logits instead of ending in a softmax layer. It is
+	// ignored when OutputActivation is set
+	ApplySoftmax bool
+	// MultiLabelThreshold is the probability a class of a sigmoid model must
+	// reach to be returned by GetTopKPredictions. Defaults to
+	// DefaultMultiLabelThreshold when 0
+	MultiLabelThreshold float32
+	// ExecutionProvider is the backend the session runs on. Defaults to
+	// ProviderCPU when empty
+	ExecutionProvider ExecutionProvider
+	// IntraOpThreads is the number of threads one operator may use; 0 keeps
+	// the ONNX Runtime default of one thread per core
+	IntraOpThreads int
+	// InterOpThreads is the number of threads running independent operators
+	// in parallel; 0 keeps the ONNX Runtime default
+	InterOpThreads int
+	// SHA256 is the expected hex digest of the model file. When set, the
+	// file is hashed and compared before any session is created; empty
+	// skips the comparison, but the computed digest is still logged
+	SHA256 string
 }
 
-// NewONNXModel creates a new instance of ONNX model
-// This is specifically configured for your TensorFlow.js converted model:
+// DefaultModelConfig returns the configuration of the bundled TensorFlow.js converted model:
 // - Input: "input_6" with shape [1, 180, 180, 3]
-// - Output: "dense_11" with shape [1, 8]
+// - Output: "dense_11" with shape [1, 8], already softmaxed by the model
+//
+// Returns:
+//   - ModelConfig: configuration matching the bundled model
+func DefaultModelConfig() ModelConfig {
+	return ModelConfig{
+		InputNames:  []string{"input_6"},
+		OutputNames: []string{"dense_11"},
+		InputShape:  []int64{1, 180, 180, 3}, // NHWC
+		OutputShape: []int64{1, 8},
+		Layout:      LayoutNHWC,
+	}
+}
+
+// Validate checks that exactly one input and one output node is named and
+// that both shapes are non-empty with positive dimensions
+//
+// Returns:
+//   - error: error describing the first invalid field
+func (c ModelConfig) Validate() error {
+	if len(c.InputNames) != 1 {
+		return fmt.Errorf("model config: exactly one input name is required, got %d", len(c.InputNames))
+	}
+	if len(c.OutputNames) != 1 {
+		return fmt.Errorf("model config: exactly one output name is required, got %d", len(c.OutputNames))
+	}
+	if err := validateShape("input", c.InputShape); err != nil {
+		return err
+	}
+	if err := validateShape("output", c.OutputShape); err != nil {
+		return err
+	}
+
+	switch c.Layout {
+	case "", LayoutNHWC, LayoutNCHW:
+	default:
+		return fmt.Errorf("model config: unknown layout %q (expected %s or %s)", c.Layout, LayoutNHWC, LayoutNCHW)
+	}
+	switch c.ExecutionProvider {
+	case "", ProviderCPU, ProviderCUDA, ProviderCoreML:
+	default:
+		return fmt.Errorf("model config: unknown execution provider %q (expected %s, %s or %s)",
+			c.ExecutionProvider, ProviderCPU, ProviderCUDA, ProviderCoreML)
+	}
+	switch c.OutputActivation {
+	case "", ActivationNone, ActivationSoftmax, ActivationSigmoid:
+	default:
+		return fmt.Errorf("model config: unknown output activation %q (expected %s, %s or %s)",
+			c.OutputActivation, ActivationSoftmax, ActivationSigmoid, ActivationNone)
+	}
+	if c.MultiLabelThreshold < 0 || c.MultiLabelThreshold > 1 {
+		return fmt.Errorf("model config: multi-label threshold %v must be between 0 and 1", c.MultiLabelThreshold)
+	}
+	if c.IntraOpThreads < 0 || c.InterOpThreads < 0 {
+		return fmt.Errorf("model config: thread counts must not be negative")
+	}
+	if c.SHA256 != "" && !validSHA256(c.SHA256) {
+		return fmt.Errorf("model config: SHA-256 %q is not a 64 character hex digest", c.SHA256)
+	}
+	if len(c.InputShape) != 4 {
+		return fmt.Errorf("model config: input shape %v must have 4 dimensions for an image model", c.InputShape)
+	}
+	if _, _, channels := imageDims(c.InputShape, c.layout()); channels != 3 {
+		return fmt.Errorf("model config: input shape %v has %d channels in %s layout, expected 3 (RGB)",
+			c.InputShape, channels, c.layout())
+	}
+	return nil
+}
+
+func (c ModelConfig) layout() Layout {
+	if c.Layout == "" {
+		return LayoutNHWC
+	}
+	return c.Layout
+}
+
+func (c ModelConfig) outputActivation() Activation {
+	switch {
+	case c.OutputActivation != "":
+		return c.OutputActivation
+	case c.ApplySoftmax:
+		return ActivationSoftmax
+	}
+	return ActivationNone
+}
+
+func (c ModelConfig) multiLabelThreshold() float32 {
+	if c.MultiLabelThreshold == 0 {
+		return DefaultMultiLabelThreshold
+	}
+	return c.MultiLabelThreshold
+}
+
+// imageDims reads height, width and channels from a 4D input shape
+func imageDims(shape []int64, layout Layout) (height, width, channels int) {
+	if layout == LayoutNCHW {
+		return int(shape[2]), int(shape[3]), int(shape[1])
+	}
+	return int(shape[1]), int(shape[2]), int(shape[3])
+}
+
+func validateShape(kind string, shape []int64) error {
+	if len(shape) == 0 {
+		return fmt.Errorf("model config: %s shape must not be empty", kind)
+	}
+	for i, d := range shape {
+		if d <= 0 {
+			return fmt.Errorf("model config: %s shape %v has non-positive dimension at index %d", kind, shape, i)
+		}
+	}
+	return nil
+}
+
+// NewONNXModel creates a new instance of ONNX model using the node names and
+// shapes declared in the model file (see DetectModelConfig)
 //
 // Parameters:
 //   - path: path to the .onnx model file
 //
 // Returns:
 //   - *ONNXModel: pointer to the created ONNX model
-//   - error: error if any occurs during initialization
+//   - error: error if any occurs during detection or initialization
 func NewONNXModel(path string) (*ONNXModel, error) {
-	// Initialize ONNX Runtime environment
-	if err := ort.InitializeEnvironment(); err != nil {
-		return nil, fmt.Errorf("failed to initialize ONNX runtime: %w", err)
+	cfg, err := DetectModelConfig(path)
+	if err != nil {
+		return nil, err
 	}
+	return NewONNXModelWithConfig(path, cfg)
+}
 
-	// Expected node names for TensorFlow.js ONNX conversion
-	inputNodeNames := []string{"input_6"}   // adjust if needed
-	outputNodeNames := []string{"dense_11"} // adjust if needed
+// NewONNXModelWithConfig creates a new instance of ONNX model with the given
+// node names and tensor shapes, after checking the file against cfg.SHA256
+//
+// Parameters:
+//   - path: path to the .onnx model file
+//   - cfg: node names and shapes of the model graph
+//
+// Returns:
+//   - *ONNXModel: pointer to the created ONNX model
+//   - error: error if the config is invalid, the checksum does not match or
+//     any occurs during initialization
+func NewONNXModelWithConfig(path string, cfg ModelConfig) (*ONNXModel, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if err := verifyChecksum(path, cfg.SHA256); err != nil {
+		return nil, err
+	}
+	return newONNXModel(path, cfg)
+}
+
+// newONNXModel creates the session and tensors of a validated config
+func newONNXModel(path string, cfg ModelConfig) (*ONNXModel, error) {
+
+	// Initialize ONNX Runtime environment, shared by all models
+	if err := acquireEnvironment(); err != nil {
+		return nil, err
+	}
+	initialized := false
+	defer func() {
+		if !initialized {
+			releaseEnvironment()
+		}
+	}()
 
-	// Expected shapes
-	inputShape := []int64{1, 180, 180, 3} // NHWC
-	outputShape := []int64{1, 8}
+	inputNodeNames := cfg.InputNames
+	outputNodeNames := cfg.OutputNames
+	inputShape := cfg.InputShape
+	outputShape := cfg.OutputShape
 
 	// Session options
-	options, err := ort.NewSessionOptions()
+	options, err := newSessionOptions(cfg.sessionSettings())
 	if err != nil {
-		return nil, fmt.Errorf("failed to create session options: %w", err)
+		return nil, err
 	}
 	defer options.Destroy()
 
@@ -89,33 +313,65 @@ func NewONNXModel(path string) (*ONNXModel, error) {
 		)
 	}
 
+	initialized = true
 	return &ONNXModel{
 		session:      session,
 		inputTensor:  inputTensor,
 		outputTensor: outputTensor,
 		inputShape:   inputShape,
 		outputShape:  outputShape,
+		layout:       cfg.layout(),
+		activation:   cfg.outputActivation(),
+		threshold:    cfg.multiLabelThreshold(),
+		path:         path,
+		inputNames:   inputNodeNames,
+		outputNames:  outputNodeNames,
+		settings:     cfg.sessionSettings(),
 	}, nil
 }
 
 // Predict performs inference with the given input image data
-// Input should be a flattened array of size 97,200 (1*180*180*3)
+// Input should be a flattened array matching the input shape
+// (97,200 elements for the default 1*180*180*3)
 // in format [batch, height, width, channels]
 //
 // Parameters:
-//   - input: preprocessed image data as float32 slice (size: 97,200)
+//   - input: preprocessed image data as float32 slice (size: GetExpectedInputSize())
 //     Values should be normalized (typically 0-1 or -1 to 1)
 //
 // Returns:
-//   - []float32: prediction probabilities for 8 classes (size: 8)
-//   - error: error if any occurs during inference
+//   - []float32: prediction probabilities, one per class
+//   - error: ErrConcurrentUse if the instance is busy, or any inference error
 func (m *ONNXModel) Predict(input []float32) ([]float32, error) {
+	output, err := m.PredictRaw(input)
+	if err != nil {
+		return nil, err
+	}
+	return m.activation.Apply(output), nil
+}
+
+// PredictRaw performs inference like Predict but returns the output before
+// the configured activation, e.g. the logits of a model that is softmaxed
+// in Predict
+//
+// Parameters:
+//   - input: preprocessed image data as float32 slice (size: GetExpectedInputSize())
+//
+// Returns:
+//   - []float32: raw model output, one value per class
+//   - error: ErrConcurrentUse if the instance is busy, or any inference error
+func (m *ONNXModel) PredictRaw(input []float32) ([]float32, error) {
+	if err := m.acquire(); err != nil {
+		return nil, err
+	}
+	defer m.release()
+
 	// Validate input size
 	inputData := m.inputTensor.GetData()
 	expectedSize := len(inputData)
 
 	if len(input) != expectedSize {
-		return nil, fmt.Errorf("input size mismatch: expected %d (1*180*180*3), got %d", expectedSize, len(input))
+		return nil, fmt.Errorf("input size mismatch: expected %d (%v), got %d", expectedSize, m.inputShape, len(input))
 	}
 
 	// Copy input data to tensor
@@ -127,12 +383,24 @@ func (m *ONNXModel) Predict(input []float32) ([]float32, error) {
 		return nil, fmt.Errorf("failed to run inference: %w", err)
 	}
 
-	// Get output (8 class probabilities)
-	outputData := m.outputTensor.GetData()
-	result := make([]float32, len(outputData))
-	copy(result, outputData)
+	// Get output (one value per class); the tensor is reused by the next call
+	output := make([]float32, len(m.outputTensor.GetData()))
+	copy(output, m.outputTensor.GetData())
+	return output, nil
+}
+
+// acquire marks the instance as busy, failing if an inference is already
+// running on it
+func (m *ONNXModel) acquire() error {
+	if !m.inUse.CompareAndSwap(false, true) {
+		return ErrConcurrentUse
+	}
+	return nil
+}
 
-	return result, nil
+// release marks the instance as idle again
+func (m *ONNXModel) release() {
+	m.inUse.Store(false)
 }
 
 // PredictClass performs inference and returns the predicted class and confidence
@@ -141,7 +409,7 @@ func (m *ONNXModel) Predict(input []float32) ([]float32, error) {
 //   - input: preprocessed image data as float32 slice
 //
 // Returns:
-//   - int: predicted class index (0-7)
+//   - int: predicted class index (0 to GetNumClasses()-1)
 //   - float32: confidence score (0-1)
 //   - error: error if any occurs during inference
 func (m *ONNXModel) PredictClass(input []float32) (int, float32, error) {
@@ -172,7 +440,7 @@ func (m *ONNXModel) PredictClass(input []float32) (int, float32, error) {
 //
 // Returns:
 //   - []float32: prediction probabilities
-//   - []int64: shape of the output [1, 8]
+//   - []int64: shape of the output, e.g. [1, 8]
 //   - error: error if any occurs during inference
 func (m *ONNXModel) PredictWithShape(input []float32) ([]float32, []int64, error) {
 	result, err := m.Predict(input)
@@ -180,33 +448,93 @@ func (m *ONNXModel) PredictWithShape(input []float32) ([]float32, []int64, error
 		return nil, nil, err
 	}
 
-	shape := m.outputTensor.GetShape()
-	return result, shape, nil
+	return result, m.GetOutputShape(), nil
+}
+
+// Warmup runs a single inference on a zeroed input so ONNX Runtime finishes
+// its lazy initialization before the first real request
+//
+// Returns:
+//   - time.Duration: how long the warm-up inference took
+//   - error: error if any occurs during inference
+func (m *ONNXModel) Warmup() (time.Duration, error) {
+	start := time.Now()
+	if _, err := m.Predict(make([]float32, m.GetExpectedInputSize())); err != nil {
+		return 0, fmt.Errorf("warm-up inference failed: %w", err)
+	}
+	return time.Since(start), nil
 }
 
 // GetTopKPredictions returns top K predictions with their indices and probabilities
+// For a sigmoid model, whose classes are not mutually exclusive, it instead
+// returns every class reaching the multi-label threshold and ignores k
 //
 // Parameters:
 //   - input: preprocessed image data as float32 slice
-//   - k: number of top predictions to return (max 8)
+//   - k: number of top predictions to return, clamped to [1, number of classes]
 //
 // Returns:
 //   - []int: class indices sorted by probability
 //   - []float32: corresponding probabilities
 //   - error: error if any occurs during inference
 func (m *ONNXModel) GetTopKPredictions(input []float32, k int) ([]int, []float32, error) {
-	if k > 8 {
-		k = 8
-	}
-	if k < 1 {
-		k = 1
-	}
-
 	probabilities, err := m.Predict(input)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	if m.activation == ActivationSigmoid {
+		topIndices, topProbs := RankAboveThreshold(probabilities, m.threshold)
+		return topIndices, topProbs, nil
+	}
+	topIndices, topProbs := RankTopK(probabilities, k)
+	return topIndices, topProbs, nil
+}
+
+// RankAboveThreshold returns every class whose probability is at least
+// threshold, sorted in descending order. The result is empty when no class
+// reaches the threshold
+//
+// Parameters:
+//   - probabilities: independent class probabilities, as returned by a sigmoid model
+//   - threshold: minimum probability of a returned class
+//
+// Returns:
+//   - []int: class indices sorted by probability
+//   - []float32: corresponding probabilities
+func RankAboveThreshold(probabilities []float32, threshold float32) ([]int, []float32) {
+	indices, probs := RankTopK(probabilities, len(probabilities))
+	n := 0
+	for n < len(probs) && probs[n] >= threshold {
+		n++
+	}
+	return indices[:n], probs[:n]
+}
+
+// RankTopK returns the k highest probabilities with their class indices,
+// sorted in descending order. Equal probabilities are ordered by ascending
+// class index, so the ranking of a given output vector is always the same.
+// It does not run inference, so it can be used on an already computed
+// output vector.
+//
+// Parameters:
+//   - probabilities: class probabilities as returned by Predict
+//   - k: number of top predictions to return, clamped to [1, len(probabilities)]
+//
+// Returns:
+//   - []int: class indices sorted by probability
+//   - []float32: corresponding probabilities
+func RankTopK(probabilities []float32, k int) ([]int, []float32) {
+	if len(probabilities) == 0 {
+		return nil, nil
+	}
+	if k > len(probabilities) {
+		k = len(probabilities)
+	}
+	if k < 1 {
+		k = 1
+	}
+
 	// Create pairs of (indexes, probability)
 	type pred struct {
 		idx  int
@@ -218,11 +546,13 @@ func (m *ONNXModel) GetTopKPredictions(input []float32, k int) ([]int, []float32
 		preds[i] = pred{idx: i, prob: p}
 	}
 
-	// Simple selection sort for top K
+	// Simple selection sort for top K. The swaps move classes out of index
+	// order, so ties are broken on the index explicitly.
 	for i := 0; i < k; i++ {
 		maxIdx := i
 		for j := i + 1; j < len(preds); j++ {
-			if preds[j].prob > preds[maxIdx].prob {
+			if preds[j].prob > preds[maxIdx].prob ||
+				preds[j].prob == preds[maxIdx].prob && preds[j].idx < preds[maxIdx].idx {
 				maxIdx = j
 			}
 		}
@@ -237,7 +567,7 @@ func (m *ONNXModel) GetTopKPredictions(input []float32, k int) ([]int, []float32
 		topProbs[i] = preds[i].prob
 	}
 
-	return topIndices, topProbs, nil
+	return topIndices, topProbs
 }
 
 // Close cleans up the resources used by the model
@@ -254,11 +584,53 @@ func (m *ONNXModel) Close() error {
 	if m.session != nil {
 		m.session.Destroy()
 	}
+	if m.batchSession != nil {
+		m.batchSession.Destroy()
+	}
 
-	return ort.DestroyEnvironment()
+	return releaseEnvironment()
 }
 
-// GetInputShape returns the shape of the input tensor [1, 180, 180, 3]
+// NewONNXModelPool loads size independent instances of the same model, each
+// with its own session and tensors, so they can run inference concurrently
+// The file is checked against cfg.SHA256 once for the whole pool
+//
+// Parameters:
+//   - path: path to the .onnx model file
+//   - cfg: node names and shapes of the model graph
+//   - size: number of instances to create (at least 1)
+//
+// Returns:
+//   - []*ONNXModel: the loaded instances
+//   - error: error if the checksum does not match or any instance fails to
+//     load; already loaded ones are closed
+func NewONNXModelPool(path string, cfg ModelConfig, size int) ([]*ONNXModel, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("model pool size must be at least 1, got %d", size)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if err := verifyChecksum(path, cfg.SHA256); err != nil {
+		return nil, err
+	}
+
+	models := make([]*ONNXModel, 0, size)
+	for i := 0; i < size; i++ {
+		m, err := newONNXModel(path, cfg)
+		if err != nil {
+			for _, loaded := range models {
+				loaded.Close()
+			}
+			return nil, fmt.Errorf("failed to load model instance %d: %w", i, err)
+		}
+		models = append(models, m)
+	}
+
+	return models, nil
+}
+
+// GetInputShape returns the shape of the input tensor, e.g. [1, 180, 180, 3]
 //
 // Returns:
 //   - []int64: shape of the input tensor
@@ -266,7 +638,7 @@ func (m *ONNXModel) GetInputShape() []int64 {
 	return m.inputShape
 }
 
-// GetOutputShape returns the shape of the output tensor [1, 8]
+// GetOutputShape returns the shape of the output tensor, e.g. [1, 8]
 //
 // Returns:
 //   - []int64: shape of the output tensor
@@ -274,7 +646,55 @@ func (m *ONNXModel) GetOutputShape() []int64 {
 	return m.outputShape
 }
 
-// GetExpectedInputSize returns the expected total number of input elements (97,200)
+// GetLayout returns the configured input layout (NHWC or NCHW)
+//
+// Returns:
+//   - Layout: ordering in which the flattened input must be arranged
+func (m *ONNXModel) GetLayout() Layout {
+	return m.layout
+}
+
+// GetInputSize returns the image dimensions of the input tensor, which
+// preprocessing resizes images to
+//
+// Returns:
+//   - int: input width in pixels
+//   - int: input height in pixels
+func (m *ONNXModel) GetInputSize() (width, height int) {
+	height, width, _ = imageDims(m.inputShape, m.layout)
+	return width, height
+}
+
+// GetOutputActivation returns the activation Predict applies to the output
+//
+// Returns:
+//   - Activation: softmax, sigmoid or none
+func (m *ONNXModel) GetOutputActivation() Activation {
+	return m.activation
+}
+
+// GetMultiLabelThreshold returns the probability a class of a sigmoid
+// model must reach to be reported
+//
+// Returns:
+//   - float32: threshold between 0 and 1
+func (m *ONNXModel) GetMultiLabelThreshold() float32 {
+	return m.threshold
+}
+
+// GetInputDims returns the image height, width and channel count of the
+// input tensor, read from the positions given by the configured layout
+//
+// Returns:
+//   - int: height in pixels
+//   - int: width in pixels
+//   - int: number of channels
+func (m *ONNXModel) GetInputDims() (int, int, int) {
+	return imageDims(m.inputShape, m.layout)
+}
+
+// GetExpectedInputSize returns the expected total number of input elements (97,200 by default)
+// The total is the same for both layouts; only the element ordering differs
 //
 // Returns:
 //   - int: total number of input elements
@@ -286,10 +706,10 @@ func (m *ONNXModel) GetExpectedInputSize() int {
 	return size
 }
 
-// GetNumClasses returns the number of output classes (8)
+// GetNumClasses returns the number of output classes (last output dimension, 8 by default)
 //
 // Returns:
 //   - int: number of classes
 func (m *ONNXModel) GetNumClasses() int {
-	return int(m.outputShape[1])
+	return int(m.outputShape[len(m.outputShape)-1])
 }
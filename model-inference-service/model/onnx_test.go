@@ -0,0 +1,212 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestRankTopK(t *testing.T) {
+	tests := []struct {
+		name          string
+		probabilities []float32
+		k             int
+		wantIndices   []int
+		wantProbs     []float32
+	}{
+		{
+			name:          "top 1",
+			probabilities: []float32{0.1, 0.7, 0.2},
+			k:             1,
+			wantIndices:   []int{1},
+			wantProbs:     []float32{0.7},
+		},
+		{
+			name:          "top 3 of 5",
+			probabilities: []float32{0.05, 0.4, 0.1, 0.25, 0.2},
+			k:             3,
+			wantIndices:   []int{1, 3, 4},
+			wantProbs:     []float32{0.4, 0.25, 0.2},
+		},
+		{
+			name:          "all classes",
+			probabilities: []float32{0.3, 0.1, 0.6},
+			k:             3,
+			wantIndices:   []int{2, 0, 1},
+			wantProbs:     []float32{0.6, 0.3, 0.1},
+		},
+		{
+			name:          "ties in ascending index order",
+			probabilities: []float32{0.1, 0.3, 0.1, 0.3, 0.2},
+			k:             5,
+			wantIndices:   []int{1, 3, 4, 0, 2},
+			wantProbs:     []float32{0.3, 0.3, 0.2, 0.1, 0.1},
+		},
+		{
+			// Selection sort swaps index 0 to the back; the tie break must
+			// still prefer the lower indices.
+			name:          "ties after a swap",
+			probabilities: []float32{0.2, 0.2, 0.2, 0.4},
+			k:             4,
+			wantIndices:   []int{3, 0, 1, 2},
+			wantProbs:     []float32{0.4, 0.2, 0.2, 0.2},
+		},
+		{
+			name:          "all equal",
+			probabilities: []float32{0.25, 0.25, 0.25, 0.25},
+			k:             2,
+			wantIndices:   []int{0, 1},
+			wantProbs:     []float32{0.25, 0.25},
+		},
+		{
+			name:          "k above the class count",
+			probabilities: []float32{0.2, 0.8},
+			k:             10,
+			wantIndices:   []int{1, 0},
+			wantProbs:     []float32{0.8, 0.2},
+		},
+		{
+			name:          "k of 0",
+			probabilities: []float32{0.2, 0.8},
+			k:             0,
+			wantIndices:   []int{1},
+			wantProbs:     []float32{0.8},
+		},
+		{
+			name:          "negative k",
+			probabilities: []float32{0.2, 0.8},
+			k:             -3,
+			wantIndices:   []int{1},
+			wantProbs:     []float32{0.8},
+		},
+		{
+			name:          "empty",
+			probabilities: nil,
+			k:             3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probabilities := append([]float32(nil), tt.probabilities...)
+			indices, probs := RankTopK(probabilities, tt.k)
+			if !reflect.DeepEqual(indices, tt.wantIndices) || !reflect.DeepEqual(probs, tt.wantProbs) {
+				t.Errorf("RankTopK(%v, %d) = %v, %v; want %v, %v", tt.probabilities, tt.k, indices, probs, tt.wantIndices, tt.wantProbs)
+			}
+			if !reflect.DeepEqual(probabilities, tt.probabilities) {
+				t.Errorf("RankTopK modified its input: %v, want %v", probabilities, tt.probabilities)
+			}
+		})
+	}
+}
+
+func TestRankAboveThresholdBreaksTiesByIndex(t *testing.T) {
+	indices, probs := RankAboveThreshold([]float32{0.9, 0.6, 0.9, 0.2, 0.6}, 0.5)
+	if want := []int{0, 2, 1, 4}; !reflect.DeepEqual(indices, want) {
+		t.Errorf("indices = %v, want %v", indices, want)
+	}
+	if want := []float32{0.9, 0.9, 0.6, 0.6}; !reflect.DeepEqual(probs, want) {
+		t.Errorf("probabilities = %v, want %v", probs, want)
+	}
+}
+
+func TestONNXModelRejectsConcurrentUse(t *testing.T) {
+	// The guard runs before the session is touched, so an instance without
+	// one is enough to exercise it.
+	m := &ONNXModel{}
+
+	// One goroutine holds the instance as a running inference does while
+	// another calls into it.
+	running := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		if err := m.acquire(); err != nil {
+			t.Errorf("acquire() error = %v", err)
+		}
+		close(running)
+		<-done
+		m.release()
+	}()
+	<-running
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	calls := []func() error{
+		func() error { _, err := m.Predict(make([]float32, 4)); return err },
+		func() error { _, err := m.PredictRaw(make([]float32, 4)); return err },
+		func() error { _, err := m.PredictBatch([][]float32{make([]float32, 4)}); return err },
+		func() error { _, _, err := m.PredictClass(make([]float32, 4)); return err },
+	}
+	for i, call := range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = call()
+		}()
+	}
+	wg.Wait()
+	close(done)
+
+	for i, err := range errs {
+		if !errors.Is(err, ErrConcurrentUse) {
+			t.Errorf("call %d on a busy instance: error = %v, want ErrConcurrentUse", i, err)
+		}
+	}
+}
+
+func TestONNXModelAdmitsOneCallAtATime(t *testing.T) {
+	m := &ONNXModel{}
+	const goroutines = 16
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	results := make([]error, goroutines)
+	for i := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			results[i] = m.acquire()
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	admitted := 0
+	for _, err := range results {
+		switch {
+		case err == nil:
+			admitted++
+		case !errors.Is(err, ErrConcurrentUse):
+			t.Errorf("acquire() error = %v, want nil or ErrConcurrentUse", err)
+		}
+	}
+	if admitted != 1 {
+		t.Errorf("%d goroutines acquired the instance, want exactly 1", admitted)
+	}
+
+	m.release()
+	if err := m.acquire(); err != nil {
+		t.Errorf("acquire() after release error = %v", err)
+	}
+}
+
+func BenchmarkRankTopK(b *testing.B) {
+	const numClasses = 10000
+	rng := rand.New(rand.NewSource(1))
+	probabilities := make([]float32, numClasses)
+	for i := range probabilities {
+		probabilities[i] = rng.Float32()
+	}
+
+	for _, k := range []int{1, 5, 100} {
+		b.Run(fmt.Sprintf("k=%d", k), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				RankTopK(probabilities, k)
+			}
+		})
+	}
+}
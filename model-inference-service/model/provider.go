@@ -0,0 +1,104 @@
+package model
+
+import (
+	"fmt"
+	"log/slog"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// ExecutionProvider selects the ONNX Runtime backend that runs the model
+//
+// The GPU providers need an onnxruntime shared library built with them:
+//   - cuda: the onnxruntime-linux-x64-gpu release, plus CUDA and cuDNN
+//     versions matching that release, visible on the library path
+//   - coreml: an onnxruntime build for macOS, which includes CoreML
+//
+// The CPU-only library referenced by the Dockerfile supports neither; when
+// a provider cannot be enabled the session falls back to CPU
+type ExecutionProvider string
+
+const (
+	// ProviderCPU runs the model on the default CPU execution provider
+	ProviderCPU ExecutionProvider = "cpu"
+	// ProviderCUDA runs the model on an NVIDIA GPU through CUDA
+	ProviderCUDA ExecutionProvider = "cuda"
+	// ProviderCoreML runs the model through Apple CoreML
+	ProviderCoreML ExecutionProvider = "coreml"
+)
+
+func (c ModelConfig) executionProvider() ExecutionProvider {
+	if c.ExecutionProvider == "" {
+		return ProviderCPU
+	}
+	return c.ExecutionProvider
+}
+
+// sessionSettings are the ModelConfig fields that shape ort.SessionOptions
+type sessionSettings struct {
+	provider       ExecutionProvider
+	intraOpThreads int
+	interOpThreads int
+}
+
+func (c ModelConfig) sessionSettings() sessionSettings {
+	return sessionSettings{
+		provider:       c.executionProvider(),
+		intraOpThreads: c.IntraOpThreads,
+		interOpThreads: c.InterOpThreads,
+	}
+}
+
+// newSessionOptions creates session options with the configured execution
+// provider and thread counts
+// If the provider cannot be appended, a warning is logged and the session
+// runs on CPU. Thread counts of 0 keep the ONNX Runtime defaults
+//
+// Parameters:
+//   - settings: requested execution provider and thread counts
+//
+// Returns:
+//   - *ort.SessionOptions: options to pass to the session; the caller must destroy them
+//   - error: error if the options cannot be created or a thread count is rejected
+func newSessionOptions(settings sessionSettings) (*ort.SessionOptions, error) {
+	options, err := ort.NewSessionOptions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session options: %w", err)
+	}
+
+	if settings.intraOpThreads > 0 {
+		if err := options.SetIntraOpNumThreads(settings.intraOpThreads); err != nil {
+			options.Destroy()
+			return nil, fmt.Errorf("failed to set intra-op thread count: %w", err)
+		}
+	}
+	if settings.interOpThreads > 0 {
+		if err := options.SetInterOpNumThreads(settings.interOpThreads); err != nil {
+			options.Destroy()
+			return nil, fmt.Errorf("failed to set inter-op thread count: %w", err)
+		}
+	}
+
+	if err := appendExecutionProvider(options, settings.provider); err != nil {
+		slog.Warn("execution provider unavailable, falling back to CPU",
+			"provider", string(settings.provider), "error", err)
+	}
+
+	return options, nil
+}
+
+func appendExecutionProvider(options *ort.SessionOptions, provider ExecutionProvider) error {
+	switch provider {
+	case ProviderCUDA:
+		cudaOptions, err := ort.NewCUDAProviderOptions()
+		if err != nil {
+			return err
+		}
+		defer cudaOptions.Destroy()
+		return options.AppendExecutionProviderCUDA(cudaOptions)
+	case ProviderCoreML:
+		return options.AppendExecutionProviderCoreML(0)
+	default:
+		return nil
+	}
+}
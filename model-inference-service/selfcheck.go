@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"model-inference-service/model"
+	"model-inference-service/service"
+	"time"
+)
+
+// checkedModel is the part of a loaded model that SelfCheck inspects;
+// *model.ONNXModel implements it.
+type checkedModel interface {
+	GetInputShape() []int64
+	GetOutputShape() []int64
+	GetNumClasses() int
+	GetExpectedInputSize() int
+	GetOutputActivation() model.Activation
+	Predict(input []float32) ([]float32, error)
+}
+
+// pinger is the part of a database handle that SelfCheck uses; *sql.DB
+// implements it.
+type pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// SelfCheck runs every startup validation against the loaded model, class
+// dictionary, normalization settings and database, including a test
+// inference, and returns all problems found joined into one error instead
+// of stopping at the first one. A nil sqlDB, as with the stdout event
+// sink, skips the database check.
+func SelfCheck(ctx context.Context, m checkedModel, classDict []service.ClassInfo, normalization NormalizationSettings, sqlDB pinger) error {
+	var problems []error
+
+	inputShape := m.GetInputShape()
+	if len(inputShape) != 4 {
+		problems = append(problems, fmt.Errorf("model input shape %v: expected 4 dimensions", inputShape))
+	}
+	for _, d := range inputShape {
+		if d <= 0 {
+			problems = append(problems, fmt.Errorf("model input shape %v: dimensions must be positive", inputShape))
+			break
+		}
+	}
+
+	outputShape := m.GetOutputShape()
+	if len(outputShape) != 2 || outputShape[1] <= 0 {
+		problems = append(problems, fmt.Errorf("model output shape %v: expected [batch, classes]", outputShape))
+	}
+
+	if len(classDict) == 0 {
+		problems = append(problems, errors.New("class dictionary is empty"))
+	}
+	if len(outputShape) == 2 && len(classDict) != m.GetNumClasses() {
+		problems = append(problems, fmt.Errorf("class dictionary has %d entries but model outputs %d classes",
+			len(classDict), m.GetNumClasses()))
+	}
+	for i, class := range classDict {
+		if class.Label == "" {
+			problems = append(problems, fmt.Errorf("class dictionary entry %d is empty", i))
+		}
+	}
+	// The test inference needs a usable input tensor.
+	if len(problems) == 0 {
+		problems = append(problems, checkInference(m, classDict)...)
+	}
+
+	_, normalizationProblems := normalization.parse()
+	problems = append(problems, normalizationProblems...)
+
+	if sqlDB != nil {
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if err := sqlDB.PingContext(pingCtx); err != nil {
+			problems = append(problems, fmt.Errorf("database ping failed: %v", err))
+		}
+	}
+
+	return errors.Join(problems...)
+}
+
+// selfTestInputValue fills the synthetic input of checkInference: a flat
+// mid-gray image under the default zero-one normalization.
+const selfTestInputValue = 0.5
+
+// probabilityTolerance bounds the float32 rounding error accepted when
+// checking that the outputs are probabilities.
+const probabilityTolerance = 1e-3
+
+// checkInference runs the model on a synthetic input and checks that it
+// returns one finite probability per class, and with softmax that they sum
+// to 1, so a model that loads but computes garbage fails at startup.
+func checkInference(m checkedModel, classDict []service.ClassInfo) []error {
+	input := make([]float32, m.GetExpectedInputSize())
+	for i := range input {
+		input[i] = selfTestInputValue
+	}
+	start := time.Now()
+	probabilities, err := m.Predict(input)
+	if err != nil {
+		return []error{fmt.Errorf("self-test inference failed: %v", err)}
+	}
+	elapsed := time.Since(start)
+
+	var problems []error
+	if len(probabilities) != len(classDict) {
+		problems = append(problems, fmt.Errorf("self-test inference returned %d outputs, expected one per class (%d)",
+			len(probabilities), len(classDict)))
+	}
+	activation := m.GetOutputActivation()
+	var sum float64
+	for i, p := range probabilities {
+		if math.IsNaN(float64(p)) || math.IsInf(float64(p), 0) {
+			problems = append(problems, fmt.Errorf("self-test inference output %d is %v", i, p))
+			return problems
+		}
+		if p < -probabilityTolerance || p > 1+probabilityTolerance {
+			problems = append(problems, fmt.Errorf("self-test inference output %d is %v, not a probability (activation %s)", i, p, activation))
+			return problems
+		}
+		sum += float64(p)
+	}
+	if activation == model.ActivationSoftmax && math.Abs(sum-1) > probabilityTolerance {
+		problems = append(problems, fmt.Errorf("self-test inference probabilities sum to %v, expected 1", sum))
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+
+	top, confidence := model.RankTopK(probabilities, 1)
+	log.Printf("Self-test inference passed in %v: output shape %v, top class %q (%.3f) on a synthetic input",
+		elapsed, m.GetOutputShape(), classDict[top[0]].Label, confidence[0])
+	return nil
+}
+
+// runSelfCheck runs SelfCheck and either fails startup with the full report
+// or, when warnOnly is set, logs each problem and lets startup continue.
+func runSelfCheck(ctx context.Context, m checkedModel, classDict []service.ClassInfo, normalization NormalizationSettings, sqlDB pinger, warnOnly bool) error {
+	err := SelfCheck(ctx, m, classDict, normalization, sqlDB)
+	if err == nil {
+		log.Println("Startup self-check passed")
+		return nil
+	}
+
+	if warnOnly {
+		log.Printf("Startup self-check found problems (continuing, SELF_CHECK_WARN_ONLY is set):\n%v", err)
+		return nil
+	}
+
+	return fmt.Errorf("startup self-check failed:\n%v", err)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"model-inference-service/model"
+	"model-inference-service/service"
+	"strings"
+	"testing"
+)
+
+// stubModel is a checkedModel with a 1x2x2x3 input, unless inputShape is
+// set, whose Predict returns output or err.
+type stubModel struct {
+	inputShape  []int64
+	outputShape []int64
+	output      []float32
+	err         error
+}
+
+func (m *stubModel) GetInputShape() []int64 {
+	if m.inputShape != nil {
+		return m.inputShape
+	}
+	return []int64{1, 2, 2, 3}
+}
+
+func (m *stubModel) GetOutputShape() []int64               { return m.outputShape }
+func (m *stubModel) GetNumClasses() int                    { return int(m.outputShape[len(m.outputShape)-1]) }
+func (m *stubModel) GetExpectedInputSize() int             { return 2 * 2 * 3 }
+func (m *stubModel) GetOutputActivation() model.Activation { return model.ActivationSoftmax }
+
+func (m *stubModel) Predict([]float32) ([]float32, error) {
+	return m.output, m.err
+}
+
+// stubDB is a pinger returning err.
+type stubDB struct{ err error }
+
+func (db stubDB) PingContext(context.Context) error { return db.err }
+
+func TestRunSelfCheck(t *testing.T) {
+	classes := []service.ClassInfo{{Label: "acne"}, {Label: "eczema"}, {Label: "psoriasis"}}
+
+	tests := []struct {
+		name  string
+		model *stubModel
+		// classes replaces the default dictionary when not nil.
+		classes       []service.ClassInfo
+		normalization NormalizationSettings
+		db            stubDB
+		want          []string
+	}{
+		{
+			name:  "passes",
+			model: &stubModel{outputShape: []int64{1, 3}, output: []float32{0.2, 0.5, 0.3}},
+		},
+		{
+			name:  "inference error",
+			model: &stubModel{outputShape: []int64{1, 3}, err: errors.New("session run failed")},
+			want:  []string{"self-test inference failed: session run failed"},
+		},
+		{
+			name:  "wrong output length",
+			model: &stubModel{outputShape: []int64{1, 3}, output: []float32{0.5, 0.5}},
+			want:  []string{"self-test inference returned 2 outputs, expected one per class (3)"},
+		},
+		{
+			name:  "not probabilities",
+			model: &stubModel{outputShape: []int64{1, 3}, output: []float32{0.2, 4, 0.3}},
+			want:  []string{"self-test inference output 1 is 4, not a probability"},
+		},
+		{
+			name:  "wrong output shape",
+			model: &stubModel{outputShape: []int64{1, 3, 1}},
+			want:  []string{"model output shape [1 3 1]: expected [batch, classes]"},
+		},
+		{
+			name:  "class count mismatch and database down",
+			model: &stubModel{outputShape: []int64{1, 4}},
+			db:    stubDB{err: errors.New("connection refused")},
+			want: []string{
+				"class dictionary has 3 entries but model outputs 4 classes",
+				"database ping failed: connection refused",
+			},
+		},
+		{
+			name:          "input shape, empty dictionary and normalization",
+			model:         &stubModel{inputShape: []int64{1, 0, 2}, outputShape: []int64{1, 3}},
+			classes:       []service.ClassInfo{},
+			normalization: NormalizationSettings{Mode: "zscore", Mean: "0.5,0.5", Std: "0.2,0,0.2"},
+			want: []string{
+				"model input shape [1 0 2]: expected 4 dimensions",
+				"model input shape [1 0 2]: dimensions must be positive",
+				"class dictionary is empty",
+				`invalid PREPROCESS_NORMALIZATION: unknown normalization mode "zscore"`,
+				"invalid PREPROCESS_MEAN: expected 3 comma-separated values",
+				"invalid PREPROCESS_STD: channel 1 must be positive",
+			},
+		},
+		{
+			name:          "input shape, empty label and normalization",
+			model:         &stubModel{inputShape: []int64{1, 2, 2}, outputShape: []int64{1, 3}},
+			classes:       []service.ClassInfo{{Label: "acne"}, {Label: ""}, {Label: "psoriasis"}},
+			normalization: NormalizationSettings{Mode: "imagenet", Std: "a,b,c"},
+			want: []string{
+				"model input shape [1 2 2]: expected 4 dimensions",
+				"class dictionary entry 1 is empty",
+				`invalid PREPROCESS_STD: invalid value "a"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			classes := classes
+			if tt.classes != nil {
+				classes = tt.classes
+			}
+
+			err := runSelfCheck(context.Background(), tt.model, classes, tt.normalization, tt.db, false)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("runSelfCheck() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("runSelfCheck() succeeded, want startup to abort")
+			}
+			if !strings.HasPrefix(err.Error(), "startup self-check failed:\n") {
+				t.Errorf("runSelfCheck() error = %q, want the startup self-check prefix", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("runSelfCheck() error = %q, want it to contain %q", err, want)
+				}
+			}
+
+			if err := runSelfCheck(context.Background(), tt.model, classes, tt.normalization, tt.db, true); err != nil {
+				t.Errorf("runSelfCheck() with warnOnly error = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestSelfCheckWithoutDatabase(t *testing.T) {
+	m := &stubModel{outputShape: []int64{1, 2}, output: []float32{0.4, 0.6}}
+	classes := []service.ClassInfo{{Label: "acne"}, {Label: "eczema"}}
+
+	if err := SelfCheck(context.Background(), m, classes, NormalizationSettings{}, nil); err != nil {
+		t.Fatalf("SelfCheck() without a database error = %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ClassInfo is the metadata shown to users for one model output class.
+type ClassInfo struct {
+	Label          string `json:"label"`
+	Description    string `json:"description"`
+	Recommendation string `json:"recommendation"`
+}
+
+// ParseClassDictionary parses a class dictionary in either the object format
+// [{"label", "description", "recommendation"}, ...] or the legacy flat
+// format ["label", ...], in which case description and recommendation are
+// left empty. Entries are ordered by model output index.
+func ParseClassDictionary(data []byte) ([]ClassInfo, error) {
+	var labels []string
+	if err := json.Unmarshal(data, &labels); err == nil {
+		classes := make([]ClassInfo, len(labels))
+		for i, label := range labels {
+			classes[i] = ClassInfo{Label: label}
+		}
+		return classes, nil
+	}
+
+	var classes []ClassInfo
+	if err := json.Unmarshal(data, &classes); err != nil {
+		return nil, fmt.Errorf("expected an array of labels or of {label, description, recommendation} objects: %v", err)
+	}
+	for i, class := range classes {
+		if class.Label == "" {
+			return nil, fmt.Errorf("class %d has no label", i)
+		}
+	}
+
+	return classes, nil
+}
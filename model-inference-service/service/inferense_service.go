@@ -1,87 +1,836 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math"
+	"model-inference-service/metrics"
 	"model-inference-service/model"
+	"model-inference-service/tracing"
+	"runtime/debug"
+	"sort"
 	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// ErrNoSignal is returned when the raw model output is all zeros, the same
+// for every class or contains non-finite values, in which case there is no
+// meaningful top class to report.
+var ErrNoSignal = errors.New("inference produced no signal")
+
+// ErrModelPanic is returned when a model instance panics during inference.
+// The panic is recovered and logged with its stack, so it fails the call
+// rather than the process.
+var ErrModelPanic = errors.New("model panicked during inference")
+
+// DefaultModel is the name NewInferenceService registers its single model under.
+const DefaultModel = "default"
+
+// DefaultTopK is the number of predictions Analyze returns when
+// AnalyzeOptions.TopK is 0 and SetDefaultTopK has not been called.
+const DefaultTopK = 3
+
+// DefaultReviewMessage is the advice attached to analyses flagged for
+// review when SetReviewPolicy is not given a message.
+const DefaultReviewMessage = "The model is not confident about this result. Please consult a dermatologist or another healthcare professional for an accurate diagnosis."
+
+// InferenceService runs predictions on pools of model instances, one pool
+// per named model. Each instance owns its own session and tensors, so up to
+// the pool size requests run inference concurrently on a model; further
+// requests wait for a free instance.
+//
+// Requests are routed to a model by name, falling back to the primary model
+// when no name is given or the name is not registered.
+//
+// Every call is bounded by the caller's context and by the service timeout.
+// ONNX Runtime cannot interrupt a running session, so when the deadline
+// passes the call returns immediately and the instance rejoins the pool
+// once its run finishes.
+//
+// A model can be replaced at runtime with ReloadNamedModel; calls already
+// running on the previous pool finish on it before it is closed.
 type InferenceService struct {
-	model     *model.ONNXModel
-	classDict []string
-	mu        sync.Mutex
+	// mu guards the entries of models, which reloads replace.
+	mu      sync.RWMutex
+	models  map[string]*modelPool
+	primary string
+	timeout time.Duration
+	topK    int
+	// reviewThreshold and reviewMessage flag uncertain analyses, see
+	// SetReviewPolicy.
+	reviewThreshold float32
+	reviewMessage   string
+
+	loader  ModelLoader
+	remover ModelRemover
+	// drains tracks replaced pools that are waiting for their in-flight
+	// calls before being closed.
+	drains sync.WaitGroup
+}
+
+// ModelSet is the instances and class dictionary of one named model.
+type ModelSet struct {
+	// Path is the local model file the predictors were loaded from.
+	Path string
+	// Source is the remote location Path was downloaded from, if any.
+	// ReloadNamedModel reloads from Source, or Path when it is empty.
+	Source string
+	// Predictors must all be instances of the same model and config.
+	Predictors []Predictor
+	ClassDict  []ClassInfo
+	// LabelGroups optionally merges output classes into coarser reported
+	// labels; see LabelGroup.
+	LabelGroups []LabelGroup
+}
+
+// Validate checks that the set has instances, that its class dictionary
+// has one entry per model output class, so every predicted index resolves
+// to a label, and that its label groups only reference those classes.
+func (set ModelSet) Validate() error {
+	if len(set.Predictors) == 0 {
+		return errors.New("no model instances")
+	}
+	if numClasses := set.Predictors[0].GetNumClasses(); numClasses != len(set.ClassDict) {
+		return fmt.Errorf("model outputs %d classes but the class dictionary has %d entries",
+			numClasses, len(set.ClassDict))
+	}
+	if len(set.LabelGroups) > 0 {
+		// Summing independent sigmoid probabilities does not give the
+		// probability of the group.
+		if set.Predictors[0].GetOutputActivation() == model.ActivationSigmoid {
+			return errors.New("label groups are not supported for sigmoid models")
+		}
+		if _, err := newLabelMerge(set.ClassDict, set.LabelGroups); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func NewInferenceService(m *model.ONNXModel, c []string) *InferenceService {
+// modelPool holds the checked-in instances of one model.
+type modelPool struct {
+	name      string
+	pool      chan Predictor
+	size      int
+	path      string
+	source    string
+	sha256    string
+	layout    model.Layout
+	inputSize int
+	// inputWidth and inputHeight are the image dimensions of the input.
+	inputWidth  int
+	inputHeight int
+	// multiLabel is set for sigmoid models, which report every class
+	// reaching threshold instead of the top k.
+	multiLabel bool
+	threshold  float32
+	classDict  []ClassInfo
+	// labelGroups and merge are nil when classes are reported unmerged.
+	labelGroups []LabelGroup
+	merge       *labelMerge
+	// inflight counts the calls checked out on the pool with checkout.
+	inflight sync.WaitGroup
+}
+
+func newModelPool(name string, set ModelSet) *modelPool {
+	p := &modelPool{
+		name:        name,
+		pool:        make(chan Predictor, len(set.Predictors)),
+		size:        len(set.Predictors),
+		path:        set.Path,
+		source:      set.Source,
+		classDict:   set.ClassDict,
+		labelGroups: set.LabelGroups,
+	}
+	if len(set.LabelGroups) > 0 {
+		// Sets are validated before pooling, so the groups are consistent.
+		p.merge, _ = newLabelMerge(set.ClassDict, set.LabelGroups)
+	}
+	for _, m := range set.Predictors {
+		p.pool <- m
+	}
+	if len(set.Predictors) > 0 {
+		p.layout = set.Predictors[0].GetLayout()
+		p.inputWidth, p.inputHeight = set.Predictors[0].GetInputSize()
+		p.inputSize = set.Predictors[0].GetExpectedInputSize()
+		p.multiLabel = set.Predictors[0].GetOutputActivation() == model.ActivationSigmoid
+		p.threshold = set.Predictors[0].GetMultiLabelThreshold()
+	}
+	metrics.InitPredictedClasses(name, p.reportedLabels())
+	return p
+}
+
+// NewInferenceService builds a service over the given predictors, which
+// must all be instances of the same model and config, registered as
+// DefaultModel. A timeout of 0 leaves calls bounded only by their context.
+func NewInferenceService(models []Predictor, c []ClassInfo, timeout time.Duration) *InferenceService {
 	return &InferenceService{
-		model:     m,
-		classDict: c,
+		models:  map[string]*modelPool{DefaultModel: newModelPool(DefaultModel, ModelSet{Predictors: models, ClassDict: c})},
+		primary: DefaultModel,
+		timeout: timeout,
+		topK:    DefaultTopK,
 	}
 }
 
-func (s *InferenceService) Predict(input []float32) ([]float32, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	return s.model.Predict(input)
+// NewMultiModelInferenceService builds a service over several named models.
+// primary must be one of the names and serves requests that do not select
+// a registered model. Every set must pass ModelSet.Validate.
+func NewMultiModelInferenceService(sets map[string]ModelSet, primary string, timeout time.Duration) (*InferenceService, error) {
+	if _, ok := sets[primary]; !ok {
+		return nil, fmt.Errorf("primary model %q is not configured", primary)
+	}
+
+	s := &InferenceService{
+		models:  make(map[string]*modelPool, len(sets)),
+		primary: primary,
+		timeout: timeout,
+		topK:    DefaultTopK,
+	}
+	for name, set := range sets {
+		if err := set.Validate(); err != nil {
+			return nil, fmt.Errorf("model %q: %w", name, err)
+		}
+		p := newModelPool(name, set)
+		if set.Path != "" {
+			digest, err := model.FileSHA256(set.Path)
+			if err != nil {
+				return nil, fmt.Errorf("model %q: %w", name, err)
+			}
+			p.sha256 = digest
+		}
+		s.models[name] = p
+	}
+	return s, nil
+}
+
+// SetDefaultTopK sets the number of predictions returned when a request
+// does not choose one. It must be called before the service is used.
+func (s *InferenceService) SetDefaultTopK(k int) {
+	s.topK = k
+}
+
+// SetReviewPolicy flags analyses whose top reported class has a confidence
+// below threshold as needing review, with message as advice; an empty
+// message selects DefaultReviewMessage and a threshold of 0 disables the
+// flag. It must be called before the service is used.
+func (s *InferenceService) SetReviewPolicy(threshold float32, message string) {
+	if message == "" {
+		message = DefaultReviewMessage
+	}
+	s.reviewThreshold = threshold
+	s.reviewMessage = message
+}
+
+// ResolveModel returns the registered model that serves name, which is name
+// itself when such a model exists and the primary model otherwise.
+func (s *InferenceService) ResolveModel(name string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.resolveModel(name)
+}
+
+// resolveModel is ResolveModel for callers holding mu.
+func (s *InferenceService) resolveModel(name string) string {
+	if _, ok := s.models[name]; ok {
+		return name
+	}
+	return s.primary
+}
+
+// Models returns the names of the registered models in sorted order.
+func (s *InferenceService) Models() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.models))
+	for name := range s.models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// model returns the pool serving name, see ResolveModel.
+func (s *InferenceService) model(name string) *modelPool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.models[s.resolveModel(name)]
+}
+
+// checkout returns the pool serving name and registers a call on it, so a
+// reload does not close the pool under the call. The call must be passed
+// to runPooled, which ends the checkout.
+func (s *InferenceService) checkout(name string) *modelPool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p := s.models[s.resolveModel(name)]
+	p.inflight.Add(1)
+	return p
+}
+
+// acquire checks out a model instance, blocking until one is free or ctx is done.
+func (p *modelPool) acquire(ctx context.Context) (Predictor, error) {
+	select {
+	case m := <-p.pool:
+		return m, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("no model instance available: %w", ctx.Err())
+	}
+}
+
+// release returns a model instance checked out with acquire.
+func (p *modelPool) release(m Predictor) {
+	p.pool <- m
+}
+
+func (s *InferenceService) Predict(ctx context.Context, input []float32) ([]float32, error) {
+	return s.predict(ctx, s.checkout(""), input)
+}
+
+func (s *InferenceService) PredictClass(ctx context.Context, input []float32) (int, float32, error) {
+	probabilities, err := s.predict(ctx, s.checkout(""), input)
+	if err != nil {
+		return -1, 0, err
+	}
+
+	indices, probs := model.RankTopK(probabilities, 1)
+	return indices[0], probs[0], nil
+}
+
+func (s *InferenceService) GetTopKPredictions(ctx context.Context, input []float32, k int) ([]PredictionResult, error) {
+	analysis, err := s.Analyze(ctx, input, AnalyzeOptions{TopK: k})
+	if err != nil {
+		return nil, err
+	}
+	return analysis.Predictions, nil
+}
+
+// Analysis is the ranked outcome of a single inference.
+type Analysis struct {
+	Predictions []PredictionResult `json:"predictions"`
+	// Margin is the probability gap between the top-1 and top-2 reported
+	// classes, regardless of how many predictions were requested. It is nil
+	// when there are fewer than two reported classes.
+	Margin *float32 `json:"margin"`
+	// Probabilities maps every model class label to its raw score, before
+	// any label merging. It is only set when
+	// AnalyzeOptions.IncludeProbabilities is true.
+	Probabilities map[string]float32 `json:"probabilities,omitempty"`
+	// NeedsReview is set when the top reported class is below the review
+	// threshold, in which case ReviewMessage advises seeing a professional
+	// rather than relying on the predicted label.
+	NeedsReview   bool   `json:"needs_review"`
+	ReviewMessage string `json:"review_message,omitempty"`
+	// Model is the name of the model that produced the analysis and
+	// ModelVersion the SHA-256 digest of its file at the time, so results
+	// can be traced to the exact model across reloads. ModelVersion is
+	// empty for models not loaded from a file.
+	Model        string `json:"model"`
+	ModelVersion string `json:"model_version,omitempty"`
+}
+
+// UncertainLabel is the class name of the sentinel result returned when no
+// prediction reaches the requested minimum confidence.
+const UncertainLabel = "uncertain"
+
+// AnalyzeOptions are the per-request settings of Analyze.
+type AnalyzeOptions struct {
+	// TopK is the maximum number of predictions to return, clamped to
+	// [1, number of classes]. 0 selects the service default. Multi-label
+	// models ignore it and return every class reaching their threshold.
+	TopK int
+	// MinConfidence drops predictions whose probability is below it. When
+	// every prediction is dropped a single UncertainLabel result is returned.
+	MinConfidence float32
+	// IncludeProbabilities adds the full class distribution to the Analysis.
+	IncludeProbabilities bool
+	// Model selects the model to run, see ResolveModel. Empty selects the
+	// primary model.
+	Model string
+}
+
+// Analyze runs inference once and returns the top predictions together
+// with the top-1/top-2 margin.
+func (s *InferenceService) Analyze(ctx context.Context, input []float32, opts AnalyzeOptions) (*Analysis, error) {
+	ctx, span := s.startSpan(ctx, "InferenceService.Analyze", opts.Model)
+	defer span.End()
+
+	opts = s.withDefaults(opts)
+	p := s.checkout(opts.Model)
+	probabilities, err := s.predict(ctx, p, input)
+	if err != nil {
+		return nil, failSpan(span, err)
+	}
+
+	analysis, err := p.buildAnalysis(probabilities, opts)
+	if err != nil {
+		return nil, failSpan(span, err)
+	}
+	s.flagForReview(analysis)
+	return analysis, nil
+}
+
+// PredictBatch runs inference on several inputs in one model call.
+func (s *InferenceService) PredictBatch(ctx context.Context, inputs [][]float32) ([][]float32, error) {
+	return s.predictBatch(ctx, s.checkout(""), inputs)
+}
+
+// AnalyzeBatch runs inference on several inputs in one model call and
+// returns one Analysis per input, in input order.
+func (s *InferenceService) AnalyzeBatch(ctx context.Context, inputs [][]float32, opts AnalyzeOptions) ([]*Analysis, error) {
+	images := make([][][]float32, len(inputs))
+	for i := range inputs {
+		images[i] = inputs[i : i+1]
+	}
+	return s.AnalyzeBatchViews(ctx, images, opts)
+}
+
+// AnalyzeViews runs inference on several views of one image, such as the
+// crops of multi-crop preprocessing, and analyzes the mean of their
+// probabilities. The views run one after the other on a single model
+// instance, so the model needs no dynamic batch dimension; every view must
+// have a signal.
+func (s *InferenceService) AnalyzeViews(ctx context.Context, views [][]float32, opts AnalyzeOptions) (*Analysis, error) {
+	ctx, span := s.startSpan(ctx, "InferenceService.AnalyzeViews", opts.Model)
+	defer span.End()
+	span.SetAttributes(attribute.Int("inference.views", len(views)))
+	if len(views) == 0 {
+		return nil, failSpan(span, errors.New("no input views"))
+	}
+
+	opts = s.withDefaults(opts)
+	p := s.checkout(opts.Model)
+	probabilities, err := runPooled(ctx, s, p, func(m Predictor) ([]float32, error) {
+		outputs := make([][]float32, len(views))
+		for i, view := range views {
+			output, err := predictOutput(m, view)
+			if err != nil {
+				return nil, fmt.Errorf("view %d: %w", i, err)
+			}
+			outputs[i] = output
+		}
+		return meanOutput(outputs), nil
+	})
+	if err != nil {
+		return nil, failSpan(span, err)
+	}
+
+	analysis, err := p.buildAnalysis(probabilities, opts)
+	if err != nil {
+		return nil, failSpan(span, err)
+	}
+	s.flagForReview(analysis)
+	return analysis, nil
+}
+
+// AnalyzeBatchViews is AnalyzeViews for several images in one model call:
+// every view of every image is stacked into a single batch, and each
+// image's Analysis is built from the mean of its views, in image order.
+func (s *InferenceService) AnalyzeBatchViews(ctx context.Context, images [][][]float32, opts AnalyzeOptions) ([]*Analysis, error) {
+	ctx, span := s.startSpan(ctx, "InferenceService.AnalyzeBatch", opts.Model)
+	defer span.End()
+	span.SetAttributes(attribute.Int("inference.batch_size", len(images)))
+
+	var inputs [][]float32
+	for i, views := range images {
+		if len(views) == 0 {
+			return nil, failSpan(span, fmt.Errorf("input %d: no input views", i))
+		}
+		inputs = append(inputs, views...)
+	}
+
+	opts = s.withDefaults(opts)
+	p := s.checkout(opts.Model)
+	batch, err := s.predictBatch(ctx, p, inputs)
+	if err != nil {
+		return nil, failSpan(span, err)
+	}
+
+	analyses := make([]*Analysis, len(images))
+	for i, views := range images {
+		analysis, err := p.buildAnalysis(meanOutput(batch[:len(views)]), opts)
+		if err != nil {
+			return nil, failSpan(span, err)
+		}
+		batch = batch[len(views):]
+		s.flagForReview(analysis)
+		analyses[i] = analysis
+	}
+
+	return analyses, nil
 }
 
-func (s *InferenceService) PredictClass(input []float32) (int, float32, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	return s.model.PredictClass(input)
+// meanOutput averages equally sized output vectors. A single vector is
+// returned as is.
+func meanOutput(outputs [][]float32) []float32 {
+	if len(outputs) == 1 {
+		return outputs[0]
+	}
+	mean := make([]float32, len(outputs[0]))
+	for _, output := range outputs {
+		for i, v := range output {
+			mean[i] += v
+		}
+	}
+	for i := range mean {
+		mean[i] /= float32(len(outputs))
+	}
+	return mean
 }
 
-func (s *InferenceService) GetTopKPredictions(input []float32, k int) ([]PredictionResult, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// withDefaults fills the options left unset by the request.
+func (s *InferenceService) withDefaults(opts AnalyzeOptions) AnalyzeOptions {
+	if opts.TopK <= 0 {
+		opts.TopK = s.topK
+	}
+	return opts
+}
 
-	indices, probs, err := s.model.GetTopKPredictions(input, k)
+// buildAnalysis merges an output vector into the reported classes, ranks
+// it and resolves class names. Multi-label models report every class
+// reaching their threshold, regardless of opts.TopK.
+func (p *modelPool) buildAnalysis(probabilities []float32, opts AnalyzeOptions) (*Analysis, error) {
+	reported, err := p.reported(probabilities)
 	if err != nil {
 		return nil, err
 	}
+	indices, probs := model.RankTopK(reported, opts.TopK)
+	minConfidence, cutoff := opts.MinConfidence, "minimum confidence"
+	if p.multiLabel && p.threshold > minConfidence {
+		minConfidence, cutoff = p.threshold, "multi-label threshold"
+	}
+	if p.multiLabel {
+		indices, probs = model.RankTopK(reported, len(reported))
+	}
 
-	results := make([]PredictionResult, len(indices))
+	results := make([]PredictionResult, 0, len(indices))
 	for i := range indices {
-		className, err := s.GetClassName(indices[i])
+		if probs[i] < minConfidence {
+			continue
+		}
+		classIndex, info, err := p.reportedClass(indices[i])
 		if err != nil {
 			return nil, err
 		}
-		results[i] = PredictionResult{
-			ClassIndex: indices[i],
-			ClassName:  className,
-			Confidence: probs[i],
+		results = append(results, PredictionResult{
+			ClassIndex:     classIndex,
+			ClassName:      info.Label,
+			Description:    info.Description,
+			Recommendation: info.Recommendation,
+			Confidence:     probs[i],
+		})
+	}
+
+	if len(results) == 0 {
+		results = append(results, PredictionResult{
+			ClassIndex:  -1,
+			ClassName:   UncertainLabel,
+			Description: fmt.Sprintf("No condition reached the %s of %.2f", cutoff, minConfidence),
+			Confidence:  probs[0],
+		})
+	}
+
+	analysis := &Analysis{
+		Predictions:  results,
+		Margin:       topMargin(reported),
+		Model:        p.name,
+		ModelVersion: p.sha256,
+	}
+
+	// Drift monitoring counts the top class even when it is filtered out.
+	_, top, err := p.reportedClass(indices[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.IncludeProbabilities {
+		analysis.Probabilities = make(map[string]float32, len(probabilities))
+		for i, probability := range probabilities {
+			info, err := p.classInfo(i)
+			if err != nil {
+				return nil, err
+			}
+			analysis.Probabilities[info.Label] = probability
 		}
 	}
 
-	return results, nil
+	metrics.RecordPrediction(p.name, top.Label)
+	return analysis, nil
+}
+
+// flagForReview applies the review policy to an analysis. The first
+// prediction holds the top reported confidence, also when it is the
+// UncertainLabel sentinel.
+func (s *InferenceService) flagForReview(analysis *Analysis) {
+	if analysis.Predictions[0].Confidence < s.reviewThreshold {
+		analysis.NeedsReview = true
+		analysis.ReviewMessage = s.reviewMessage
+	}
+}
+
+// reported returns the probabilities of the reported classes: the output
+// vector itself, or its sums per label group when labels are merged.
+func (p *modelPool) reported(probabilities []float32) ([]float32, error) {
+	if p.merge == nil {
+		return probabilities, nil
+	}
+	if len(probabilities) != len(p.merge.target) {
+		return nil, fmt.Errorf("model returned %d probabilities, expected %d", len(probabilities), len(p.merge.target))
+	}
+	return p.merge.apply(probabilities), nil
+}
+
+// reportedLabels returns the labels of the reported classes.
+func (p *modelPool) reportedLabels() []string {
+	classes := p.classDict
+	if p.merge != nil {
+		classes = p.merge.classes
+	}
+	labels := make([]string, len(classes))
+	for i, class := range classes {
+		labels[i] = class.Label
+	}
+	return labels
+}
+
+// reportedClass returns the class index and metadata of reported class i.
+// A merged label reports the lowest output index of its group.
+func (p *modelPool) reportedClass(i int) (int, ClassInfo, error) {
+	if p.merge == nil {
+		info, err := p.classInfo(i)
+		return i, info, err
+	}
+	return p.merge.index[i], p.merge.classes[i], nil
+}
+
+// topMargin returns the difference between the two highest probabilities,
+// or nil when there are fewer than two classes.
+func topMargin(probabilities []float32) *float32 {
+	if len(probabilities) < 2 {
+		return nil
+	}
+	_, top := model.RankTopK(probabilities, 2)
+	margin := top[0] - top[1]
+	return &margin
+}
+
+// predict runs a pooled model instance, rejects degenerate raw outputs and
+// applies the output activation.
+func (s *InferenceService) predict(ctx context.Context, p *modelPool, input []float32) ([]float32, error) {
+	return runPooled(ctx, s, p, func(m Predictor) ([]float32, error) {
+		return predictOutput(m, input)
+	})
+}
+
+// predictOutput runs m on input, rejects a degenerate raw output and
+// applies the output activation.
+func predictOutput(m Predictor, input []float32) ([]float32, error) {
+	output, err := m.PredictRaw(input)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSignal(output); err != nil {
+		return nil, err
+	}
+	return m.GetOutputActivation().Apply(output), nil
+}
+
+// predictBatch is predict for a batch of inputs run in one model call.
+func (s *InferenceService) predictBatch(ctx context.Context, p *modelPool, inputs [][]float32) ([][]float32, error) {
+	return runPooled(ctx, s, p, func(m Predictor) ([][]float32, error) {
+		outputs, err := m.PredictBatchRaw(inputs)
+		if err != nil {
+			return nil, err
+		}
+		activation := m.GetOutputActivation()
+		for i, output := range outputs {
+			if err := checkSignal(output); err != nil {
+				return nil, fmt.Errorf("input %d: %w", i, err)
+			}
+			outputs[i] = activation.Apply(output)
+		}
+		return outputs, nil
+	})
+}
+
+// startSpan starts a span for an inference call on the model serving name.
+func (s *InferenceService) startSpan(ctx context.Context, spanName, name string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, spanName,
+		trace.WithAttributes(attribute.String("inference.model", s.ResolveModel(name))))
+}
+
+// failSpan records err on span and returns it.
+func failSpan(span trace.Span, err error) error {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, "inference failed")
+	return err
+}
+
+// runPooled runs fn on an instance of p, giving up when ctx or the service
+// timeout expires. p must come from checkout. The instance is released and
+// the checkout ended when fn returns, even if the caller has already given
+// up on it.
+func runPooled[T any](ctx context.Context, s *InferenceService, p *modelPool, fn func(m Predictor) (T, error)) (T, error) {
+	var zero T
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	m, err := p.acquire(ctx)
+	if err != nil {
+		p.inflight.Done()
+		return zero, err
+	}
+
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer p.inflight.Done()
+		defer p.release(m)
+		// The call runs on its own goroutine, where a panic would crash the
+		// process past any recovery in the transports.
+		defer func() {
+			if v := recover(); v != nil {
+				slog.Error("model panicked during inference", "model", p.name, "panic", v, "stack", string(debug.Stack()))
+				done <- result{err: fmt.Errorf("%w: %v", ErrModelPanic, v)}
+			}
+		}()
+		value, err := fn(m)
+		done <- result{value: value, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		return zero, fmt.Errorf("inference aborted: %w", ctx.Err())
+	}
+}
+
+// checkSignal reports ErrNoSignal when the raw output vector is empty,
+// contains NaN/Inf values or holds the same value for every class. It must
+// run before the activation: softmax turns all-zero or constant logits
+// into a uniform distribution that looks like a valid result.
+func checkSignal(output []float32) error {
+	if len(output) == 0 {
+		return fmt.Errorf("%w: output is empty", ErrNoSignal)
+	}
+	constant := true
+	for i, v := range output {
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return fmt.Errorf("%w: non-finite value at class index %d", ErrNoSignal, i)
+		}
+		if v != output[0] {
+			constant = false
+		}
+	}
+	switch {
+	case constant && output[0] == 0:
+		return fmt.Errorf("%w: output is all zeros", ErrNoSignal)
+	case constant && len(output) > 1:
+		return fmt.Errorf("%w: output is %v for every class", ErrNoSignal, output[0])
+	}
+	return nil
 }
 
 type PredictionResult struct {
-	ClassIndex int     `json:"class_index"`
-	ClassName  string  `json:"class_name"`
-	Confidence float32 `json:"confidence"`
+	// ClassIndex is the model output index of the class. A merged label
+	// reports the lowest index of its group.
+	ClassIndex     int     `json:"class_index"`
+	ClassName      string  `json:"class_name"`
+	Description    string  `json:"description,omitempty"`
+	Recommendation string  `json:"recommendation,omitempty"`
+	Confidence     float32 `json:"confidence"`
 }
 
 func (s *InferenceService) GetClassName(classIndex int) (string, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	info, err := s.GetClassInfo(classIndex)
+	if err != nil {
+		return "", err
+	}
+	return info.Label, nil
+}
 
-	if s.classDict == nil {
-		return "", fmt.Errorf("class dictionary is nil")
+// GetClassInfo returns the label, description and recommendation of a
+// class of the primary model.
+func (s *InferenceService) GetClassInfo(classIndex int) (ClassInfo, error) {
+	return s.model("").classInfo(classIndex)
+}
+
+// classInfo resolves a class index to its metadata.
+func (p *modelPool) classInfo(classIndex int) (ClassInfo, error) {
+	if p.classDict == nil {
+		return ClassInfo{}, fmt.Errorf("class dictionary is nil")
 	}
 
-	if classIndex >= 0 && classIndex < len(s.classDict) {
-		return (s.classDict)[classIndex], nil
+	if classIndex >= 0 && classIndex < len(p.classDict) {
+		return p.classDict[classIndex], nil
 	}
 
-	return "", fmt.Errorf("unknown class index: %d", classIndex)
+	return ClassInfo{}, fmt.Errorf("unknown class index: %d", classIndex)
 }
 
-func (s *InferenceService) ValidateInput(input []float32) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// Ready reports whether every registered model has been loaded and can
+// serve predictions.
+func (s *InferenceService) Ready() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	expectedSize := s.model.GetExpectedInputSize()
+	if len(s.models) == 0 {
+		return false
+	}
+	for _, p := range s.models {
+		if p.size == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// PoolSize returns the number of primary model instances serving predictions.
+func (s *InferenceService) PoolSize() int {
+	return s.model("").size
+}
+
+// InputLayout returns the tensor layout the primary model expects
+// preprocessed input in.
+func (s *InferenceService) InputLayout() model.Layout {
+	return s.model("").layout
+}
+
+// ModelInputLayout returns the tensor layout the model serving name expects
+// preprocessed input in.
+func (s *InferenceService) ModelInputLayout(name string) model.Layout {
+	return s.model(name).layout
+}
+
+// InputSize returns the image dimensions the primary model expects
+// preprocessed input at.
+func (s *InferenceService) InputSize() (width, height int) {
+	p := s.model("")
+	return p.inputWidth, p.inputHeight
+}
+
+// ModelInputSize returns the image dimensions the model serving name
+// expects preprocessed input at.
+func (s *InferenceService) ModelInputSize(name string) (width, height int) {
+	p := s.model(name)
+	return p.inputWidth, p.inputHeight
+}
+
+func (s *InferenceService) ValidateInput(input []float32) error {
+	expectedSize := s.model("").inputSize
 	if len(input) != expectedSize {
 		return fmt.Errorf("invalid input size: expected %d, got %d", expectedSize, len(input))
 	}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"model-inference-service/model"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAnalyzeRejectsOutputWithoutSignal(t *testing.T) {
+	nan := float32(math.NaN())
+	inf := float32(math.Inf(1))
+
+	tests := []struct {
+		name       string
+		activation model.Activation
+		output     []float32
+	}{
+		{"zeros before softmax", model.ActivationSoftmax, []float32{0, 0, 0, 0}},
+		{"constant logits before softmax", model.ActivationSoftmax, []float32{3, 3, 3, 3}},
+		{"zeros before sigmoid", model.ActivationSigmoid, []float32{0, 0, 0, 0}},
+		{"zeros without activation", model.ActivationNone, []float32{0, 0, 0, 0}},
+		{"uniform without activation", model.ActivationNone, []float32{0.25, 0.25, 0.25, 0.25}},
+		{"NaN", model.ActivationSoftmax, []float32{0.1, nan, 0.3, 0.2}},
+		{"Inf", model.ActivationNone, []float32{0.1, 0.2, inf, 0.3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewInferenceService([]Predictor{newStubPredictor(tt.activation, tt.output...)}, stubClasses(len(tt.output)), 0)
+
+			analysis, err := svc.Analyze(context.Background(), stubInput(), AnalyzeOptions{})
+			if !errors.Is(err, ErrNoSignal) {
+				t.Fatalf("Analyze() = %+v, %v; want ErrNoSignal", analysis, err)
+			}
+
+			if _, err := svc.AnalyzeBatch(context.Background(), [][]float32{stubInput()}, AnalyzeOptions{}); !errors.Is(err, ErrNoSignal) {
+				t.Fatalf("AnalyzeBatch() error = %v, want ErrNoSignal", err)
+			}
+		})
+	}
+}
+
+func TestAnalyzeAcceptsOutputWithSignal(t *testing.T) {
+	tests := []struct {
+		name       string
+		activation model.Activation
+		output     []float32
+		wantClass  int
+	}{
+		{"logits", model.ActivationSoftmax, []float32{0, 2, 0, -1}, 1},
+		{"probabilities", model.ActivationNone, []float32{0.1, 0.2, 0.6, 0.1}, 2},
+		{"single sigmoid class", model.ActivationSigmoid, []float32{4}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewInferenceService([]Predictor{newStubPredictor(tt.activation, tt.output...)}, stubClasses(len(tt.output)), 0)
+
+			analysis, err := svc.Analyze(context.Background(), stubInput(), AnalyzeOptions{TopK: 1})
+			if err != nil {
+				t.Fatalf("Analyze() error = %v", err)
+			}
+			if got := analysis.Predictions[0].ClassIndex; got != tt.wantClass {
+				t.Errorf("top class = %d, want %d", got, tt.wantClass)
+			}
+		})
+	}
+}
+
+func TestAnalyzeBreaksTiesByClassIndex(t *testing.T) {
+	svc := NewInferenceService([]Predictor{newStubPredictor(model.ActivationNone, 0.2, 0.3, 0.2, 0.3)}, stubClasses(4), 0)
+
+	for range 10 {
+		analysis, err := svc.Analyze(context.Background(), stubInput(), AnalyzeOptions{TopK: 4})
+		if err != nil {
+			t.Fatalf("Analyze() error = %v", err)
+		}
+		var got []int
+		for _, p := range analysis.Predictions {
+			got = append(got, p.ClassIndex)
+		}
+		if want := []int{1, 3, 0, 2}; !slices.Equal(got, want) {
+			t.Fatalf("ranked classes = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestAnalyzeRecoversModelPanic(t *testing.T) {
+	stub := newStubPredictor(model.ActivationSoftmax, 0, 2, 1)
+	var panicked atomic.Bool
+	stub.predict = func([]float32) ([]float32, error) {
+		if !panicked.Swap(true) {
+			panic("tensor index out of range")
+		}
+		return []float32{0, 2, 1}, nil
+	}
+	// A single instance: if the panicking call did not return it to the
+	// pool, the next call would wait until its deadline.
+	svc := NewInferenceService([]Predictor{stub}, stubClasses(3), time.Second)
+
+	if _, err := svc.Analyze(context.Background(), stubInput(), AnalyzeOptions{}); !errors.Is(err, ErrModelPanic) {
+		t.Fatalf("Analyze() error = %v, want ErrModelPanic", err)
+	}
+
+	analysis, err := svc.Analyze(context.Background(), stubInput(), AnalyzeOptions{TopK: 1})
+	if err != nil {
+		t.Fatalf("Analyze() after the panic error = %v, want the instance back in the pool", err)
+	}
+	if got := analysis.Predictions[0].ClassIndex; got != 1 {
+		t.Errorf("top class = %d, want 1", got)
+	}
+}
+
+func TestAnalyzeViewsAveragesProbabilities(t *testing.T) {
+	// Each view's first input value selects the class it votes for.
+	stub := newStubPredictor(model.ActivationNone, 0, 0, 0)
+	stub.predict = func(input []float32) ([]float32, error) {
+		output := []float32{0.1, 0.1, 0.1}
+		output[int(input[0])] = 0.8
+		return output, nil
+	}
+	svc := NewInferenceService([]Predictor{stub}, stubClasses(3), 0)
+
+	view := func(class int) []float32 {
+		input := stubInput()
+		input[0] = float32(class)
+		return input
+	}
+	views := [][]float32{view(2), view(2), view(0), view(1)}
+
+	analysis, err := svc.AnalyzeViews(context.Background(), views, AnalyzeOptions{TopK: 3, IncludeProbabilities: true})
+	if err != nil {
+		t.Fatalf("AnalyzeViews() error = %v", err)
+	}
+	want := map[string]float32{"a": 0.275, "b": 0.275, "c": 0.45}
+	for label, p := range want {
+		if got := analysis.Probabilities[label]; math.Abs(float64(got-p)) > 1e-6 {
+			t.Errorf("probability of %s = %v, want %v", label, got, p)
+		}
+	}
+	if got := analysis.Predictions[0].ClassName; got != "c" {
+		t.Errorf("top class = %q, want c", got)
+	}
+	if got := stub.calls.Load(); got != int64(len(views)) {
+		t.Errorf("model ran %d times, want %d", got, len(views))
+	}
+
+	batch, err := svc.AnalyzeBatchViews(context.Background(), [][][]float32{views, {view(1)}}, AnalyzeOptions{TopK: 1})
+	if err != nil {
+		t.Fatalf("AnalyzeBatchViews() error = %v", err)
+	}
+	if len(batch) != 2 || batch[0].Predictions[0].ClassName != "c" || batch[1].Predictions[0].ClassName != "b" {
+		t.Errorf("AnalyzeBatchViews() top classes = %v, want c and b", batch)
+	}
+}
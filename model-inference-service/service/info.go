@@ -0,0 +1,57 @@
+package service
+
+import "sort"
+
+// ModelInfo identifies a served model and its class set.
+type ModelInfo struct {
+	Name    string `json:"name"`
+	Primary bool   `json:"primary"`
+	Path    string `json:"path"`
+	// Source is the remote location the model file was downloaded from.
+	Source string `json:"source,omitempty"`
+	// SHA256 is the hex digest of the model file, computed when the model
+	// was loaded.
+	SHA256      string   `json:"sha256"`
+	NumClasses  int      `json:"num_classes"`
+	ClassLabels []string `json:"class_labels"`
+}
+
+// ModelInfos describes every registered model, sorted by name. The models
+// are read under one lock, so a concurrent reload is either fully reported
+// or not at all.
+func (s *InferenceService) ModelInfos() []ModelInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.models))
+	for name := range s.models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	infos := make([]ModelInfo, 0, len(names))
+	for _, name := range names {
+		p := s.models[name]
+		labels := make([]string, len(p.classDict))
+		for i, class := range p.classDict {
+			labels[i] = class.Label
+		}
+		infos = append(infos, ModelInfo{
+			Name:        name,
+			Primary:     name == s.primary,
+			Path:        p.path,
+			Source:      p.source,
+			SHA256:      p.sha256,
+			NumClasses:  len(p.classDict),
+			ClassLabels: labels,
+		})
+	}
+	return infos
+}
+
+// ModelDigest returns the SHA-256 digest of the model file serving name,
+// see ResolveModel. It changes when the model is reloaded from a different
+// file and is empty for models not loaded from a file.
+func (s *InferenceService) ModelDigest(name string) string {
+	return s.model(name).sha256
+}
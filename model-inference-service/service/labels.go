@@ -0,0 +1,101 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// LabelGroup reports several model output classes as one label, e.g. three
+// eczema subtypes as "eczema". The probability of the group is the sum of
+// the probabilities of its classes.
+type LabelGroup struct {
+	Label string `json:"label"`
+	// Classes are the model output indices merged into Label.
+	Classes        []int  `json:"classes"`
+	Description    string `json:"description"`
+	Recommendation string `json:"recommendation"`
+}
+
+// ParseLabelMap parses a label map, a JSON array of
+// {"label", "classes", "description", "recommendation"} objects.
+func ParseLabelMap(data []byte) ([]LabelGroup, error) {
+	var groups []LabelGroup
+	if err := json.Unmarshal(data, &groups); err != nil {
+		return nil, fmt.Errorf("expected an array of {label, classes, description, recommendation} objects: %v", err)
+	}
+	return groups, nil
+}
+
+// labelMerge maps the model output classes onto the reported classes.
+// Classes that are in no group are reported as themselves. Reported classes
+// are ordered by the lowest output index they contain.
+type labelMerge struct {
+	// target is the reported class of each output index.
+	target []int
+	// classes describes each reported class.
+	classes []ClassInfo
+	// index is the lowest output index of each reported class, used as its
+	// PredictionResult.ClassIndex.
+	index []int
+}
+
+// newLabelMerge checks groups against the class dictionary and builds the
+// mapping. Every class index must exist and belong to at most one group,
+// and the reported labels must be unique.
+func newLabelMerge(classDict []ClassInfo, groups []LabelGroup) (*labelMerge, error) {
+	groupOf := make([]int, len(classDict))
+	for i := range groupOf {
+		groupOf[i] = -1
+	}
+	for g, group := range groups {
+		if group.Label == "" {
+			return nil, fmt.Errorf("label group %d has no label", g)
+		}
+		if len(group.Classes) == 0 {
+			return nil, fmt.Errorf("label group %q has no classes", group.Label)
+		}
+		for _, class := range group.Classes {
+			if class < 0 || class >= len(classDict) {
+				return nil, fmt.Errorf("label group %q: class %d is out of range [0, %d)", group.Label, class, len(classDict))
+			}
+			if groupOf[class] != -1 {
+				return nil, fmt.Errorf("label group %q: class %d is already in group %q", group.Label, class, groups[groupOf[class]].Label)
+			}
+			groupOf[class] = g
+		}
+	}
+
+	m := &labelMerge{target: make([]int, len(classDict))}
+	reportedGroup := make(map[int]int, len(groups))
+	labels := make(map[string]bool, len(classDict))
+	for i, class := range classDict {
+		g := groupOf[i]
+		if g != -1 {
+			if reported, ok := reportedGroup[g]; ok {
+				m.target[i] = reported
+				continue
+			}
+			reportedGroup[g] = len(m.classes)
+			group := groups[g]
+			class = ClassInfo{Label: group.Label, Description: group.Description, Recommendation: group.Recommendation}
+		}
+		if labels[class.Label] {
+			return nil, fmt.Errorf("label %q is reported by more than one class", class.Label)
+		}
+		labels[class.Label] = true
+		m.target[i] = len(m.classes)
+		m.classes = append(m.classes, class)
+		m.index = append(m.index, i)
+	}
+	return m, nil
+}
+
+// apply sums the probabilities of the output classes into the reported
+// classes.
+func (m *labelMerge) apply(probabilities []float32) []float32 {
+	merged := make([]float32, len(m.classes))
+	for i, probability := range probabilities {
+		merged[m.target[i]] += probability
+	}
+	return merged
+}
@@ -0,0 +1,31 @@
+package service
+
+import "model-inference-service/model"
+
+// Predictor is the model interface InferenceService runs on. *model.ONNXModel
+// implements it; a fake with fixed outputs can stand in for it to exercise
+// the service without ONNX Runtime or a model file.
+type Predictor interface {
+	Predict(input []float32) ([]float32, error)
+	PredictClass(input []float32) (int, float32, error)
+	GetTopKPredictions(input []float32, k int) ([]int, []float32, error)
+	PredictBatch(inputs [][]float32) ([][]float32, error)
+	// PredictRaw and PredictBatchRaw return the output before the
+	// activation, which the service checks for a dead model before applying
+	// GetOutputActivation itself.
+	PredictRaw(input []float32) ([]float32, error)
+	PredictBatchRaw(inputs [][]float32) ([][]float32, error)
+	GetExpectedInputSize() int
+	GetNumClasses() int
+	GetLayout() model.Layout
+	GetInputSize() (width, height int)
+	// GetOutputActivation and GetMultiLabelThreshold describe how the output
+	// is ranked: sigmoid models report every class reaching the threshold.
+	GetOutputActivation() model.Activation
+	GetMultiLabelThreshold() float32
+	// Close releases the instance. InferenceService calls it when a reload
+	// has replaced the instance and its last call has finished.
+	Close() error
+}
+
+var _ Predictor = (*model.ONNXModel)(nil)
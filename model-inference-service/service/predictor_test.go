@@ -0,0 +1,137 @@
+package service
+
+import (
+	"errors"
+	"model-inference-service/model"
+	"sync/atomic"
+)
+
+// stubInputWidth and stubInputHeight are the input size of stubPredictor.
+const (
+	stubInputWidth  = 2
+	stubInputHeight = 2
+)
+
+// stubPredictor is a Predictor returning the raw output of predict for
+// every input, standing in for an ONNX model.
+type stubPredictor struct {
+	numClasses int
+	activation model.Activation
+	predict    func(input []float32) ([]float32, error)
+
+	calls  atomic.Int64
+	closed atomic.Bool
+}
+
+// newStubPredictor returns a predictor whose raw output is always output.
+func newStubPredictor(activation model.Activation, output ...float32) *stubPredictor {
+	return &stubPredictor{
+		numClasses: len(output),
+		activation: activation,
+		predict: func([]float32) ([]float32, error) {
+			return append([]float32(nil), output...), nil
+		},
+	}
+}
+
+func (m *stubPredictor) PredictRaw(input []float32) ([]float32, error) {
+	if m.closed.Load() {
+		return nil, errors.New("stub predictor used after Close")
+	}
+	m.calls.Add(1)
+	return m.predict(input)
+}
+
+func (m *stubPredictor) PredictBatchRaw(inputs [][]float32) ([][]float32, error) {
+	outputs := make([][]float32, len(inputs))
+	for i, input := range inputs {
+		output, err := m.PredictRaw(input)
+		if err != nil {
+			return nil, err
+		}
+		outputs[i] = output
+	}
+	return outputs, nil
+}
+
+func (m *stubPredictor) Predict(input []float32) ([]float32, error) {
+	output, err := m.PredictRaw(input)
+	if err != nil {
+		return nil, err
+	}
+	return m.activation.Apply(output), nil
+}
+
+func (m *stubPredictor) PredictBatch(inputs [][]float32) ([][]float32, error) {
+	outputs, err := m.PredictBatchRaw(inputs)
+	if err != nil {
+		return nil, err
+	}
+	for i, output := range outputs {
+		outputs[i] = m.activation.Apply(output)
+	}
+	return outputs, nil
+}
+
+func (m *stubPredictor) PredictClass(input []float32) (int, float32, error) {
+	probabilities, err := m.Predict(input)
+	if err != nil {
+		return -1, 0, err
+	}
+	indices, probs := model.RankTopK(probabilities, 1)
+	return indices[0], probs[0], nil
+}
+
+func (m *stubPredictor) GetTopKPredictions(input []float32, k int) ([]int, []float32, error) {
+	probabilities, err := m.Predict(input)
+	if err != nil {
+		return nil, nil, err
+	}
+	indices, probs := model.RankTopK(probabilities, k)
+	return indices, probs, nil
+}
+
+func (m *stubPredictor) GetExpectedInputSize() int {
+	return stubInputWidth * stubInputHeight * 3
+}
+
+func (m *stubPredictor) GetNumClasses() int {
+	return m.numClasses
+}
+
+func (m *stubPredictor) GetLayout() model.Layout {
+	return model.LayoutNHWC
+}
+
+func (m *stubPredictor) GetInputSize() (width, height int) {
+	return stubInputWidth, stubInputHeight
+}
+
+func (m *stubPredictor) GetOutputActivation() model.Activation {
+	return m.activation
+}
+
+func (m *stubPredictor) GetMultiLabelThreshold() float32 {
+	return model.DefaultMultiLabelThreshold
+}
+
+func (m *stubPredictor) Close() error {
+	if m.closed.Swap(true) {
+		return errors.New("stub predictor closed twice")
+	}
+	return nil
+}
+
+// stubClasses returns a class dictionary of n classes.
+func stubClasses(n int) []ClassInfo {
+	classes := make([]ClassInfo, n)
+	for i := range classes {
+		classes[i] = ClassInfo{Label: string(rune('a' + i))}
+	}
+	return classes
+}
+
+// stubInput returns an input of the size stubPredictor expects.
+func stubInput() []float32 {
+	return make([]float32, stubInputWidth*stubInputHeight*3)
+}
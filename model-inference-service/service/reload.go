@@ -0,0 +1,154 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"model-inference-service/model"
+)
+
+// ModelLoader loads the instances of the named model from a model location,
+// a local path or a URL the loader downloads. It returns the local path of
+// the loaded file. It is used by ReloadNamedModel, which applies the same
+// pooling and config as the models loaded at startup.
+type ModelLoader func(name, location string) (predictors []Predictor, path string, err error)
+
+// SetModelLoader sets the loader used by ReloadModel and ReloadNamedModel.
+func (s *InferenceService) SetModelLoader(loader ModelLoader) {
+	s.loader = loader
+}
+
+// ModelRemover is called with the local path of a model once no instance
+// loaded from it is open any more: after a replaced model drains, after a
+// reloaded model fails validation, and at Close. It lets a loader that
+// downloads models delete the files it no longer needs.
+type ModelRemover func(name, path string)
+
+// SetModelRemover sets the function called with the paths of models that
+// are no longer used. It must be called before the service is used.
+func (s *InferenceService) SetModelRemover(remover ModelRemover) {
+	s.remover = remover
+}
+
+// ReloadModel replaces the primary model with the one at location, keeping
+// its class dictionary. See ReloadNamedModel.
+func (s *InferenceService) ReloadModel(location string) error {
+	return s.ReloadNamedModel(s.primary, location, nil)
+}
+
+// ReloadNamedModel loads the model at location and swaps it in for the
+// registered model name. An empty location reloads the current model from
+// where it was loaded, downloading it again when it is remote, and a nil
+// classDict keeps the current class dictionary. The label map is
+// kept and must still fit the new class dictionary.
+//
+// Calls already running on the previous instances finish on them; the
+// previous instances are closed once the last of those calls returns.
+func (s *InferenceService) ReloadNamedModel(name, location string, classDict []ClassInfo) error {
+	if s.loader == nil {
+		return errors.New("model reload is not configured")
+	}
+
+	current := s.lookup(name)
+	if current == nil {
+		return fmt.Errorf("unknown model %q", name)
+	}
+	if location == "" {
+		location = current.location()
+	}
+	if classDict == nil {
+		classDict = current.classDict
+	}
+
+	predictors, path, err := s.loader(name, location)
+	if err != nil {
+		return fmt.Errorf("failed to load model %q from %s: %w", name, location, err)
+	}
+	set := ModelSet{Path: path, Predictors: predictors, ClassDict: classDict, LabelGroups: current.labelGroups}
+	if path != location {
+		set.Source = location
+	}
+	if err := set.Validate(); err != nil {
+		closePredictors(name, predictors)
+		s.remove(name, path)
+		return fmt.Errorf("model %q from %s: %w", name, location, err)
+	}
+
+	digest, err := model.FileSHA256(path)
+	if err != nil {
+		closePredictors(name, predictors)
+		s.remove(name, path)
+		return fmt.Errorf("model %q: %w", name, err)
+	}
+
+	next := newModelPool(name, set)
+	next.sha256 = digest
+
+	s.mu.Lock()
+	previous := s.models[name]
+	s.models[name] = next
+	s.mu.Unlock()
+
+	s.drains.Add(1)
+	go func() {
+		defer s.drains.Done()
+		previous.drain(name)
+		s.remove(name, previous.path)
+	}()
+
+	return nil
+}
+
+// Close waits for replaced pools to drain and closes every model instance.
+// It must only be called once no more calls are made on the service.
+func (s *InferenceService) Close() {
+	s.drains.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, p := range s.models {
+		p.drain(name)
+		s.remove(name, p.path)
+	}
+}
+
+// remove passes path to the ModelRemover, if one is set.
+func (s *InferenceService) remove(name, path string) {
+	if s.remover != nil && path != "" {
+		s.remover(name, path)
+	}
+}
+
+// location returns where the pool's model was loaded from.
+func (p *modelPool) location() string {
+	if p.source != "" {
+		return p.source
+	}
+	return p.path
+}
+
+// lookup returns the pool registered as name, or nil.
+func (s *InferenceService) lookup(name string) *modelPool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.models[name]
+}
+
+// drain waits for the calls checked out on p and closes its instances.
+func (p *modelPool) drain(name string) {
+	p.inflight.Wait()
+
+	predictors := make([]Predictor, 0, p.size)
+	for range p.size {
+		predictors = append(predictors, <-p.pool)
+	}
+	closePredictors(name, predictors)
+}
+
+func closePredictors(name string, predictors []Predictor) {
+	for _, m := range predictors {
+		if err := m.Close(); err != nil {
+			slog.Warn("failed to close model instance", "model", name, "error", err)
+		}
+	}
+}
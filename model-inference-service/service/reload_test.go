@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"model-inference-service/model"
+)
+
+// TestReloadDuringAnalyze reloads both models of a service over and over
+// while other goroutines analyze on them. Run with -race: every call must
+// succeed on an instance that is not closed, and every replaced instance
+// must be closed exactly once.
+func TestReloadDuringAnalyze(t *testing.T) {
+	const (
+		poolSize  = 2
+		reloads   = 50
+		analyzers = 8
+	)
+
+	path := filepath.Join(t.TempDir(), "model.onnx")
+	if err := os.WriteFile(path, []byte("stub model"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var created []*stubPredictor
+	newPool := func() []Predictor {
+		mu.Lock()
+		defer mu.Unlock()
+		predictors := make([]Predictor, poolSize)
+		for i := range predictors {
+			stub := newStubPredictor(model.ActivationSoftmax, 0, 2, 1)
+			created = append(created, stub)
+			predictors[i] = stub
+		}
+		return predictors
+	}
+
+	svc, err := NewMultiModelInferenceService(map[string]ModelSet{
+		DefaultModel: {Path: path, Predictors: newPool(), ClassDict: stubClasses(3)},
+		"face":       {Path: path, Predictors: newPool(), ClassDict: stubClasses(3)},
+	}, DefaultModel, 0)
+	if err != nil {
+		t.Fatalf("NewMultiModelInferenceService() error = %v", err)
+	}
+	svc.SetModelLoader(func(name, location string) ([]Predictor, string, error) {
+		return newPool(), location, nil
+	})
+
+	ctx, stop := context.WithCancel(context.Background())
+	var analyzed atomic.Int64
+	var wg sync.WaitGroup
+	for i := range analyzers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := []string{"", "face"}[i%2]
+			for ctx.Err() == nil {
+				var err error
+				if i%4 < 2 {
+					_, err = svc.Analyze(ctx, stubInput(), AnalyzeOptions{Model: name})
+				} else {
+					_, err = svc.AnalyzeBatch(ctx, [][]float32{stubInput(), stubInput()}, AnalyzeOptions{Model: name})
+				}
+				if err != nil && ctx.Err() == nil {
+					t.Errorf("analysis on %q failed during reloads: %v", name, err)
+					return
+				}
+				analyzed.Add(1)
+			}
+		}()
+	}
+
+	for i := range reloads {
+		// Let some analyses run on the current pools before replacing them.
+		deadline := time.Now().Add(time.Second)
+		for start := analyzed.Load(); analyzed.Load() == start && time.Now().Before(deadline); {
+			runtime.Gosched()
+		}
+		name := []string{DefaultModel, "face"}[i%2]
+		if err := svc.ReloadNamedModel(name, "", nil); err != nil {
+			t.Fatalf("reload %d of %q: %v", i, name, err)
+		}
+	}
+	stop()
+	wg.Wait()
+	svc.Close()
+
+	if got := analyzed.Load(); got < reloads {
+		t.Errorf("%d analyses ran during %d reloads, want at least one per reload", got, reloads)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := 2*poolSize + reloads*poolSize; len(created) != want {
+		t.Errorf("created %d instances, want %d", len(created), want)
+	}
+	for i, stub := range created {
+		if !stub.closed.Load() {
+			t.Errorf("instance %d was never closed", i)
+		}
+	}
+}
+
+func TestReloadRemovesUnusedModelFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeModel := func(name string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("stub model"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	first := newStubPredictor(model.ActivationSoftmax, 0, 2, 1)
+	svc, err := NewMultiModelInferenceService(map[string]ModelSet{
+		DefaultModel: {Path: writeModel("first.onnx"), Source: "https://models.example/skin.onnx", Predictors: []Predictor{first}, ClassDict: stubClasses(3)},
+	}, DefaultModel, 0)
+	if err != nil {
+		t.Fatalf("NewMultiModelInferenceService() error = %v", err)
+	}
+
+	var loaded []*stubPredictor
+	svc.SetModelLoader(func(name, location string) ([]Predictor, string, error) {
+		// The second reload loads a model whose class count does not match
+		// the dictionary, so it fails validation.
+		stub := newStubPredictor(model.ActivationSoftmax, make([]float32, 3+len(loaded))...)
+		loaded = append(loaded, stub)
+		return []Predictor{stub}, writeModel(fmt.Sprintf("reload%d.onnx", len(loaded))), nil
+	})
+	var removed []string
+	svc.SetModelRemover(func(name, path string) {
+		if !first.closed.Load() && filepath.Base(path) == "first.onnx" {
+			t.Errorf("%s removed before its instances were closed", path)
+		}
+		removed = append(removed, filepath.Base(path))
+	})
+
+	if err := svc.ReloadNamedModel(DefaultModel, "", nil); err != nil {
+		t.Fatalf("first reload error = %v", err)
+	}
+	svc.drains.Wait()
+	if err := svc.ReloadNamedModel(DefaultModel, "", nil); err == nil {
+		t.Fatal("second reload succeeded, want a validation error")
+	}
+	if want := []string{"first.onnx", "reload2.onnx"}; !slices.Equal(removed, want) {
+		t.Errorf("removed %v after the reloads, want %v", removed, want)
+	}
+
+	svc.Close()
+	if want := []string{"first.onnx", "reload2.onnx", "reload1.onnx"}; !slices.Equal(removed, want) {
+		t.Errorf("removed %v after Close, want %v", removed, want)
+	}
+}
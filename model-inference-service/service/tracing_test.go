@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"model-inference-service/model"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestAnalyzeFailsSpanOnUnknownClass(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	// The model returns a fourth class the dictionary does not have, so
+	// building the analysis fails after the model call succeeded.
+	stub := newStubPredictor(model.ActivationSoftmax, 0, 0, 0)
+	stub.predict = func([]float32) ([]float32, error) {
+		return []float32{0, 0, 0, 5}, nil
+	}
+	svc := NewInferenceService([]Predictor{stub}, stubClasses(3), 0)
+	ctx := context.Background()
+	if _, err := svc.Analyze(ctx, stubInput(), AnalyzeOptions{}); err == nil {
+		t.Fatal("Analyze() succeeded, want an unknown class error")
+	}
+	if _, err := svc.AnalyzeViews(ctx, [][]float32{stubInput()}, AnalyzeOptions{}); err == nil {
+		t.Fatal("AnalyzeViews() succeeded, want an unknown class error")
+	}
+	if _, err := svc.AnalyzeBatch(ctx, [][]float32{stubInput()}, AnalyzeOptions{}); err == nil {
+		t.Fatal("AnalyzeBatch() succeeded, want an unknown class error")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("recorded %d spans, want 3", len(spans))
+	}
+	for _, span := range spans {
+		if span.Status().Code != codes.Error {
+			t.Errorf("span %s ended with status %v, want Error", span.Name(), span.Status().Code)
+		}
+	}
+}